@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mqtt-http-bridge/src/config"
+	"mqtt-http-bridge/src/process"
+	"mqtt-http-bridge/src/server"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+func runExport(cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", subscription.BundleFormatJSON, "format of the bundle (json/yaml)")
+	withoutSecrets := flags.Bool("without-secrets", false, "leave the encrypted secrets out of the bundle")
+	output := flags.String("output", "", "file to write the bundle to, defaults to stdout")
+	remote := addConnectionFlags(flags, "", "URL of a running bridge to export through its API, the store is read directly when omitted")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var data []byte
+	var err error
+
+	if remote.server != "" {
+		query := url.Values{"format": {*format}, "secrets": {strconv.FormatBool(!*withoutSecrets)}}
+
+		if data, err = remote.client().do(http.MethodGet, "/export?"+query.Encode(), nil, nil); err != nil {
+			return fmt.Errorf("unable to export: %w", err)
+		}
+	} else if data, err = exportStore(cfg, *format, !*withoutSecrets); err != nil {
+		return err
+	}
+
+	if *output != "" {
+		return os.WriteFile(*output, data, 0600)
+	}
+
+	_, err = stdout.Write(data)
+
+	return err
+}
+
+func exportStore(cfg *config.Config, format string, withSecrets bool) ([]byte, error) {
+	if err := checkLocalStore(cfg, "export"); err != nil {
+		return nil, fmt.Errorf("unable to export: %w", err)
+	}
+
+	service, err := process.SetUpService(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer service.Close()
+
+	bundle, err := service.Export(withSecrets)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to export: %w", err)
+	}
+
+	data, err := subscription.MarshalBundle(bundle, format)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to export: %w", err)
+	}
+
+	return data, nil
+}
+
+func runImport(cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", subscription.BundleFormatJSON, "format of the bundle (json/yaml)")
+	mode := flags.String("mode", subscription.ImportModeMerge, "merge with the store, or replace its contents (merge/replace)")
+	conflict := flags.String("conflict", subscription.ImportConflictOverwrite, "what to do with existing subscriptions when merging (overwrite/skip/fail/rename)")
+	dryRun := flags.Bool("dry-run", false, "only report the changes")
+	remote := addConnectionFlags(flags, "", "URL of a running bridge to import through its API, the store is changed directly when omitted")
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: import [flags] <file, or - for stdin>")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single bundle file")
+	}
+
+	var data []byte
+	var err error
+
+	if flags.Arg(0) == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(flags.Arg(0))
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to read bundle: %w", err)
+	}
+
+	var changes []subscription.ImportChange
+
+	if remote.server != "" {
+		changes, err = importRemote(remote.client(), data, *format, *mode, *conflict, *dryRun)
+	} else {
+		changes, err = importStore(cfg, data, *format, subscription.ImportOptions{
+			Mode:     *mode,
+			Conflict: *conflict,
+			DryRun:   *dryRun,
+			Actor:    subscription.Actor{Name: "cli"},
+		})
+	}
+
+	for _, change := range changes {
+		if change.NewKey != "" {
+			_, _ = fmt.Fprintf(stdout, "%-9s %-15s %s (as %s)\n", change.Action, change.Kind, change.Key, change.NewKey)
+		} else {
+			_, _ = fmt.Fprintf(stdout, "%-9s %-15s %s\n", change.Action, change.Kind, change.Key)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to import: %w", err)
+	}
+
+	if *dryRun {
+		_, _ = fmt.Fprintln(stdout, "Dry run, no changes were made.")
+	}
+
+	return nil
+}
+
+func importStore(cfg *config.Config, data []byte, format string, opts subscription.ImportOptions) ([]subscription.ImportChange, error) {
+	if err := checkLocalStore(cfg, "import"); err != nil {
+		return nil, err
+	}
+
+	bundle, err := subscription.ParseBundle(data, format)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+
+	if err := server.ValidateBundle(bundle); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+
+	service, err := process.SetUpService(cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer service.Close()
+
+	return service.Import(bundle, opts)
+}
+
+// checkLocalStore refuses to use the store directly when it's kept in memory, as the store would be a new, empty one
+// rather than the one of the running bridge.
+func checkLocalStore(cfg *config.Config, action string) error {
+	inMemory := cfg.Storage.Driver == "memory"
+
+	if cfg.Storage.Driver == "yaml" {
+		storageConfig, err := cfg.StorageConfigYAML()
+
+		if err != nil {
+			return err
+		}
+
+		inMemory = storageConfig.Overlay == "memory"
+	}
+
+	if inMemory {
+		return fmt.Errorf("the store is kept in memory by the running bridge, pass --server to %s through its API", action)
+	}
+
+	return nil
+}
+
+// importRemote sends the bundle to the API, which validates it the same way importStore does.
+func importRemote(client *apiClient, data []byte, format string, mode string, conflict string, dryRun bool) ([]subscription.ImportChange, error) {
+	query := url.Values{"format": {format}, "mode": {mode}, "conflict": {conflict}, "dryRun": {strconv.FormatBool(dryRun)}}
+	contentType := "application/json"
+
+	if format == subscription.BundleFormatYAML {
+		contentType = "application/yaml"
+	}
+
+	response, err := client.do(http.MethodPost, "/import?"+query.Encode(), data, http.Header{"Content-Type": {contentType}})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Changes []subscription.ImportChange `json:"changes"`
+	}
+
+	if err := json.Unmarshal(response, &result); err != nil {
+		return nil, fmt.Errorf("unable to decode the response: %w", err)
+	}
+
+	return result.Changes, nil
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mqtt-http-bridge/src/config"
+	"slices"
+	"strings"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+type command struct {
+	name        string
+	description string
+	// standalone commands don't need a valid configuration, they receive nil instead
+	standalone bool
+	run        func(cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{name: "export", description: "Write the subscriptions, global parameters and secrets to a bundle", run: runExport},
+	{name: "import", description: "Apply a bundle to the store", run: runImport},
+	{name: "subscriptions", description: "Manage the subscriptions of a running bridge", run: runSubscriptions},
+	{name: "parameters", description: "Manage the global parameters and secrets of a running bridge", run: runParameters},
+	{name: "simulate", description: "Show the requests a message would trigger, without sending them", run: runSimulate},
+	{name: "tail", description: "Follow the MQTT messages received by a running bridge", run: runTail},
+	{name: "validate-config", description: "Check the configuration file and list all problems", standalone: true, run: runValidateConfig},
+}
+
+// IsCommand reports whether the arguments start with a known command, rather than starting the bridge.
+func IsCommand(args []string) bool {
+	return len(args) > 0 && slices.ContainsFunc(commands, func(c command) bool { return c.name == args[0] })
+}
+
+// Run executes the command in the first argument, loading the configuration first unless the command is standalone.
+func Run(args []string, stdin io.Reader, stdout io.Writer) error {
+	for _, c := range commands {
+		if len(args) == 0 || c.name != args[0] {
+			continue
+		}
+
+		if c.standalone {
+			return c.run(nil, args[1:], stdin, stdout)
+		}
+
+		cfg, err := config.Load()
+
+		if err != nil {
+			return fmt.Errorf("unable to load config: %w", err)
+		}
+
+		return c.run(cfg, args[1:], stdin, stdout)
+	}
+
+	return fmt.Errorf("%w: %s\n\n%s", ErrUnknownCommand, strings.Join(args, " "), usage(commands))
+}
+
+// runSubcommand executes the subcommand in the first argument, for commands grouping several actions.
+func runSubcommand(subcommands []command, cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error {
+	for _, c := range subcommands {
+		if len(args) > 0 && c.name == args[0] {
+			return c.run(cfg, args[1:], stdin, stdout)
+		}
+	}
+
+	return fmt.Errorf("%w: %s\n\n%s", ErrUnknownCommand, strings.Join(args, " "), usage(subcommands))
+}
+
+func usage(commands []command) string {
+	var b strings.Builder
+
+	b.WriteString("Available commands:\n")
+
+	for _, c := range commands {
+		fmt.Fprintf(&b, "  %-14s %s\n", c.name, c.description)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, name string, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+
+	return path
+}
+
+func TestIsCommand(t *testing.T) {
+	assert.True(t, IsCommand([]string{"validate-config", "config.yaml"}))
+	assert.True(t, IsCommand([]string{"subscriptions", "list"}))
+	assert.False(t, IsCommand([]string{"--help"}), "Anything else starts the bridge")
+	assert.False(t, IsCommand(nil))
+}
+
+func TestRunValidateConfig(t *testing.T) {
+	valid := writeFile(t, "valid.yaml", "broker:\n  open-auth: true\nstorage:\n  driver: memory\n")
+	invalid := writeFile(t, "invalid.yaml", "broker:\n  open-auth: true\n  port: 99999\nstorage:\n  driver: memory\nhttp:\n  port: 8080\n")
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	// A returned error makes the binary exit with status 1.
+	tests := []struct {
+		name   string
+		args   []string
+		output string
+		err    string
+	}{
+		{name: "valid file", args: []string{"validate-config", valid}, output: valid + " is valid\n"},
+		{
+			name:   "all problems are listed",
+			args:   []string{"validate-config", invalid},
+			output: "- line 6: field http not found in type config.Config\n- broker: invalid port 99999 (should be between 1 and 65535)\n",
+			err:    invalid + " is invalid, found 2 problem(s)",
+		},
+		{name: "missing file", args: []string{"validate-config", missing}, output: "- open " + missing + ": no such file or directory\n", err: "found 1 problem(s)"},
+		{name: "file from the environment", args: []string{"validate-config"}, output: valid + " is valid\n"},
+		{name: "too many files", args: []string{"validate-config", valid, invalid}, err: "expected at most one file"},
+		{name: "unknown flag", args: []string{"validate-config", "--strict", valid}, err: "flag provided but not defined: -strict"},
+		{name: "unknown command", args: []string{"validate", valid}, err: "unknown command: validate " + valid + "\n\nAvailable commands:\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", valid)
+
+			var stdout bytes.Buffer
+
+			err := Run(tt.args, nil, &stdout)
+
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.err)
+			}
+
+			assert.Equal(t, tt.output, stdout.String())
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mqtt-http-bridge/src/config"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// clientOptions are the flags shared by all commands that talk to a running bridge through its API.
+type clientOptions struct {
+	server   string
+	user     string
+	password string
+	output   string
+}
+
+func addClientFlags(flags *flag.FlagSet, cfg *config.Config) *clientOptions {
+	opts := addConnectionFlags(flags, defaultServerURL(cfg), "URL of the bridge")
+
+	flags.StringVar(&opts.output, "output", outputTable, "output format (table/json)")
+
+	return opts
+}
+
+// addConnectionFlags adds the flags to connect to the API, for commands that can also work without it.
+func addConnectionFlags(flags *flag.FlagSet, server string, serverUsage string) *clientOptions {
+	var opts clientOptions
+
+	flags.StringVar(&opts.server, "server", server, serverUsage)
+	flags.StringVar(&opts.user, "user", "cli", "user to send with basic auth, changes are attributed to it in the audit log")
+	flags.StringVar(&opts.password, "password", "", "password to send with basic auth")
+
+	return &opts
+}
+
+// defaultServerURL points to the API of the bridge using the same configuration as the CLI.
+func defaultServerURL(cfg *config.Config) string {
+	host := cfg.Server.Address
+
+	if host == "" || net.ParseIP(host).IsUnspecified() {
+		host = "localhost"
+	}
+
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Server.Port))
+}
+
+func (o *clientOptions) validate() error {
+	if o.output != outputTable && o.output != outputJSON {
+		return fmt.Errorf("unknown output format %s", o.output)
+	}
+
+	return nil
+}
+
+func (o *clientOptions) client() *apiClient {
+	return &apiClient{
+		baseURL:  strings.TrimRight(o.server, "/") + "/api/v1",
+		user:     o.user,
+		password: o.password,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type apiClient struct {
+	baseURL  string
+	user     string
+	password string
+	http     *http.Client
+}
+
+// apiError is an error response of the API.
+type apiError struct {
+	status   int
+	messages []string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (%d)", strings.Join(e.messages, "; "), e.status)
+}
+
+// authHeader returns the basic auth header, which also has to be sent when connecting to the websocket.
+func (c *apiClient) authHeader() http.Header {
+	header := http.Header{}
+
+	if c.user != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.user+":"+c.password)))
+	}
+
+	return header
+}
+
+// do sends the request and returns the body of a successful response.
+func (c *apiClient) do(method string, path string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range c.authHeader() {
+		req.Header[key] = values
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach the bridge: %w", err)
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the response: %w", err)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, parseAPIError(res.StatusCode, data)
+	}
+
+	return data, nil
+}
+
+// doJSON sends the request with the input encoded as JSON, and decodes the response into the output when not nil.
+func (c *apiClient) doJSON(method string, path string, in any, out any, header http.Header) error {
+	var body []byte
+
+	if in != nil {
+		var err error
+
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("unable to encode the request: %w", err)
+		}
+	}
+
+	data, err := c.do(method, path, body, header)
+
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unable to decode the response: %w", err)
+	}
+
+	return nil
+}
+
+func parseAPIError(status int, data []byte) error {
+	var response struct {
+		Error json.RawMessage `json:"error"`
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil || response.Error == nil {
+		return &apiError{status: status, messages: []string{http.StatusText(status)}}
+	}
+
+	var message string
+
+	if err := json.Unmarshal(response.Error, &message); err == nil {
+		return &apiError{status: status, messages: []string{message}}
+	}
+
+	var messages []string
+
+	if err := json.Unmarshal(response.Error, &messages); err == nil && len(messages) > 0 {
+		return &apiError{status: status, messages: messages}
+	}
+
+	return &apiError{status: status, messages: []string{string(response.Error)}}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// writeJSON writes the value indented, raw JSON values are indented as they are.
+func writeJSON(w io.Writer, value any) error {
+	if raw, ok := value.(json.RawMessage); ok {
+		var buf bytes.Buffer
+
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return err
+		}
+
+		buf.WriteByte('\n')
+		_, err := buf.WriteTo(w)
+
+		return err
+	}
+
+	data, err := json.MarshalIndent(value, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", data)
+
+	return err
+}
+
+// writeTable writes the rows as aligned columns below the header.
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, row := range rows {
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mqtt-http-bridge/src/config"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+)
+
+const (
+	parameterTypeValue  = "value"
+	parameterTypeSecret = "secret"
+)
+
+var parameterCommands = []command{
+	{name: "list", description: "List the global parameters and secrets", run: runListParameters},
+	{name: "set", description: "Set a global parameter or secret", run: runSetParameter},
+	{name: "delete", description: "Delete a global parameter or secret", run: runDeleteParameter},
+}
+
+func runParameters(cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error {
+	return runSubcommand(parameterCommands, cfg, args, stdin, stdout)
+}
+
+func runListParameters(cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("parameters list", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	var response struct {
+		Parameters map[string]json.RawMessage `json:"parameters"`
+		Secrets    map[string]string          `json:"secrets"`
+		ReadOnly   []string                   `json:"readOnly"`
+	}
+
+	if err := opts.client().doJSON(http.MethodGet, "/global-parameters", nil, &response, nil); err != nil {
+		return fmt.Errorf("unable to list global parameters: %w", err)
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(stdout, response)
+	}
+
+	rows := make([][]string, 0, len(response.Parameters)+len(response.Secrets))
+
+	for key, value := range response.Parameters {
+		kind := parameterTypeValue
+
+		if slices.Contains(response.ReadOnly, key) {
+			kind += " (read-only)"
+		}
+
+		rows = append(rows, []string{key, kind, string(value)})
+	}
+
+	for key, value := range response.Secrets {
+		rows = append(rows, []string{key, parameterTypeSecret, value})
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+
+	return writeTable(stdout, []string{"KEY", "TYPE", "VALUE"}, rows)
+}
+
+func runSetParameter(cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("parameters set", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+	secret := flags.Bool("secret", false, "store the value as an encrypted secret")
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: parameters set [flags] <key> <value>")
+		_, _ = fmt.Fprintln(flags.Output(), "Values that are valid JSON are stored as such, others as a string.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected a key and a value")
+	}
+
+	key, value := flags.Arg(0), json.RawMessage(flags.Arg(1))
+	kind := parameterTypeValue
+
+	if *secret {
+		kind = parameterTypeSecret
+	}
+
+	if *secret || !json.Valid(value) {
+		value, _ = json.Marshal(flags.Arg(1))
+	}
+
+	request := map[string]any{"key": key, "value": value, "type": kind}
+
+	if err := opts.client().doJSON(http.MethodPost, "/global-parameters", request, nil, nil); err != nil {
+		return fmt.Errorf("unable to set %s: %w", key, err)
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(stdout, map[string]any{"key": key, "type": kind})
+	}
+
+	_, err := fmt.Fprintf(stdout, "Set %s %s\n", kind, key)
+
+	return err
+}
+
+func runDeleteParameter(cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("parameters delete", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+	secret := flags.Bool("secret", false, "delete a secret rather than a global parameter")
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: parameters delete [flags] <key>")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single key")
+	}
+
+	key := flags.Arg(0)
+	kind := parameterTypeValue
+
+	if *secret {
+		kind = parameterTypeSecret
+	}
+
+	if err := opts.client().doJSON(http.MethodDelete, "/global-parameters/"+url.PathEscape(key)+"?type="+kind, nil, nil, nil); err != nil {
+		return fmt.Errorf("unable to delete %s: %w", key, err)
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(stdout, map[string]any{"key": key, "type": kind})
+	}
+
+	_, err := fmt.Fprintf(stdout, "Deleted %s %s\n", kind, key)
+
+	return err
+}
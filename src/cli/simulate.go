@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mqtt-http-bridge/src/config"
+	"net/http"
+	"strings"
+)
+
+// keyValueList collects key=value pairs of a flag that can be given more than once.
+type keyValueList map[string]string
+
+func (l keyValueList) String() string {
+	pairs := make([]string, 0, len(l))
+
+	for key, value := range l {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (l keyValueList) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+
+	if !ok {
+		return fmt.Errorf("expected key=value, got %s", value)
+	}
+
+	l[key] = val
+
+	return nil
+}
+
+type simulation struct {
+	SubscriptionID   string `json:"subscriptionId"`
+	SubscriptionName string `json:"subscriptionName"`
+	Delivered        bool   `json:"delivered"`
+	Reason           string `json:"reason,omitempty"`
+	Errors           []struct {
+		Stage string `json:"stage"`
+		Error string `json:"error"`
+	} `json:"errors"`
+	Request *struct {
+		Method       string            `json:"method"`
+		URL          string            `json:"url"`
+		Headers      map[string]string `json:"headers"`
+		Body         string            `json:"body"`
+		BodyEncoding string            `json:"bodyEncoding,omitempty"`
+	} `json:"request,omitempty"`
+}
+
+func runSimulate(cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+	server := flags.String("broker", "", "broker the message appears to come from, defaults to the internal broker")
+	retain := flags.Bool("retain", false, "simulate a retained message")
+	userProperties := keyValueList{}
+
+	flags.Var(userProperties, "property", "MQTT v5 user property as key=value, can be given more than once")
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: simulate [flags] <topic> [payload, or - for stdin]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return fmt.Errorf("expected a topic and an optional payload")
+	}
+
+	payload := flags.Arg(1)
+
+	if payload == "-" {
+		data, err := io.ReadAll(stdin)
+
+		if err != nil {
+			return fmt.Errorf("unable to read payload: %w", err)
+		}
+
+		payload = string(data)
+	}
+
+	request := map[string]any{
+		"server":         *server,
+		"topic":          flags.Arg(0),
+		"payload":        payload,
+		"retain":         *retain,
+		"userProperties": userProperties,
+	}
+
+	var response struct {
+		Results []json.RawMessage `json:"results"`
+	}
+
+	if err := opts.client().doJSON(http.MethodPost, "/simulate", request, &response, nil); err != nil {
+		return fmt.Errorf("unable to simulate message: %w", err)
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(stdout, response.Results)
+	}
+
+	rows := make([][]string, 0, len(response.Results))
+
+	for _, raw := range response.Results {
+		var result simulation
+
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return fmt.Errorf("unable to decode simulation: %w", err)
+		}
+
+		outcome, request := "delivered", ""
+
+		if !result.Delivered {
+			outcome = "skipped: " + result.Reason
+		} else if result.Request != nil {
+			request = result.Request.Method + " " + result.Request.URL
+		}
+
+		errs := make([]string, 0, len(result.Errors))
+
+		for _, err := range result.Errors {
+			errs = append(errs, err.Stage+": "+err.Error)
+		}
+
+		rows = append(rows, []string{result.SubscriptionID, result.SubscriptionName, outcome, request, strings.Join(errs, "; ")})
+	}
+
+	return writeTable(stdout, []string{"ID", "NAME", "OUTCOME", "REQUEST", "ERRORS"}, rows)
+}
@@ -0,0 +1,350 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"mqtt-http-bridge/src/config"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var subscriptionCommands = []command{
+	{name: "list", description: "List the subscriptions", run: runListSubscriptions},
+	{name: "get", description: "Show a subscription", run: runGetSubscription},
+	{name: "add", description: "Add the subscriptions in YAML or JSON files", run: runAddSubscriptions},
+	{name: "update", description: "Replace a subscription with the one in a YAML or JSON file", run: runUpdateSubscription},
+	{name: "delete", description: "Delete subscriptions", run: runDeleteSubscriptions},
+}
+
+func runSubscriptions(cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error {
+	return runSubcommand(subscriptionCommands, cfg, args, stdin, stdout)
+}
+
+// subscriptionRow holds the fields of a subscription shown in tables.
+type subscriptionRow struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Topic       string   `json:"topic"`
+	Method      string   `json:"method"`
+	URL         string   `json:"url"`
+	Enabled     bool     `json:"enabled"`
+	Tags        []string `json:"tags"`
+	BlueprintID string   `json:"blueprintId"`
+}
+
+func writeSubscriptions(w io.Writer, output string, subscriptions []json.RawMessage) error {
+	if output == outputJSON {
+		return writeJSON(w, subscriptions)
+	}
+
+	rows := make([][]string, 0, len(subscriptions))
+
+	for _, raw := range subscriptions {
+		var sub subscriptionRow
+
+		if err := json.Unmarshal(raw, &sub); err != nil {
+			return fmt.Errorf("unable to decode subscription: %w", err)
+		}
+
+		rows = append(rows, []string{sub.ID, sub.Name, sub.Topic, sub.Method, sub.URL, strconv.FormatBool(sub.Enabled), strings.Join(sub.Tags, ","), sub.BlueprintID})
+	}
+
+	return writeTable(w, []string{"ID", "NAME", "TOPIC", "METHOD", "URL", "ENABLED", "TAGS", "BLUEPRINT"}, rows)
+}
+
+// stringList collects the values of a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runListSubscriptions(cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("subscriptions list", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+
+	var tags stringList
+
+	flags.Var(&tags, "tag", "only subscriptions with this tag, can be given more than once")
+	group := flags.String("group", "", "only subscriptions in this group")
+	topicPrefix := flags.String("topic-prefix", "", "only subscriptions whose topic starts with this prefix")
+	host := flags.String("host", "", "only subscriptions sending to this host")
+	enabled := flags.String("enabled", "", "only enabled (true) or disabled (false) subscriptions")
+	search := flags.String("search", "", "only subscriptions whose ID, name, topic or URL contain this text")
+	blueprintID := flags.String("blueprint", "", "only instances of this blueprint")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+
+	for key, value := range map[string]string{"group": *group, "topicPrefix": *topicPrefix, "host": *host, "enabled": *enabled, "q": *search, "blueprintId": *blueprintID} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	var response struct {
+		Subscriptions []json.RawMessage `json:"subscriptions"`
+	}
+
+	if err := opts.client().doJSON(http.MethodGet, "/subscriptions?"+query.Encode(), nil, &response, nil); err != nil {
+		return fmt.Errorf("unable to list subscriptions: %w", err)
+	}
+
+	return writeSubscriptions(stdout, opts.output, response.Subscriptions)
+}
+
+func runGetSubscription(cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("subscriptions get", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: subscriptions get [flags] <id>")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a single subscription ID")
+	}
+
+	var response struct {
+		Subscription json.RawMessage `json:"subscription"`
+	}
+
+	if err := opts.client().doJSON(http.MethodGet, "/subscriptions/"+url.PathEscape(flags.Arg(0)), nil, &response, nil); err != nil {
+		return fmt.Errorf("unable to get subscription: %w", err)
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(stdout, response.Subscription)
+	}
+
+	return writeSubscriptions(stdout, opts.output, []json.RawMessage{response.Subscription})
+}
+
+func runAddSubscriptions(cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("subscriptions add", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: subscriptions add [flags] <file, or - for stdin>...")
+		_, _ = fmt.Fprintln(flags.Output(), "Each file contains a subscription as accepted by the API, or a list of them.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("expected at least one file")
+	}
+
+	var documents []any
+
+	for _, path := range flags.Args() {
+		docs, err := readDocuments(path, stdin)
+
+		if err != nil {
+			return err
+		}
+
+		documents = append(documents, docs...)
+	}
+
+	client := opts.client()
+	added := make([]json.RawMessage, 0, len(documents))
+
+	for i, doc := range documents {
+		var response struct {
+			Subscription json.RawMessage `json:"subscription"`
+		}
+
+		if err := client.doJSON(http.MethodPost, "/subscriptions", doc, &response, nil); err != nil {
+			// Report what was added so far, so the remaining subscriptions can be retried.
+			if len(added) > 0 {
+				_ = writeSubscriptions(stdout, opts.output, added)
+			}
+
+			return fmt.Errorf("unable to add subscription %d: %w", i+1, err)
+		}
+
+		added = append(added, response.Subscription)
+	}
+
+	return writeSubscriptions(stdout, opts.output, added)
+}
+
+func runUpdateSubscription(cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("subscriptions update", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+	version := flags.Int("version", 0, "only update if the subscription is still at this version, any version when omitted")
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: subscriptions update [flags] <id> <file, or - for stdin>")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected a subscription ID and a file")
+	}
+
+	documents, err := readDocuments(flags.Arg(1), stdin)
+
+	if err != nil {
+		return err
+	}
+
+	if len(documents) != 1 {
+		return fmt.Errorf("expected a single subscription in %s", flags.Arg(1))
+	}
+
+	var response struct {
+		Subscription json.RawMessage `json:"subscription"`
+	}
+
+	if err := opts.client().doJSON(http.MethodPut, "/subscriptions/"+url.PathEscape(flags.Arg(0)), documents[0], &response, ifMatch(*version)); err != nil {
+		return fmt.Errorf("unable to update subscription: %w", err)
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(stdout, response.Subscription)
+	}
+
+	return writeSubscriptions(stdout, opts.output, []json.RawMessage{response.Subscription})
+}
+
+func runDeleteSubscriptions(cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("subscriptions delete", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+	version := flags.Int("version", 0, "only delete if the subscription is still at this version, any version when omitted")
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: subscriptions delete [flags] <id>...")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("expected at least one subscription ID")
+	}
+
+	client := opts.client()
+	deleted := make([]string, 0, flags.NArg())
+
+	for _, id := range flags.Args() {
+		if err := client.doJSON(http.MethodDelete, "/subscriptions/"+url.PathEscape(id), nil, nil, ifMatch(*version)); err != nil {
+			if opts.output == outputJSON {
+				_ = writeJSON(stdout, map[string]any{"deleted": deleted})
+			}
+
+			return fmt.Errorf("unable to delete subscription %s: %w", id, err)
+		}
+
+		deleted = append(deleted, id)
+
+		if opts.output == outputTable {
+			_, _ = fmt.Fprintf(stdout, "Deleted %s\n", id)
+		}
+	}
+
+	if opts.output == outputJSON {
+		return writeJSON(stdout, map[string]any{"deleted": deleted})
+	}
+
+	return nil
+}
+
+// ifMatch returns the If-Match header for the version, which matches any version when it's 0.
+func ifMatch(version int) http.Header {
+	if version == 0 {
+		return http.Header{"If-Match": {"*"}}
+	}
+
+	return http.Header{"If-Match": {fmt.Sprintf(`"%d"`, version)}}
+}
+
+// readDocuments reads the YAML or JSON file, and returns the documents in it. A file containing a list returns its
+// items.
+func readDocuments(path string, stdin io.Reader) ([]any, error) {
+	var data []byte
+	var err error
+
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	var document any
+
+	// JSON is a subset of YAML, so both are decoded the same way.
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %w", path, err)
+	}
+
+	switch doc := document.(type) {
+	case []any:
+		return doc, nil
+	case map[string]any:
+		return []any{doc}, nil
+	default:
+		return nil, fmt.Errorf("%s doesn't contain a subscription", path)
+	}
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// request is what the API received from a command.
+type request struct {
+	method  string
+	uri     string
+	ifMatch string
+}
+
+func TestRunSubscriptions(t *testing.T) {
+	lights := `{"id":"lights","name":"Lights","topic":"home/lights","method":"POST","url":"https://example.com","enabled":true,"tags":["home","lights"]}`
+	lightsTable := "ID      NAME    TOPIC        METHOD  URL                  ENABLED  TAGS         BLUEPRINT\nlights  Lights  home/lights  POST    https://example.com  true     home,lights  \n"
+
+	tests := []struct {
+		name     string
+		args     []string
+		status   int
+		response string
+		requests []request
+		output   string
+		err      string
+	}{
+		{
+			name:     "list with filters",
+			args:     []string{"list", "--tag", "home", "--tag", "lights", "--enabled", "true"},
+			response: `{"subscriptions":[` + lights + `]}`,
+			requests: []request{{method: http.MethodGet, uri: "/api/v1/subscriptions?enabled=true&tag=home&tag=lights"}},
+			output:   lightsTable,
+		},
+		{
+			name:     "list as json",
+			args:     []string{"list", "--output", "json"},
+			response: `{"subscriptions":[{"id":"lights"}]}`,
+			requests: []request{{method: http.MethodGet, uri: "/api/v1/subscriptions?"}},
+			output:   "[\n  {\n    \"id\": \"lights\"\n  }\n]\n",
+		},
+		{name: "unknown output format", args: []string{"list", "--output", "xml"}, err: "unknown output format xml"},
+		{
+			name:     "get",
+			args:     []string{"get", "lights"},
+			response: `{"subscription":` + lights + `}`,
+			requests: []request{{method: http.MethodGet, uri: "/api/v1/subscriptions/lights"}},
+			output:   lightsTable,
+		},
+		{name: "get without ID", args: []string{"get"}, err: "expected a single subscription ID"},
+		{
+			name:     "get unknown subscription",
+			args:     []string{"get", "unknown"},
+			status:   http.StatusNotFound,
+			response: `{"error":"subscription not found"}`,
+			requests: []request{{method: http.MethodGet, uri: "/api/v1/subscriptions/unknown"}},
+			err:      "unable to get subscription: subscription not found (404)",
+		},
+		{
+			name: "delete at a version",
+			args: []string{"delete", "--version", "3", "lights", "heating"},
+			requests: []request{
+				{method: http.MethodDelete, uri: "/api/v1/subscriptions/lights", ifMatch: `"3"`},
+				{method: http.MethodDelete, uri: "/api/v1/subscriptions/heating", ifMatch: `"3"`},
+			},
+			output: "Deleted lights\nDeleted heating\n",
+		},
+		{
+			name:     "delete stops at the first error",
+			args:     []string{"delete", "--output", "json", "lights"},
+			status:   http.StatusPreconditionFailed,
+			response: `{"error":["version mismatch"]}`,
+			requests: []request{{method: http.MethodDelete, uri: "/api/v1/subscriptions/lights", ifMatch: "*"}},
+			output:   "{\n  \"deleted\": []\n}\n",
+			err:      "unable to delete subscription lights: version mismatch (412)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []request
+
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, request{method: r.Method, uri: r.RequestURI, ifMatch: r.Header.Get("If-Match")})
+
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer api.Close()
+
+			var stdout bytes.Buffer
+
+			args := append([]string{tt.args[0], "--server", api.URL}, tt.args[1:]...)
+			err := runSubscriptions(&config.Config{}, args, nil, &stdout)
+
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.err)
+			}
+
+			assert.Equal(t, tt.requests, requests)
+			assert.Equal(t, tt.output, stdout.String())
+		})
+	}
+
+	t.Run("unknown subcommand", func(t *testing.T) {
+		err := runSubscriptions(&config.Config{}, []string{"rename", "lights"}, nil, &bytes.Buffer{})
+
+		assert.ErrorIs(t, err, ErrUnknownCommand)
+		assert.ErrorContains(t, err, "unknown command: rename lights\n\nAvailable commands:\n")
+	})
+}
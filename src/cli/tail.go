@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"mqtt-http-bridge/src/config"
+	"strings"
+)
+
+type socketMessage struct {
+	Server          string `json:"server"`
+	Topic           string `json:"topic"`
+	Payload         string `json:"payload"`
+	PayloadEncoding string `json:"payloadEncoding"`
+	Retain          bool   `json:"retain"`
+	Timestamp       string `json:"timestamp"`
+}
+
+// runTail prints the messages of the MQTT log websocket until the connection closes. The bridge sends its recent
+// history first.
+func runTail(cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	opts := addClientFlags(flags, cfg)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	client := opts.client()
+	socketURL := "ws" + strings.TrimPrefix(client.baseURL, "http") + "/mqtt-socket"
+	conn, _, err := websocket.DefaultDialer.Dial(socketURL, client.authHeader())
+
+	if err != nil {
+		return fmt.Errorf("unable to connect to %s: %w", socketURL, err)
+	}
+
+	defer conn.Close()
+
+	for {
+		_, data, err := conn.ReadMessage()
+
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("connection lost: %w", err)
+		}
+
+		if opts.output == outputJSON {
+			_, _ = fmt.Fprintf(stdout, "%s\n", data)
+			continue
+		}
+
+		var message socketMessage
+
+		if err := json.Unmarshal(data, &message); err != nil {
+			continue
+		}
+
+		details := ""
+
+		if message.Retain {
+			details = " (retained)"
+		}
+
+		if message.PayloadEncoding != "" {
+			details += " (" + message.PayloadEncoding + ")"
+		}
+
+		_, _ = fmt.Fprintf(stdout, "%s  %s  %s%s  %s\n", message.Timestamp, message.Server, message.Topic, details, message.Payload)
+	}
+}
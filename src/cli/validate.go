@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"mqtt-http-bridge/src/config"
+)
+
+func runValidateConfig(_ *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(flags.Output(), "Usage: validate-config [file]")
+		_, _ = fmt.Fprintln(flags.Output(), "Checks the file in CONFIG_FILE when none is given, environment variables are applied as usual.")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected at most one file")
+	}
+
+	path := config.File()
+
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	if _, err := config.LoadFile(path); err != nil {
+		problems := []error{err}
+
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			problems = joined.Unwrap()
+		}
+
+		for _, problem := range problems {
+			_, _ = fmt.Fprintf(stdout, "- %s\n", problem)
+		}
+
+		return fmt.Errorf("%s is invalid, found %d problem(s)", path, len(problems))
+	}
+
+	_, _ = fmt.Fprintf(stdout, "%s is valid\n", path)
+
+	return nil
+}
@@ -3,12 +3,17 @@ package config
 import (
 	"errors"
 	"fmt"
-	"github.com/kelseyhightower/envconfig"
 	"github.com/mitchellh/mapstructure"
 	"gopkg.in/yaml.v3"
+	"io"
+	"maps"
 	"mqtt-http-bridge/src/processor"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
 	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -19,8 +24,14 @@ type Config struct {
 
 	Broker          BrokerConfig                    `yaml:"broker"`
 	ExternalBrokers map[string]ExternalBrokerConfig `yaml:"external-brokers"`
-	Server          ServerConfig                    `yaml:"server"`
-	Storage         StorageConfig                   `yaml:"storage"`
+	// GlobalParameters declares read-only global parameters, the value is either a literal, or a source prefixed with
+	// value:, env: (environment variable) or file: (e.g. a Docker secret)
+	GlobalParameters map[string]string `yaml:"global-parameters"`
+	Publisher        PublisherConfig   `yaml:"publisher"`
+	Server           ServerConfig      `yaml:"server"`
+	Storage          StorageConfig     `yaml:"storage"`
+	Secrets          SecretsConfig     `yaml:"secrets"`
+	Templates        TemplatesConfig   `yaml:"templates"`
 
 	// Internal Options
 	Silent bool
@@ -31,6 +42,35 @@ type BrokerConfig struct {
 	Port     int          `yaml:"port" default:"1883"`
 	OpenAuth bool         `yaml:"open-auth" default:"false"`
 	Users    []BrokerUser `yaml:"users" default:""`
+
+	TLS        BrokerTLSConfig        `yaml:"tls"`
+	WebSocket  BrokerWebSocketConfig  `yaml:"websocket"`
+	UnixSocket BrokerUnixSocketConfig `yaml:"unix-socket"`
+}
+
+type BrokerTLSConfig struct {
+	Enabled  bool   `yaml:"enabled" default:"false"`
+	Address  string `yaml:"bind-address"`
+	Port     int    `yaml:"port" default:"8883"`
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+	// ClientCAFile enables client certificate verification against the given CA bundle
+	ClientCAFile string `yaml:"client-ca-file"`
+	// RequireClientCert rejects clients that do not present a certificate, requires ClientCAFile
+	RequireClientCert bool `yaml:"require-client-cert" default:"false"`
+}
+
+type BrokerWebSocketConfig struct {
+	Enabled bool   `yaml:"enabled" default:"false"`
+	Address string `yaml:"bind-address"`
+	Port    int    `yaml:"port" default:"8083"`
+	// TLS serves the websocket listener using the certificate configured for the TLS listener
+	TLS bool `yaml:"tls" default:"false"`
+}
+
+type BrokerUnixSocketConfig struct {
+	Enabled bool   `yaml:"enabled" default:"false"`
+	Path    string `yaml:"path"`
 }
 
 type BrokerUser struct {
@@ -39,12 +79,71 @@ type BrokerUser struct {
 }
 
 type ExternalBrokerConfig struct {
-	Name     string   `yaml:"name"`
-	ClientID string   `yaml:"client-id"`
-	Host     string   `yaml:"host"`
-	Username string   `yaml:"username"`
-	Password string   `yaml:"password"`
-	Topics   []string `yaml:"topics"`
+	Name     string                `yaml:"name"`
+	ClientID string                `yaml:"client-id"`
+	Host     string                `yaml:"host"`
+	Username string                `yaml:"username"`
+	Password string                `yaml:"password"`
+	Topics   []ExternalBrokerTopic `yaml:"topics"`
+
+	// QoS is the default quality of service level for topics that don't specify their own
+	QoS byte `yaml:"qos" default:"0"`
+	// PersistentSession disables the clean session flag, so the external broker keeps the subscriptions and queues
+	// QoS 1/2 messages while the bridge is offline. Requires a stable client ID.
+	PersistentSession bool `yaml:"persistent-session" default:"false"`
+	// KeepAlive is the keepalive interval in seconds
+	KeepAlive int `yaml:"keepalive" default:"30"`
+
+	// StatusTopic is the topic the bridge publishes its online/offline status to, the offline status is registered as
+	// last will so the external broker publishes it when the connection drops unexpectedly.
+	StatusTopic          string `yaml:"status-topic"`
+	StatusOnlinePayload  string `yaml:"status-online-payload" default:"online"`
+	StatusOfflinePayload string `yaml:"status-offline-payload" default:"offline"`
+}
+
+type ExternalBrokerTopic struct {
+	Topic string `yaml:"topic"`
+	// QoS overrides the default quality of service level of the broker for this topic
+	QoS *byte `yaml:"qos"`
+}
+
+// UnmarshalYAML allows topics to be configured as a plain string, or as a mapping with a topic and QoS level.
+func (t *ExternalBrokerTopic) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&t.Topic)
+	}
+
+	// Decoding the node doesn't inherit the strictness of the decoder, so unknown keys are rejected here.
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i < len(value.Content); i += 2 {
+			if key := value.Content[i]; key.Value != "topic" && key.Value != "qos" {
+				return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: field %s not found in type config.ExternalBrokerTopic", key.Line, key.Value)}}
+			}
+		}
+	}
+
+	type plain ExternalBrokerTopic
+
+	return value.Decode((*plain)(t))
+}
+
+func (b ExternalBrokerConfig) TopicQoS(topic ExternalBrokerTopic) byte {
+	if topic.QoS != nil {
+		return *topic.QoS
+	}
+
+	return b.QoS
+}
+
+type PublisherConfig struct {
+	// Parallel is the number of requests to subscriptions that are sent at the same time
+	Parallel int `yaml:"parallel" default:"10"`
+	// DrainTimeout is the number of seconds queued requests get to be sent when shutting down
+	DrainTimeout int `yaml:"drain-timeout" default:"10"`
+	// PendingFile keeps the requests that weren't sent before shutting down, they are sent after the next start. When
+	// empty, those requests are lost. The file is encrypted with the secrets key, without one requests containing
+	// secrets aren't kept.
+	PendingFile string `yaml:"pending-file"`
 }
 
 type ServerConfig struct {
@@ -52,7 +151,17 @@ type ServerConfig struct {
 	Port    int    `yaml:"port" default:"8080"`
 }
 
-var supportedStorageDrivers = []string{"memory", "file"}
+type SecretsConfig struct {
+	// Key is used to encrypt secret global parameters at rest, preferably set using the SECRETS_KEY environment variable
+	Key string `yaml:"key" envconfig:"KEY"`
+}
+
+type TemplatesConfig struct {
+	// EnvAllowList contains the environment variables that can be read in templates using the env function
+	EnvAllowList []string `yaml:"env-allow-list"`
+}
+
+var supportedStorageDrivers = []string{"memory", "file", "yaml"}
 
 type StorageConfig struct {
 	Driver  string                 `yaml:"driver"`
@@ -61,6 +170,20 @@ type StorageConfig struct {
 
 type StorageConfigFile struct {
 	File string `yaml:"file"`
+	// Backups is the number of previous versions of the file that are kept, defaults to 3. Backups are made at most
+	// once a minute, so they contain the state from before a burst of changes.
+	Backups int `yaml:"backups"`
+}
+
+type StorageConfigYAML struct {
+	// Directory contains a YAML file per subscription, and optionally a global-parameters.yaml file
+	Directory string `yaml:"directory"`
+	// Overlay is the driver (memory/file) for subscriptions and parameters managed through the API, when empty
+	// everything is read-only
+	Overlay string `yaml:"overlay"`
+	// File and Backups configure the overlay when it uses the file driver
+	File    string `yaml:"file"`
+	Backups int    `yaml:"backups"`
 }
 
 func (c *Config) IsDevelopment() bool {
@@ -72,56 +195,451 @@ type ParsedUser struct {
 	Password string
 }
 
+// File returns the path of the configuration file, set using the CONFIG_FILE environment variable.
+func File() string {
+	if f := os.Getenv("CONFIG_FILE"); f != "" {
+		return f
+	}
+
+	return "mqtt-http.conf.yaml"
+}
+
 func Load() (*Config, error) {
-	var cfg Config
+	return LoadFile(File())
+}
 
-	confFile := "mqtt-http.conf.yaml"
+// LoadFile reads the configuration file, applies the defaults and environment variables, and validates the result. All
+// problems found are returned joined, so they can be fixed at once.
+func LoadFile(path string) (*Config, error) {
+	var cfg Config
 
-	if f := os.Getenv("CONFIG_FILE"); f != "" {
-		confFile = f
+	if err := applyDefaults(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return nil, err
 	}
 
-	fileContents, err := os.ReadFile(confFile)
+	file, err := os.Open(path)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if err := yaml.Unmarshal(fileContents, &cfg); err != nil {
-		return nil, err
+	defer file.Close()
+
+	var errs []error
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+
+		// Unknown keys and mismatched types don't stop the decoding, so the rest of the file can still be validated.
+		if !errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("unable to decode %s: %w", path, err)
+		}
+
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, errors.New(msg))
+		}
 	}
 
-	if err := envconfig.Process("", &cfg); err != nil {
-		return nil, err
+	errs = append(errs, applyEnvironment(reflect.ValueOf(&cfg).Elem(), "")...)
+	errs = append(errs, cfg.validate()...)
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 
-	if !cfg.Broker.OpenAuth {
-		for idx, user := range cfg.Broker.Users {
+	return &cfg, nil
+}
+
+func (c *Config) validate() []error {
+	var errs []error
+
+	if !c.Broker.OpenAuth {
+		for idx, user := range c.Broker.Users {
 			username := strings.TrimSpace(user.Username)
 			password := strings.TrimSpace(user.Password)
 
 			if username == "" || password == "" {
-				return nil, fmt.Errorf("invalid user configured for built-in broker at index #%d", idx)
+				errs = append(errs, fmt.Errorf("invalid user configured for built-in broker at index #%d", idx))
 			}
 
-			cfg.Broker.Users[idx].Username = username
-			cfg.Broker.Users[idx].Password = password
+			c.Broker.Users[idx].Username = username
+			c.Broker.Users[idx].Password = password
 		}
 
-		if len(cfg.Broker.Users) == 0 {
-			return nil, errors.New("no users defined")
+		if len(c.Broker.Users) == 0 {
+			errs = append(errs, errors.New("no users defined"))
 		}
 	}
 
-	if !slices.Contains(supportedStorageDrivers, cfg.Storage.Driver) {
-		return nil, fmt.Errorf("invalid storage driver: %s (should be one of %s)", cfg.Storage.Driver, strings.Join(supportedStorageDrivers, "/"))
+	errs = append(errs, c.Broker.prepareListeners()...)
+
+	if err := validateAddress(c.Server.Address); err != nil {
+		errs = append(errs, fmt.Errorf("server: %w", err))
 	}
 
-	if _, ok := cfg.ExternalBrokers[processor.InternalBroker]; ok {
-		return nil, fmt.Errorf("the name %s cannot be used for an external broker", processor.InternalBroker)
+	if err := validatePort(c.Server.Port); err != nil {
+		errs = append(errs, fmt.Errorf("server: %w", err))
 	}
 
-	return &cfg, nil
+	errs = append(errs, c.validateListenerPorts()...)
+
+	if c.Publisher.Parallel < 1 {
+		errs = append(errs, fmt.Errorf("publisher: parallel must be at least 1, got %d", c.Publisher.Parallel))
+	}
+
+	if c.Publisher.DrainTimeout < 0 {
+		errs = append(errs, fmt.Errorf("publisher: drain-timeout can't be negative, got %d", c.Publisher.DrainTimeout))
+	}
+
+	switch c.Storage.Driver {
+	case "file":
+		if _, err := c.StorageConfigFile(); err != nil {
+			errs = append(errs, err)
+		}
+	case "yaml":
+		if _, err := c.StorageConfigYAML(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if !slices.Contains(supportedStorageDrivers, c.Storage.Driver) {
+		errs = append(errs, fmt.Errorf("invalid storage driver: %s (should be one of %s)", c.Storage.Driver, strings.Join(supportedStorageDrivers, "/")))
+	}
+
+	if _, ok := c.ExternalBrokers[processor.InternalBroker]; ok {
+		errs = append(errs, fmt.Errorf("the name %s cannot be used for an external broker", processor.InternalBroker))
+	}
+
+	names := slices.Sorted(maps.Keys(c.ExternalBrokers))
+
+	for _, name := range names {
+		broker := c.ExternalBrokers[name]
+
+		for _, err := range broker.prepare() {
+			errs = append(errs, fmt.Errorf("invalid configuration for external broker %s: %w", name, err))
+		}
+
+		c.ExternalBrokers[name] = broker
+	}
+
+	return errs
+}
+
+// validateListenerPorts reports listeners configured on the same port, which would fail to start.
+func (c *Config) validateListenerPorts() []error {
+	var errs []error
+
+	listeners := []struct {
+		name    string
+		enabled bool
+		port    int
+	}{
+		{"server", true, c.Server.Port},
+		{"broker", true, c.Broker.Port},
+		{"broker tls", c.Broker.TLS.Enabled, c.Broker.TLS.Port},
+		{"broker websocket", c.Broker.WebSocket.Enabled, c.Broker.WebSocket.Port},
+	}
+
+	used := make(map[int]string)
+
+	for _, l := range listeners {
+		// Invalid ports are already reported on their own.
+		if !l.enabled || validatePort(l.port) != nil {
+			continue
+		}
+
+		if other, ok := used[l.port]; ok {
+			errs = append(errs, fmt.Errorf("%s and %s listeners both use port %d", other, l.name, l.port))
+			continue
+		}
+
+		used[l.port] = l.name
+	}
+
+	return errs
+}
+
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %d (should be between 1 and 65535)", port)
+	}
+
+	return nil
+}
+
+// validateAddress accepts an IP address or hostname to bind to, where empty binds to all interfaces.
+func validateAddress(address string) error {
+	if address == "" || net.ParseIP(address) != nil || isHostname(address) {
+		return nil
+	}
+
+	return fmt.Errorf("invalid bind-address %s", address)
+}
+
+func isHostname(host string) bool {
+	if len(host) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (b *BrokerConfig) prepareListeners() []error {
+	var errs []error
+
+	if err := validateAddress(b.Address); err != nil {
+		errs = append(errs, fmt.Errorf("broker: %w", err))
+	}
+
+	if err := validatePort(b.Port); err != nil {
+		errs = append(errs, fmt.Errorf("broker: %w", err))
+	}
+
+	if b.TLS.Enabled {
+		if b.TLS.Address == "" {
+			b.TLS.Address = b.Address
+		}
+
+		if err := validateAddress(b.TLS.Address); err != nil {
+			errs = append(errs, fmt.Errorf("broker tls: %w", err))
+		}
+
+		if err := validatePort(b.TLS.Port); err != nil {
+			errs = append(errs, fmt.Errorf("broker tls: %w", err))
+		}
+
+		if b.TLS.CertFile == "" || b.TLS.KeyFile == "" {
+			errs = append(errs, errors.New("tls listener requires both cert-file and key-file"))
+		}
+
+		if b.TLS.RequireClientCert && b.TLS.ClientCAFile == "" {
+			errs = append(errs, errors.New("tls listener requires client-ca-file when require-client-cert is enabled"))
+		}
+	}
+
+	if b.WebSocket.Enabled {
+		if b.WebSocket.Address == "" {
+			b.WebSocket.Address = b.Address
+		}
+
+		if err := validateAddress(b.WebSocket.Address); err != nil {
+			errs = append(errs, fmt.Errorf("broker websocket: %w", err))
+		}
+
+		if err := validatePort(b.WebSocket.Port); err != nil {
+			errs = append(errs, fmt.Errorf("broker websocket: %w", err))
+		}
+
+		if b.WebSocket.TLS && (b.TLS.CertFile == "" || b.TLS.KeyFile == "") {
+			errs = append(errs, errors.New("websocket listener with tls requires cert-file and key-file in the tls listener config"))
+		}
+	}
+
+	if b.UnixSocket.Enabled && strings.TrimSpace(b.UnixSocket.Path) == "" {
+		errs = append(errs, errors.New("unix socket listener requires a path"))
+	}
+
+	return errs
+}
+
+// supportedBrokerSchemes are the schemes the MQTT client can connect with, tcp is used when the host has none.
+var supportedBrokerSchemes = []string{"tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss"}
+
+func validateBrokerHost(host string) error {
+	if strings.TrimSpace(host) == "" {
+		return errors.New("host is required")
+	}
+
+	if !strings.Contains(host, "://") {
+		host = "tcp://" + host
+	}
+
+	u, err := url.Parse(host)
+
+	if err != nil {
+		return fmt.Errorf("invalid host: %w", err)
+	}
+
+	if !slices.Contains(supportedBrokerSchemes, u.Scheme) {
+		return fmt.Errorf("invalid host scheme %s (should be one of %s)", u.Scheme, strings.Join(supportedBrokerSchemes, "/"))
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("invalid host %s, the hostname is missing", host)
+	}
+
+	if port := u.Port(); port != "" {
+		n, err := strconv.Atoi(port)
+
+		if err != nil {
+			return fmt.Errorf("invalid host port %s", port)
+		}
+
+		if err := validatePort(n); err != nil {
+			return fmt.Errorf("invalid host: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *ExternalBrokerConfig) prepare() []error {
+	var errs []error
+
+	if err := validateBrokerHost(b.Host); err != nil {
+		errs = append(errs, err)
+	}
+
+	if b.QoS > 2 {
+		errs = append(errs, fmt.Errorf("invalid qos %d", b.QoS))
+	}
+
+	for idx, topic := range b.Topics {
+		if strings.TrimSpace(topic.Topic) == "" {
+			errs = append(errs, fmt.Errorf("topic at index #%d is empty", idx))
+		}
+
+		if topic.QoS != nil && *topic.QoS > 2 {
+			errs = append(errs, fmt.Errorf("invalid qos %d for topic %s", *topic.QoS, topic.Topic))
+		}
+	}
+
+	if b.PersistentSession && b.ClientID == "" {
+		errs = append(errs, errors.New("a persistent session requires a client-id"))
+	}
+
+	if b.KeepAlive == 0 {
+		b.KeepAlive = 30
+	}
+
+	if b.StatusOnlinePayload == "" {
+		b.StatusOnlinePayload = "online"
+	}
+
+	if b.StatusOfflinePayload == "" {
+		b.StatusOfflinePayload = "offline"
+	}
+
+	return errs
+}
+
+// RestartRequired lists the settings that differ in the next config and can't be applied while running.
+func (c *Config) RestartRequired(next *Config) []string {
+	var settings []string
+
+	sections := []struct {
+		name          string
+		before, after any
+	}{
+		{"APP_ENV", c.AppEnv, next.AppEnv},
+		{"broker.bind-address", c.Broker.Address, next.Broker.Address},
+		{"broker.port", c.Broker.Port, next.Broker.Port},
+		{"broker.tls", c.Broker.TLS, next.Broker.TLS},
+		{"broker.websocket", c.Broker.WebSocket, next.Broker.WebSocket},
+		{"broker.unix-socket", c.Broker.UnixSocket, next.Broker.UnixSocket},
+		{"server", c.Server, next.Server},
+		{"storage", c.Storage, next.Storage},
+		{"secrets", c.Secrets, next.Secrets},
+	}
+
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.before, section.after) {
+			settings = append(settings, section.name)
+		}
+	}
+
+	return settings
+}
+
+// ResolveGlobalParameters reads the global parameters declared in the config from their sources.
+func (c *Config) ResolveGlobalParameters() (map[string]any, error) {
+	params := make(map[string]any, len(c.GlobalParameters))
+
+	for key, source := range c.GlobalParameters {
+		value, err := resolveGlobalParameter(source)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve global parameter %s: %w", key, err)
+		}
+
+		params[key] = value
+	}
+
+	return params, nil
+}
+
+func resolveGlobalParameter(source string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, "value:"):
+		return strings.TrimPrefix(source, "value:"), nil
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		value, ok := os.LookupEnv(name)
+
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return value, nil
+	case strings.HasPrefix(source, "file:"):
+		contents, err := os.ReadFile(strings.TrimPrefix(source, "file:"))
+
+		if err != nil {
+			return "", err
+		}
+
+		// Secret files commonly end with a newline, which is never intended to be part of the value.
+		return strings.TrimSpace(string(contents)), nil
+	default:
+		return source, nil
+	}
+}
+
+func (c *Config) StorageConfigYAML() (StorageConfigYAML, error) {
+	if c.Storage.Driver != "yaml" {
+		return StorageConfigYAML{}, errors.New("storage driver is not 'yaml'")
+	}
+
+	var scy StorageConfigYAML
+
+	if err := decodeStorageOptions(c.Storage.Options, &scy); err != nil {
+		return StorageConfigYAML{}, fmt.Errorf("unable to decode storage options: %w", err)
+	}
+
+	if scy.Directory == "" {
+		return StorageConfigYAML{}, errors.New("storage option directory is required for the yaml driver")
+	}
+
+	if _, ok := c.Storage.Options["backups"]; !ok {
+		scy.Backups = 3
+	}
+
+	switch scy.Overlay {
+	case "", "memory":
+	case "file":
+		if scy.File == "" {
+			return StorageConfigYAML{}, errors.New("storage option file is required for the file overlay")
+		}
+	default:
+		return StorageConfigYAML{}, fmt.Errorf("invalid storage overlay: %s (should be one of memory/file)", scy.Overlay)
+	}
+
+	return scy, nil
 }
 
 func (c *Config) StorageConfigFile() (StorageConfigFile, error) {
@@ -131,9 +649,39 @@ func (c *Config) StorageConfigFile() (StorageConfigFile, error) {
 
 	var scf StorageConfigFile
 
-	if err := mapstructure.Decode(c.Storage.Options, &scf); err != nil {
+	if err := decodeStorageOptions(c.Storage.Options, &scf); err != nil {
 		return StorageConfigFile{}, fmt.Errorf("unable to decode storage options: %w", err)
 	}
 
+	if _, ok := c.Storage.Options["backups"]; !ok {
+		scf.Backups = 3
+	}
+
+	if scf.Backups < 0 {
+		return StorageConfigFile{}, errors.New("storage option backups can't be negative")
+	}
+
 	return scf, nil
 }
+
+// decodeStorageOptions decodes the options of the storage driver, rejecting options the driver doesn't know.
+func decodeStorageOptions(options map[string]interface{}, result any) error {
+	var md mapstructure.Metadata
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{Metadata: &md, Result: result})
+
+	if err != nil {
+		return err
+	}
+
+	if err := decoder.Decode(options); err != nil {
+		return err
+	}
+
+	if len(md.Unused) > 0 {
+		slices.Sort(md.Unused)
+		return fmt.Errorf("unknown keys %s", strings.Join(md.Unused, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,348 @@
+package config
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+
+	return path
+}
+
+func problems(err error) []string {
+	var messages []string
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			messages = append(messages, e.Error())
+		}
+	}
+
+	return messages
+}
+
+func TestLoadFileAppliesDefaults(t *testing.T) {
+	cfg, err := LoadFile(writeConfig(t, `
+broker:
+  open-auth: true
+  websocket:
+    enabled: true
+server:
+  port: 9090
+storage:
+  driver: memory
+external-brokers:
+  home:
+    host: 'mqtt.example.com'
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "production", cfg.AppEnv)
+	assert.True(t, cfg.Broker.OpenAuth)
+	assert.Equal(t, "0.0.0.0", cfg.Broker.Address)
+	assert.Equal(t, 1883, cfg.Broker.Port)
+	assert.Equal(t, 8883, cfg.Broker.TLS.Port)
+	assert.Equal(t, 8083, cfg.Broker.WebSocket.Port)
+	assert.Equal(t, "0.0.0.0", cfg.Broker.WebSocket.Address)
+	assert.Equal(t, "0.0.0.0", cfg.Server.Address)
+	assert.Equal(t, 9090, cfg.Server.Port)
+	assert.Equal(t, 30, cfg.ExternalBrokers["home"].KeepAlive)
+	assert.Equal(t, "online", cfg.ExternalBrokers["home"].StatusOnlinePayload)
+}
+
+func TestLoadFileAppliesEnvironment(t *testing.T) {
+	t.Setenv("APP_ENV", "dev")
+	t.Setenv("SERVER_PORT", "9191")
+	t.Setenv("SECRETS_KEY", "from-env")
+	t.Setenv("TEMPLATES_ENVALLOWLIST", "HOME,USER")
+
+	cfg, err := LoadFile(writeConfig(t, `
+broker:
+  open-auth: true
+server:
+  port: 9090
+storage:
+  driver: memory
+secrets:
+  key: 'from-file'
+`))
+	require.NoError(t, err)
+
+	assert.True(t, cfg.IsDevelopment())
+	assert.Equal(t, 9191, cfg.Server.Port)
+	assert.Equal(t, "from-env", cfg.Secrets.Key)
+	assert.Equal(t, []string{"HOME", "USER"}, cfg.Templates.EnvAllowList)
+
+	t.Setenv("BROKER_PORT", "mqtt")
+
+	_, err = LoadFile(writeConfig(t, "broker:\n  open-auth: true\nstorage:\n  driver: memory\n"))
+	assert.ErrorContains(t, err, "invalid value for environment variable BROKER_PORT")
+}
+
+func TestLoadFileReportsAllProblems(t *testing.T) {
+	_, err := LoadFile(writeConfig(t, `
+http:
+  port: 8080
+broker:
+  bind-address: 'not an address'
+  port: 8080
+  users:
+    - username: 'test'
+      password: ''
+storage:
+  driver: file
+  options:
+    fil: 'storage.json'
+external-brokers:
+  '---internal---':
+    host: 'mqtt.example.com'
+  home:
+    host: 'ftp://mqtt.example.com'
+    topics:
+      - ''
+      - topic: 'home/#'
+        qso: 1
+  office:
+    host: 'mqtt.example.com:99999'
+`))
+	require.Error(t, err)
+
+	assert.ElementsMatch(t, []string{
+		"line 2: field http not found in type config.Config",
+		"line 22: field qso not found in type config.ExternalBrokerTopic",
+		"invalid user configured for built-in broker at index #0",
+		"broker: invalid bind-address not an address",
+		"server and broker listeners both use port 8080",
+		"unable to decode storage options: unknown keys fil",
+		"the name ---internal--- cannot be used for an external broker",
+		"invalid configuration for external broker home: invalid host scheme ftp (should be one of tcp/ssl/tls/mqtt/mqtts/ws/wss)",
+		"invalid configuration for external broker home: topic at index #0 is empty",
+		"invalid configuration for external broker office: invalid host: invalid port 99999 (should be between 1 and 65535)",
+	}, problems(err))
+}
+
+func TestLoadFileInvalidYAML(t *testing.T) {
+	_, err := LoadFile(writeConfig(t, "broker: [\n"))
+	assert.ErrorContains(t, err, "unable to decode")
+
+	_, err = LoadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestRestartRequired(t *testing.T) {
+	base := `
+broker:
+  users:
+    - username: 'test'
+      password: 'test'
+storage:
+  driver: memory
+`
+
+	current, err := LoadFile(writeConfig(t, base))
+	require.NoError(t, err)
+
+	next, err := LoadFile(writeConfig(t, base+`
+publisher:
+  parallel: 2
+external-brokers:
+  home:
+    host: 'mqtt.example.com'
+`))
+	require.NoError(t, err)
+	assert.Empty(t, current.RestartRequired(next))
+
+	next, err = LoadFile(writeConfig(t, base+`
+server:
+  port: 9090
+secrets:
+  key: 'changed'
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"server", "secrets"}, current.RestartRequired(next))
+}
+
+func TestPrepareListeners(t *testing.T) {
+	tests := []struct {
+		name             string
+		change           func(b *BrokerConfig)
+		errors           []string
+		tlsAddress       string
+		webSocketAddress string
+	}{
+		{
+			name:   "listeners are disabled by default",
+			change: func(b *BrokerConfig) {},
+		},
+		{
+			name: "addresses are inherited from the broker",
+			change: func(b *BrokerConfig) {
+				b.Address = "127.0.0.1"
+				b.TLS = BrokerTLSConfig{Enabled: true, Port: 8883, CertFile: "cert.pem", KeyFile: "key.pem"}
+				b.WebSocket = BrokerWebSocketConfig{Enabled: true, Port: 8083}
+			},
+			tlsAddress:       "127.0.0.1",
+			webSocketAddress: "127.0.0.1",
+		},
+		{
+			name: "addresses can be set per listener",
+			change: func(b *BrokerConfig) {
+				b.TLS = BrokerTLSConfig{Enabled: true, Address: "::1", Port: 8883, CertFile: "cert.pem", KeyFile: "key.pem"}
+				b.WebSocket = BrokerWebSocketConfig{Enabled: true, Address: "localhost", Port: 8083}
+			},
+			tlsAddress:       "::1",
+			webSocketAddress: "localhost",
+		},
+		{
+			name: "disabled listeners are not validated",
+			change: func(b *BrokerConfig) {
+				b.TLS = BrokerTLSConfig{Address: "not an address", Port: 0}
+				b.WebSocket = BrokerWebSocketConfig{Address: "not an address", Port: 0}
+			},
+			tlsAddress:       "not an address",
+			webSocketAddress: "not an address",
+		},
+		{
+			name: "broker",
+			change: func(b *BrokerConfig) {
+				b.Address = "not an address"
+				b.Port = 0
+			},
+			errors: []string{"broker: invalid bind-address not an address", "broker: invalid port 0 (should be between 1 and 65535)"},
+		},
+		{
+			name: "tls",
+			change: func(b *BrokerConfig) {
+				b.TLS = BrokerTLSConfig{Enabled: true, Address: "not an address", Port: 70000, CertFile: "cert.pem", RequireClientCert: true}
+			},
+			errors: []string{
+				"broker tls: invalid bind-address not an address",
+				"broker tls: invalid port 70000 (should be between 1 and 65535)",
+				"tls listener requires both cert-file and key-file",
+				"tls listener requires client-ca-file when require-client-cert is enabled",
+			},
+			tlsAddress: "not an address",
+		},
+		{
+			name: "tls with an invalid broker address",
+			change: func(b *BrokerConfig) {
+				b.Address = "not an address"
+				b.TLS = BrokerTLSConfig{Enabled: true, Port: 8883, CertFile: "cert.pem", KeyFile: "key.pem"}
+			},
+			errors:     []string{"broker: invalid bind-address not an address", "broker tls: invalid bind-address not an address"},
+			tlsAddress: "not an address",
+		},
+		{
+			name: "websocket",
+			change: func(b *BrokerConfig) {
+				b.WebSocket = BrokerWebSocketConfig{Enabled: true, Address: "not an address", Port: -1, TLS: true}
+			},
+			errors: []string{
+				"broker websocket: invalid bind-address not an address",
+				"broker websocket: invalid port -1 (should be between 1 and 65535)",
+				"websocket listener with tls requires cert-file and key-file in the tls listener config",
+			},
+			webSocketAddress: "not an address",
+		},
+		{
+			name: "websocket with tls uses the certificate of the tls listener",
+			change: func(b *BrokerConfig) {
+				b.TLS = BrokerTLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"}
+				b.WebSocket = BrokerWebSocketConfig{Enabled: true, Port: 8083, TLS: true}
+			},
+			webSocketAddress: "0.0.0.0",
+		},
+		{
+			name: "unix socket",
+			change: func(b *BrokerConfig) {
+				b.UnixSocket = BrokerUnixSocketConfig{Enabled: true, Path: " "}
+			},
+			errors: []string{"unix socket listener requires a path"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := BrokerConfig{Address: "0.0.0.0", Port: 1883}
+			tt.change(&broker)
+
+			var messages []string
+
+			for _, err := range broker.prepareListeners() {
+				messages = append(messages, err.Error())
+			}
+
+			assert.Equal(t, tt.errors, messages)
+			assert.Equal(t, tt.tlsAddress, broker.TLS.Address)
+			assert.Equal(t, tt.webSocketAddress, broker.WebSocket.Address)
+		})
+	}
+}
+
+func TestValidateListenerPorts(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		errors []string
+	}{
+		{
+			name:   "distinct ports",
+			change: func(c *Config) {},
+		},
+		{
+			name: "disabled listeners are ignored",
+			change: func(c *Config) {
+				c.Broker.TLS.Port = 1883
+				c.Broker.WebSocket.Port = 8080
+			},
+		},
+		{
+			name: "invalid ports are ignored",
+			change: func(c *Config) {
+				c.Server.Port = 0
+				c.Broker.Port = 0
+			},
+		},
+		{
+			name: "conflicting listeners",
+			change: func(c *Config) {
+				c.Broker.TLS.Enabled = true
+				c.Broker.TLS.Port = 1883
+				c.Broker.WebSocket.Enabled = true
+				c.Broker.WebSocket.Port = 8080
+			},
+			errors: []string{"broker and broker tls listeners both use port 1883", "server and broker websocket listeners both use port 8080"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Server: ServerConfig{Port: 8080},
+				Broker: BrokerConfig{
+					Port:      1883,
+					TLS:       BrokerTLSConfig{Port: 8883},
+					WebSocket: BrokerWebSocketConfig{Port: 8083},
+				},
+			}
+			tt.change(&cfg)
+
+			var messages []string
+
+			for _, err := range cfg.validateListenerPorts() {
+				messages = append(messages, err.Error())
+			}
+
+			assert.Equal(t, tt.errors, messages)
+		})
+	}
+}
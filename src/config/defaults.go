@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// applyDefaults sets the fields of the struct to the value in their default tag, before the configuration file is
+// decoded on top of it. Defaults of structs in maps and slices are applied when they are prepared.
+func applyDefaults(v reflect.Value) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+
+		if value.Kind() == reflect.Struct {
+			if err := applyDefaults(value); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if def := field.Tag.Get("default"); def != "" {
+			if err := setValue(value, def); err != nil {
+				return fmt.Errorf("invalid default for %s: %w", field.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyEnvironment overrides the fields of the struct with the environment variables named after them, e.g.
+// BROKER_PORT for Broker.Port, or the name in their envconfig tag.
+func applyEnvironment(v reflect.Value, prefix string) []error {
+	var errs []error
+
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+
+		key := field.Name
+
+		if alt := field.Tag.Get("envconfig"); alt != "" {
+			key = alt
+		}
+
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		key = strings.ToUpper(key)
+
+		if value.Kind() == reflect.Struct {
+			errs = append(errs, applyEnvironment(value, key)...)
+			continue
+		}
+
+		env, ok := os.LookupEnv(key)
+
+		if !ok {
+			continue
+		}
+
+		if err := setValue(value, env); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for environment variable %s: %w", key, err))
+		}
+	}
+
+	return errs
+}
+
+// setValue parses the text into the field, lists are separated by commas and map entries formatted as key:value.
+func setValue(value reflect.Value, text string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+
+		if err != nil {
+			return err
+		}
+
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 0, value.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 0, value.Type().Bits())
+
+		if err != nil {
+			return err
+		}
+
+		value.SetUint(n)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", value.Type())
+		}
+
+		value.Set(reflect.ValueOf(strings.Split(text, ",")))
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String || value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", value.Type())
+		}
+
+		entries := make(map[string]string)
+
+		for _, pair := range strings.Split(text, ",") {
+			key, val, ok := strings.Cut(pair, ":")
+
+			if !ok {
+				return fmt.Errorf("invalid map entry %q, expected key:value", pair)
+			}
+
+			entries[key] = val
+		}
+
+		value.Set(reflect.ValueOf(entries))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	return nil
+}
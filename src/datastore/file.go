@@ -1,14 +1,26 @@
 package datastore
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
 	"log"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 )
 
+const reloadDebounce = 100 * time.Millisecond
+
+// backupInterval is the minimum time between rotating the backups, so a burst of writes (e.g. an import) keeps the
+// backups from before it rather than filling them with its intermediate states.
+const backupInterval = time.Minute
+
 // Ensure fileStore implements the Store interface.
 var _ Store = &fileStore{}
 
@@ -16,29 +28,33 @@ type fileStore struct {
 	storage *storage
 }
 
-func File(filename string, reloadInterval time.Duration) (Store, error) {
+// File creates a store that persists its data as JSON in the given file, keeping the given number of backups of the
+// previous versions next to it (suffixed with .1, .2, ...), made at most once per backup interval. Changes made to the
+// file by others are picked up while running.
+func File(filename string, backups int) (Store, error) {
 	storage := &storage{
 		GlobalParameters: make(map[string]any),
+		Secrets:          make(map[string]string),
 		Subscriptions:    make(map[string]SubscriptionRecord),
+		Blueprints:       make(map[string]BlueprintRecord),
+		Revisions:        make(map[string][]RevisionRecord),
 
-		filename: filename,
+		backups:        backups,
+		backupInterval: backupInterval,
+		filename:       filename,
 	}
 
-	if err := storage.load(); err != nil {
+	if _, err := storage.load(); err != nil {
 		return nil, err
 	}
 
-	if err := storage.flush(); err != nil {
+	if err := storage.update(func() error { return nil }); err != nil {
 		return nil, err
 	}
 
-	go func() {
-		for range time.Tick(reloadInterval) {
-			if err := storage.load(); err != nil {
-				log.Printf("Failed to reload file store: %v\n", err)
-			}
-		}
-	}()
+	if err := storage.watch(); err != nil {
+		return nil, fmt.Errorf("unable to watch storage file: %w", err)
+	}
 
 	return &fileStore{
 		storage: storage,
@@ -46,12 +62,17 @@ func File(filename string, reloadInterval time.Duration) (Store, error) {
 }
 
 func (s *fileStore) AddSubscription(sub SubscriptionRecord) (SubscriptionRecord, error) {
-	defer s.storage.flush()
+	err := s.storage.update(func() error {
+		s.storage.subscriptionsMu.Lock()
+		defer s.storage.subscriptionsMu.Unlock()
 
-	s.storage.subscriptionsMu.Lock()
-	defer s.storage.subscriptionsMu.Unlock()
+		s.storage.Subscriptions[sub.ID] = sub
+		return nil
+	})
 
-	s.storage.Subscriptions[sub.ID] = sub
+	if err != nil {
+		return SubscriptionRecord{}, err
+	}
 
 	return sub, nil
 }
@@ -83,46 +104,122 @@ func (s *fileStore) GetSubscriptions() ([]SubscriptionRecord, error) {
 }
 
 func (s *fileStore) UpdateSubscription(sub SubscriptionRecord) (SubscriptionRecord, error) {
-	defer s.storage.flush()
+	err := s.storage.update(func() error {
+		s.storage.subscriptionsMu.Lock()
+		defer s.storage.subscriptionsMu.Unlock()
 
-	s.storage.subscriptionsMu.Lock()
-	defer s.storage.subscriptionsMu.Unlock()
+		if _, ok := s.storage.Subscriptions[sub.ID]; !ok {
+			return ErrSubscriptionNotFound
+		}
 
-	if _, ok := s.storage.Subscriptions[sub.ID]; !ok {
-		return SubscriptionRecord{}, ErrSubscriptionNotFound
+		s.storage.Subscriptions[sub.ID] = sub
+		return nil
+	})
+
+	if err != nil {
+		return SubscriptionRecord{}, err
 	}
 
-	s.storage.Subscriptions[sub.ID] = sub
 	return sub, nil
 }
 
 func (s *fileStore) DeleteSubscription(id string) error {
-	defer s.storage.flush()
+	return s.storage.update(func() error {
+		s.storage.subscriptionsMu.Lock()
+		defer s.storage.subscriptionsMu.Unlock()
 
-	s.storage.subscriptionsMu.Lock()
-	defer s.storage.subscriptionsMu.Unlock()
+		if _, ok := s.storage.Subscriptions[id]; !ok {
+			return ErrSubscriptionNotFound
+		}
 
-	if _, ok := s.storage.Subscriptions[id]; !ok {
-		return ErrSubscriptionNotFound
+		delete(s.storage.Subscriptions, id)
+		return nil
+	})
+}
+
+func (s *fileStore) AddBlueprint(blueprint BlueprintRecord) (BlueprintRecord, error) {
+	err := s.storage.update(func() error {
+		s.storage.blueprintsMu.Lock()
+		defer s.storage.blueprintsMu.Unlock()
+
+		s.storage.Blueprints[blueprint.ID] = blueprint
+		return nil
+	})
+
+	if err != nil {
+		return BlueprintRecord{}, err
 	}
 
-	delete(s.storage.Subscriptions, id)
-	return nil
+	return blueprint, nil
 }
 
-func (s *fileStore) SetGlobalParameter(key string, value any) error {
-	defer s.storage.flush()
+func (s *fileStore) GetBlueprint(id string) (BlueprintRecord, error) {
+	s.storage.blueprintsMu.RLock()
+	defer s.storage.blueprintsMu.RUnlock()
 
-	s.storage.globalParametersMu.Lock()
-	defer s.storage.globalParametersMu.Unlock()
+	blueprint, ok := s.storage.Blueprints[id]
 
-	if value == "" {
-		delete(s.storage.GlobalParameters, key)
-	} else {
-		s.storage.GlobalParameters[key] = value
+	if !ok {
+		return BlueprintRecord{}, ErrBlueprintNotFound
 	}
 
-	return nil
+	return blueprint, nil
+}
+
+func (s *fileStore) GetBlueprints() ([]BlueprintRecord, error) {
+	s.storage.blueprintsMu.RLock()
+	defer s.storage.blueprintsMu.RUnlock()
+
+	return slices.Collect(maps.Values(s.storage.Blueprints)), nil
+}
+
+func (s *fileStore) UpdateBlueprint(blueprint BlueprintRecord) (BlueprintRecord, error) {
+	err := s.storage.update(func() error {
+		s.storage.blueprintsMu.Lock()
+		defer s.storage.blueprintsMu.Unlock()
+
+		if _, ok := s.storage.Blueprints[blueprint.ID]; !ok {
+			return ErrBlueprintNotFound
+		}
+
+		s.storage.Blueprints[blueprint.ID] = blueprint
+		return nil
+	})
+
+	if err != nil {
+		return BlueprintRecord{}, err
+	}
+
+	return blueprint, nil
+}
+
+func (s *fileStore) DeleteBlueprint(id string) error {
+	return s.storage.update(func() error {
+		s.storage.blueprintsMu.Lock()
+		defer s.storage.blueprintsMu.Unlock()
+
+		if _, ok := s.storage.Blueprints[id]; !ok {
+			return ErrBlueprintNotFound
+		}
+
+		delete(s.storage.Blueprints, id)
+		return nil
+	})
+}
+
+func (s *fileStore) SetGlobalParameter(key string, value any) error {
+	return s.storage.update(func() error {
+		s.storage.globalParametersMu.Lock()
+		defer s.storage.globalParametersMu.Unlock()
+
+		if value == "" {
+			delete(s.storage.GlobalParameters, key)
+		} else {
+			s.storage.GlobalParameters[key] = value
+		}
+
+		return nil
+	})
 }
 
 func (s *fileStore) GetGlobalParameters() (map[string]any, error) {
@@ -139,62 +236,473 @@ func (s *fileStore) GetGlobalParameters() (map[string]any, error) {
 }
 
 func (s *fileStore) DeleteGlobalParameter(key string) error {
-	defer s.storage.flush()
-	s.storage.globalParametersMu.Lock()
-	defer s.storage.globalParametersMu.Unlock()
+	return s.storage.update(func() error {
+		s.storage.globalParametersMu.Lock()
+		defer s.storage.globalParametersMu.Unlock()
 
-	delete(s.storage.GlobalParameters, key)
-	return nil
+		delete(s.storage.GlobalParameters, key)
+		return nil
+	})
+}
+
+func (s *fileStore) SetSecret(key string, value string) error {
+	return s.storage.update(func() error {
+		s.storage.secretsMu.Lock()
+		defer s.storage.secretsMu.Unlock()
+
+		if value == "" {
+			delete(s.storage.Secrets, key)
+		} else {
+			s.storage.Secrets[key] = value
+		}
+
+		return nil
+	})
+}
+
+func (s *fileStore) GetSecrets() (map[string]string, error) {
+	s.storage.secretsMu.RLock()
+	defer s.storage.secretsMu.RUnlock()
+
+	secrets := make(map[string]string, len(s.storage.Secrets))
+
+	for key, value := range s.storage.Secrets {
+		secrets[key] = value
+	}
+
+	return secrets, nil
+}
+
+func (s *fileStore) DeleteSecret(key string) error {
+	return s.storage.update(func() error {
+		s.storage.secretsMu.Lock()
+		defer s.storage.secretsMu.Unlock()
+
+		delete(s.storage.Secrets, key)
+		return nil
+	})
+}
+
+func (s *fileStore) AddRevision(revision RevisionRecord) error {
+	return s.storage.update(func() error {
+		s.storage.revisionsMu.Lock()
+		defer s.storage.revisionsMu.Unlock()
+
+		s.storage.Revisions[revision.SubscriptionID] = appendRevision(s.storage.Revisions[revision.SubscriptionID], revision)
+		return nil
+	})
+}
+
+func (s *fileStore) GetRevisions(subscriptionID string) ([]RevisionRecord, error) {
+	s.storage.revisionsMu.RLock()
+	defer s.storage.revisionsMu.RUnlock()
+
+	return slices.Clone(s.storage.Revisions[subscriptionID]), nil
+}
+
+func (s *fileStore) AddAuditEntry(entry AuditRecord) error {
+	return s.storage.update(func() error {
+		s.storage.auditMu.Lock()
+		defer s.storage.auditMu.Unlock()
+
+		s.storage.Audit = appendAuditEntry(s.storage.Audit, entry)
+		return nil
+	})
+}
+
+func (s *fileStore) GetAuditEntries() ([]AuditRecord, error) {
+	s.storage.auditMu.RLock()
+	defer s.storage.auditMu.RUnlock()
+
+	return slices.Clone(s.storage.Audit), nil
+}
+
+func (s *fileStore) Apply(changes Changes) error {
+	return s.storage.update(func() error {
+		s.storage.globalParametersMu.Lock()
+		defer s.storage.globalParametersMu.Unlock()
+		s.storage.secretsMu.Lock()
+		defer s.storage.secretsMu.Unlock()
+		s.storage.subscriptionsMu.Lock()
+		defer s.storage.subscriptionsMu.Unlock()
+		s.storage.blueprintsMu.Lock()
+		defer s.storage.blueprintsMu.Unlock()
+		s.storage.revisionsMu.Lock()
+		defer s.storage.revisionsMu.Unlock()
+		s.storage.auditMu.Lock()
+		defer s.storage.auditMu.Unlock()
+
+		return applyChanges(changes, s.storage.Subscriptions, s.storage.Blueprints, s.storage.GlobalParameters, s.storage.Secrets, s.storage.Revisions, &s.storage.Audit)
+	})
+}
+
+func (s *fileStore) OnChange(listener func()) {
+	s.storage.listeners.add(listener)
+}
+
+// Close stops watching the file, and writes the current state in case the last write failed.
+func (s *fileStore) Close() error {
+	if s.storage.watcher != nil {
+		_ = s.storage.watcher.Close()
+	}
+
+	s.storage.fsMu.Lock()
+	defer s.storage.fsMu.Unlock()
+
+	return s.storage.write()
 }
 
 type storage struct {
 	GlobalParameters map[string]any                `json:"globalParameters"`
+	Secrets          map[string]string             `json:"secrets"`
 	Subscriptions    map[string]SubscriptionRecord `json:"subscriptions"`
+	Blueprints       map[string]BlueprintRecord    `json:"blueprints,omitempty"`
+	Revisions        map[string][]RevisionRecord   `json:"revisions,omitempty"`
+	Audit            []AuditRecord                 `json:"audit,omitempty"`
 
 	globalParametersMu sync.RWMutex
+	secretsMu          sync.RWMutex
 	subscriptionsMu    sync.RWMutex
+	blueprintsMu       sync.RWMutex
+	revisionsMu        sync.RWMutex
+	auditMu            sync.RWMutex
+
+	backups        int
+	backupInterval time.Duration
+	lastBackup     time.Time
+	filename       string
+	listeners      listeners
+	watcher        *fsnotify.Watcher
+
+	// fsMu serializes updates and reloads, data contains the contents last written or loaded and hash its SHA-256
+	fsMu sync.Mutex
+	data []byte
+	hash [sha256.Size]byte
+}
+
+// update applies the mutation and atomically replaces the file with the resulting state, after rotating the backups.
+// When either fails, the state is restored to the contents of the file, so a failed change never takes effect. Changes
+// made to the file by others that haven't been reloaded yet are loaded first, so they aren't overwritten.
+func (s *storage) update(mutate func() error) error {
+	s.fsMu.Lock()
+
+	reloaded, err := s.reload()
+
+	if err != nil {
+		s.fsMu.Unlock()
+		return err
+	}
 
-	filename string
-	fsMu     sync.RWMutex
+	if reloaded {
+		log.Printf("Reloaded file store before writing, %s was modified\n", s.filename)
+	}
+
+	err = mutate()
+
+	if err == nil {
+		err = s.write()
+	}
+
+	if err != nil {
+		if restoreErr := s.restore(s.data); restoreErr != nil {
+			err = errors.Join(err, restoreErr)
+		}
+
+		s.fsMu.Unlock()
+
+		if reloaded {
+			s.listeners.notify()
+		}
+
+		return err
+	}
+
+	s.fsMu.Unlock()
+
+	s.listeners.notify()
+
+	return nil
 }
 
-func (s *storage) flush() error {
-	data, err := json.Marshal(s)
+// write must be called while holding fsMu.
+func (s *storage) write() error {
+	data, err := s.marshal()
 
 	if err != nil {
 		return err
 	}
 
+	if sha256.Sum256(data) == s.hash {
+		return nil
+	}
+
+	if err := s.rotateBackups(); err != nil {
+		return fmt.Errorf("%w: unable to rotate backups: %w", ErrFlushFailed, err)
+	}
+
+	if err := writeFileAtomic(s.filename, data, 0644); err != nil {
+		return fmt.Errorf("%w: %w", ErrFlushFailed, err)
+	}
+
+	s.data = data
+	s.hash = sha256.Sum256(data)
+
+	return nil
+}
+
+func (s *storage) marshal() ([]byte, error) {
+	s.globalParametersMu.RLock()
+	defer s.globalParametersMu.RUnlock()
+	s.secretsMu.RLock()
+	defer s.secretsMu.RUnlock()
+	s.subscriptionsMu.RLock()
+	defer s.subscriptionsMu.RUnlock()
+	s.blueprintsMu.RLock()
+	defer s.blueprintsMu.RUnlock()
+	s.revisionsMu.RLock()
+	defer s.revisionsMu.RUnlock()
+	s.auditMu.RLock()
+	defer s.auditMu.RUnlock()
+
+	return json.Marshal(s)
+}
+
+// rotateBackups shifts the existing backups by one and copies the current file to the first backup, unless the
+// backups were rotated less than the backup interval ago.
+func (s *storage) rotateBackups() error {
+	if s.backups <= 0 || time.Since(s.lastBackup) < s.backupInterval {
+		return nil
+	}
+
+	current, err := os.ReadFile(s.filename)
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	for i := s.backups - 1; i >= 1; i-- {
+		if err := os.Rename(s.backupFilename(i), s.backupFilename(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(s.backupFilename(1), current, 0644); err != nil {
+		return err
+	}
+
+	s.lastBackup = time.Now()
+
+	return nil
+}
+
+func (s *storage) backupFilename(n int) string {
+	return fmt.Sprintf("%s.%d", s.filename, n)
+}
+
+// load replaces the state with the contents of the file, and reports whether they differ from what was last written
+// or loaded.
+func (s *storage) load() (bool, error) {
 	s.fsMu.Lock()
 	defer s.fsMu.Unlock()
 
-	return os.WriteFile(s.filename, data, 0644)
+	return s.reload()
 }
 
-func (s *storage) load() error {
-	s.fsMu.RLock()
-	defer s.fsMu.RUnlock()
-
+// reload is load for callers that hold fsMu.
+func (s *storage) reload() (bool, error) {
 	data, err := os.ReadFile(s.filename)
 
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil
+			return false, nil
 		}
 
+		return false, err
+	}
+
+	hash := sha256.Sum256(data)
+
+	if hash == s.hash {
+		return false, nil
+	}
+
+	if err := s.restore(data); err != nil {
+		return false, err
+	}
+
+	s.data = data
+	s.hash = hash
+
+	return true, nil
+}
+
+// restore replaces the state with the given contents of the file, it must be called while holding fsMu.
+func (s *storage) restore(data []byte) error {
+	if data == nil {
+		data = []byte("{}")
+	}
+
+	// Decode into a separate value first, so a corrupted file never wipes the current state.
+	var loaded storage
+
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("%w: %s: %w (restore it from a backup, e.g. %s)", ErrCorruptedFile, s.filename, err, s.backupFilename(1))
+	}
+
+	if loaded.GlobalParameters == nil {
+		loaded.GlobalParameters = make(map[string]any)
+	}
+
+	if loaded.Secrets == nil {
+		loaded.Secrets = make(map[string]string)
+	}
+
+	if loaded.Subscriptions == nil {
+		loaded.Subscriptions = make(map[string]SubscriptionRecord)
+	}
+
+	if loaded.Blueprints == nil {
+		loaded.Blueprints = make(map[string]BlueprintRecord)
+	}
+
+	if loaded.Revisions == nil {
+		loaded.Revisions = make(map[string][]RevisionRecord)
+	}
+
+	s.globalParametersMu.Lock()
+	s.GlobalParameters = loaded.GlobalParameters
+	s.globalParametersMu.Unlock()
+
+	s.secretsMu.Lock()
+	s.Secrets = loaded.Secrets
+	s.secretsMu.Unlock()
+
+	s.subscriptionsMu.Lock()
+	s.Subscriptions = loaded.Subscriptions
+	s.subscriptionsMu.Unlock()
+
+	s.blueprintsMu.Lock()
+	s.Blueprints = loaded.Blueprints
+	s.blueprintsMu.Unlock()
+
+	s.revisionsMu.Lock()
+	s.Revisions = loaded.Revisions
+	s.revisionsMu.Unlock()
+
+	s.auditMu.Lock()
+	s.Audit = loaded.Audit
+	s.auditMu.Unlock()
+
+	return nil
+}
+
+// watch reloads the file whenever it's modified by someone else. The directory is watched rather than the file, as
+// the file is replaced on every write (by us, and by most editors).
+func (s *storage) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
 		return err
 	}
 
-	if err := json.Unmarshal(data, s); err != nil {
+	if err := watcher.Add(filepath.Dir(s.filename)); err != nil {
+		_ = watcher.Close()
 		return err
 	}
 
-	if s.GlobalParameters == nil {
-		s.GlobalParameters = make(map[string]any)
+	s.watcher = watcher
+
+	filename := filepath.Clean(s.filename)
+	reload := func() {
+		changed, err := s.load()
+
+		if err != nil {
+			log.Printf("Failed to reload file store: %v\n", err)
+			return
+		}
+
+		if changed {
+			log.Printf("Reloaded file store after %s was modified\n", s.filename)
+			s.listeners.notify()
+		}
+	}
+
+	go func() {
+		var debounce *time.Timer
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(event.Name) != filename || !event.Has(fsnotify.Write|fsnotify.Create) {
+					continue
+				}
+
+				// Writes often arrive in bursts, wait for them to settle before reading the file.
+				if debounce != nil {
+					debounce.Stop()
+				}
+
+				debounce = time.AfterFunc(reloadDebounce, reload)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				log.Printf("Error watching file store: %v\n", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory, syncs it and renames it over the
+// target, so the target is never left partially written.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filename)
+	tmp, err := os.CreateTemp(dir, filepath.Base(filename)+".tmp-*")
+
+	if err != nil {
+		return err
+	}
+
+	// Removing the temporary file is a no-op once it has been renamed.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return err
 	}
 
-	if s.Subscriptions == nil {
-		s.Subscriptions = make(map[string]SubscriptionRecord)
+	// Sync the directory as well, so the rename itself survives a crash.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
 	}
 
 	return nil
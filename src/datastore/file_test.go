@@ -0,0 +1,208 @@
+package datastore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreBackups(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	store, err := File(filename, 2)
+
+	assert.NoError(t, err)
+
+	store.(*fileStore).storage.backupInterval = 0
+
+	for _, id := range []string{"1", "2", "3"} {
+		_, err := store.AddSubscription(SubscriptionRecord{ID: id})
+		assert.NoError(t, err)
+	}
+
+	assert.FileExists(t, filename+".1")
+	assert.FileExists(t, filename+".2")
+	assert.NoFileExists(t, filename+".3")
+
+	backup, err := File(filename+".1", 0)
+	assert.NoError(t, err)
+
+	subs, _ := backup.GetSubscriptions()
+	assert.Len(t, subs, 2)
+}
+
+func TestFileStoreKeepsBackupsDuringBursts(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	store, err := File(filename, 3)
+
+	assert.NoError(t, err)
+
+	_, err = store.AddSubscription(SubscriptionRecord{ID: "before"})
+	assert.NoError(t, err)
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		_, err := store.AddSubscription(SubscriptionRecord{ID: id})
+		assert.NoError(t, err)
+	}
+
+	// Only the first write of the burst rotated the backups, so the state from before it is kept.
+	assert.FileExists(t, filename+".1")
+	assert.NoFileExists(t, filename+".2")
+
+	backup, err := File(filename+".1", 0)
+	assert.NoError(t, err)
+
+	subs, _ := backup.GetSubscriptions()
+	assert.Empty(t, subs)
+}
+
+func TestFileStoreRefusesCorruptedFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	assert.NoError(t, os.WriteFile(filename, []byte(`{"subscriptions":`), 0644))
+
+	_, err := File(filename, 3)
+
+	assert.ErrorIs(t, err, ErrCorruptedFile)
+
+	contents, _ := os.ReadFile(filename)
+	assert.Equal(t, `{"subscriptions":`, string(contents))
+}
+
+func TestFileStoreReportsFlushErrors(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	dir := t.TempDir()
+	store, err := File(filepath.Join(dir, "storage.json"), 0)
+
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chmod(dir, 0500))
+	t.Cleanup(func() { _ = os.Chmod(dir, 0700) })
+
+	_, err = store.AddSubscription(SubscriptionRecord{ID: "1"})
+	assert.ErrorIs(t, err, ErrFlushFailed)
+}
+
+func TestFileStoreRollsBackFailedWrites(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	store, err := File(filename, 1)
+
+	assert.NoError(t, err)
+
+	store.(*fileStore).storage.backupInterval = 0
+
+	_, err = store.AddSubscription(SubscriptionRecord{ID: "1", Name: "before"})
+	assert.NoError(t, err)
+
+	// A non-empty directory in place of the backup makes rotating the backups fail, also for root.
+	assert.NoError(t, os.Remove(filename+".1"))
+	assert.NoError(t, os.MkdirAll(filepath.Join(filename+".1", "blocked"), 0700))
+
+	_, err = store.UpdateSubscription(SubscriptionRecord{ID: "1", Name: "after"})
+	assert.ErrorIs(t, err, ErrFlushFailed)
+
+	_, err = store.AddSubscription(SubscriptionRecord{ID: "2"})
+	assert.ErrorIs(t, err, ErrFlushFailed)
+
+	sub, err := store.GetSubscription("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "before", sub.Name)
+
+	_, err = store.GetSubscription("2")
+	assert.ErrorIs(t, err, ErrSubscriptionNotFound)
+}
+
+func TestFileStoreAppliesChanges(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	store, err := File(filename, 0)
+
+	assert.NoError(t, err)
+
+	err = store.Apply(Changes{
+		Subscriptions: []SubscriptionRecord{{ID: "1"}},
+		Revisions:     []RevisionRecord{{SubscriptionID: "1", Revision: 1}},
+		AuditEntries:  []AuditRecord{{Action: "create", EntityID: "1"}},
+	})
+	assert.NoError(t, err)
+
+	reopened, err := File(filename, 0)
+	assert.NoError(t, err)
+
+	_, err = reopened.GetSubscription("1")
+	assert.NoError(t, err)
+
+	revisions, _ := reopened.GetRevisions("1")
+	assert.Len(t, revisions, 1)
+
+	entries, _ := reopened.GetAuditEntries()
+	assert.Len(t, entries, 1)
+
+	// Deleting a subscription that doesn't exist fails the whole change.
+	err = store.Apply(Changes{
+		Subscriptions:        []SubscriptionRecord{{ID: "2"}},
+		DeletedSubscriptions: []string{"missing"},
+		AuditEntries:         []AuditRecord{{Action: "delete", EntityID: "missing"}},
+	})
+	assert.ErrorIs(t, err, ErrSubscriptionNotFound)
+
+	_, err = store.GetSubscription("2")
+	assert.ErrorIs(t, err, ErrSubscriptionNotFound)
+
+	entries, _ = store.GetAuditEntries()
+	assert.Len(t, entries, 1)
+}
+
+func TestFileStoreReloadsExternalChanges(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	store, err := File(filename, 0)
+
+	assert.NoError(t, err)
+
+	changed := make(chan struct{}, 10)
+	store.OnChange(func() { changed <- struct{}{} })
+
+	_, err = store.AddSubscription(SubscriptionRecord{ID: "1"})
+	assert.NoError(t, err)
+	<-changed
+
+	// Our own write must not trigger a reload
+	select {
+	case <-changed:
+		t.Fatal("own write was reloaded")
+	case <-time.After(3 * reloadDebounce):
+	}
+
+	assert.NoError(t, os.WriteFile(filename, []byte(`{"subscriptions":{"2":{"id":"2"}}}`), 0644))
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("external change was not picked up")
+	}
+
+	subs, _ := store.GetSubscriptions()
+	assert.Equal(t, []SubscriptionRecord{{ID: "2"}}, subs)
+}
+
+func TestFileStoreKeepsExternalChangesOnWrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "storage.json")
+	store, err := File(filename, 0)
+
+	assert.NoError(t, err)
+
+	// Written right before the change, well within the debounce of the watcher.
+	assert.NoError(t, os.WriteFile(filename, []byte(`{"subscriptions":{"external":{"id":"external"}}}`), 0644))
+
+	_, err = store.AddSubscription(SubscriptionRecord{ID: "api"})
+	assert.NoError(t, err)
+
+	reopened, err := File(filename, 0)
+	assert.NoError(t, err)
+
+	for _, s := range []Store{store, reopened} {
+		subs, _ := s.GetSubscriptions()
+		assert.ElementsMatch(t, []SubscriptionRecord{{ID: "external"}, {ID: "api"}}, subs)
+	}
+}
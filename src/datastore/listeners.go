@@ -0,0 +1,27 @@
+package datastore
+
+import (
+	"sync"
+)
+
+// listeners keeps track of the functions to call when the data in a store changes.
+type listeners struct {
+	funcs []func()
+	mu    sync.RWMutex
+}
+
+func (l *listeners) add(listener func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.funcs = append(l.funcs, listener)
+}
+
+func (l *listeners) notify() {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, listener := range l.funcs {
+		listener()
+	}
+}
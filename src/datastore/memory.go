@@ -1,6 +1,8 @@
 package datastore
 
 import (
+	"maps"
+	"slices"
 	"sync"
 )
 
@@ -10,18 +12,34 @@ var _ Store = &memoryStore{}
 type memoryStore struct {
 	globalParameters   map[string]any
 	globalParametersMu sync.RWMutex
+	secrets            map[string]string
+	secretsMu          sync.RWMutex
 	subscriptions      map[string]SubscriptionRecord
 	subscriptionsMu    sync.RWMutex
+	blueprints         map[string]BlueprintRecord
+	blueprintsMu       sync.RWMutex
+	revisions          map[string][]RevisionRecord
+	revisionsMu        sync.RWMutex
+	audit              []AuditRecord
+	auditMu            sync.RWMutex
+
+	listeners listeners
 }
 
 func Memory() (Store, error) {
 	return &memoryStore{
 		globalParameters: make(map[string]any),
+		secrets:          make(map[string]string),
 		subscriptions:    make(map[string]SubscriptionRecord),
+		blueprints:       make(map[string]BlueprintRecord),
+		revisions:        make(map[string][]RevisionRecord),
 	}, nil
 }
 
 func (s *memoryStore) AddSubscription(sub SubscriptionRecord) (SubscriptionRecord, error) {
+	// Deferred first, so listeners are notified after the lock is released.
+	defer s.listeners.notify()
+
 	s.subscriptionsMu.Lock()
 	defer s.subscriptionsMu.Unlock()
 
@@ -57,6 +75,8 @@ func (s *memoryStore) GetSubscriptions() ([]SubscriptionRecord, error) {
 }
 
 func (s *memoryStore) UpdateSubscription(sub SubscriptionRecord) (SubscriptionRecord, error) {
+	defer s.listeners.notify()
+
 	s.subscriptionsMu.Lock()
 	defer s.subscriptionsMu.Unlock()
 
@@ -69,6 +89,8 @@ func (s *memoryStore) UpdateSubscription(sub SubscriptionRecord) (SubscriptionRe
 }
 
 func (s *memoryStore) DeleteSubscription(id string) error {
+	defer s.listeners.notify()
+
 	s.subscriptionsMu.Lock()
 	defer s.subscriptionsMu.Unlock()
 
@@ -80,7 +102,68 @@ func (s *memoryStore) DeleteSubscription(id string) error {
 	return nil
 }
 
+func (s *memoryStore) AddBlueprint(blueprint BlueprintRecord) (BlueprintRecord, error) {
+	defer s.listeners.notify()
+
+	s.blueprintsMu.Lock()
+	defer s.blueprintsMu.Unlock()
+
+	s.blueprints[blueprint.ID] = blueprint
+
+	return blueprint, nil
+}
+
+func (s *memoryStore) GetBlueprint(id string) (BlueprintRecord, error) {
+	s.blueprintsMu.RLock()
+	defer s.blueprintsMu.RUnlock()
+
+	blueprint, ok := s.blueprints[id]
+
+	if !ok {
+		return BlueprintRecord{}, ErrBlueprintNotFound
+	}
+
+	return blueprint, nil
+}
+
+func (s *memoryStore) GetBlueprints() ([]BlueprintRecord, error) {
+	s.blueprintsMu.RLock()
+	defer s.blueprintsMu.RUnlock()
+
+	return slices.Collect(maps.Values(s.blueprints)), nil
+}
+
+func (s *memoryStore) UpdateBlueprint(blueprint BlueprintRecord) (BlueprintRecord, error) {
+	defer s.listeners.notify()
+
+	s.blueprintsMu.Lock()
+	defer s.blueprintsMu.Unlock()
+
+	if _, ok := s.blueprints[blueprint.ID]; !ok {
+		return BlueprintRecord{}, ErrBlueprintNotFound
+	}
+
+	s.blueprints[blueprint.ID] = blueprint
+	return blueprint, nil
+}
+
+func (s *memoryStore) DeleteBlueprint(id string) error {
+	defer s.listeners.notify()
+
+	s.blueprintsMu.Lock()
+	defer s.blueprintsMu.Unlock()
+
+	if _, ok := s.blueprints[id]; !ok {
+		return ErrBlueprintNotFound
+	}
+
+	delete(s.blueprints, id)
+	return nil
+}
+
 func (s *memoryStore) SetGlobalParameter(key string, value any) error {
+	defer s.listeners.notify()
+
 	s.globalParametersMu.Lock()
 	defer s.globalParametersMu.Unlock()
 
@@ -107,9 +190,108 @@ func (s *memoryStore) GetGlobalParameters() (map[string]any, error) {
 }
 
 func (s *memoryStore) DeleteGlobalParameter(key string) error {
+	defer s.listeners.notify()
+
 	s.globalParametersMu.Lock()
 	defer s.globalParametersMu.Unlock()
 
 	delete(s.globalParameters, key)
 	return nil
 }
+
+func (s *memoryStore) SetSecret(key string, value string) error {
+	defer s.listeners.notify()
+
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	if value == "" {
+		delete(s.secrets, key)
+	} else {
+		s.secrets[key] = value
+	}
+
+	return nil
+}
+
+func (s *memoryStore) GetSecrets() (map[string]string, error) {
+	s.secretsMu.RLock()
+	defer s.secretsMu.RUnlock()
+
+	secrets := make(map[string]string, len(s.secrets))
+
+	for key, value := range s.secrets {
+		secrets[key] = value
+	}
+
+	return secrets, nil
+}
+
+func (s *memoryStore) DeleteSecret(key string) error {
+	defer s.listeners.notify()
+
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+
+	delete(s.secrets, key)
+	return nil
+}
+
+func (s *memoryStore) AddRevision(revision RevisionRecord) error {
+	s.revisionsMu.Lock()
+	defer s.revisionsMu.Unlock()
+
+	s.revisions[revision.SubscriptionID] = appendRevision(s.revisions[revision.SubscriptionID], revision)
+
+	return nil
+}
+
+func (s *memoryStore) GetRevisions(subscriptionID string) ([]RevisionRecord, error) {
+	s.revisionsMu.RLock()
+	defer s.revisionsMu.RUnlock()
+
+	return slices.Clone(s.revisions[subscriptionID]), nil
+}
+
+func (s *memoryStore) AddAuditEntry(entry AuditRecord) error {
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	s.audit = appendAuditEntry(s.audit, entry)
+
+	return nil
+}
+
+func (s *memoryStore) GetAuditEntries() ([]AuditRecord, error) {
+	s.auditMu.RLock()
+	defer s.auditMu.RUnlock()
+
+	return slices.Clone(s.audit), nil
+}
+
+func (s *memoryStore) Apply(changes Changes) error {
+	defer s.listeners.notify()
+
+	s.globalParametersMu.Lock()
+	defer s.globalParametersMu.Unlock()
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+	s.blueprintsMu.Lock()
+	defer s.blueprintsMu.Unlock()
+	s.revisionsMu.Lock()
+	defer s.revisionsMu.Unlock()
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	return applyChanges(changes, s.subscriptions, s.blueprints, s.globalParameters, s.secrets, s.revisions, &s.audit)
+}
+
+func (s *memoryStore) OnChange(listener func()) {
+	s.listeners.add(listener)
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
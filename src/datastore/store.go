@@ -2,10 +2,24 @@ package datastore
 
 import (
 	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// MaxRevisionsPerSubscription is the number of revisions the stores keep per subscription, older ones are dropped.
+	MaxRevisionsPerSubscription = 50
+	// MaxAuditEntries is the number of audit entries the stores keep, older ones are dropped.
+	MaxAuditEntries = 1000
 )
 
 var (
 	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrBlueprintNotFound    = errors.New("blueprint not found")
+	ErrFlushFailed          = errors.New("unable to write storage file")
+	ErrCorruptedFile        = errors.New("storage file is corrupted")
+	ErrInvalidYAML          = errors.New("invalid yaml storage")
+	ErrReadOnly             = errors.New("defined in yaml storage and read-only")
 )
 
 type Store interface {
@@ -17,11 +31,131 @@ type Store interface {
 	UpdateSubscription(subscription SubscriptionRecord) (SubscriptionRecord, error)
 	DeleteSubscription(id string) error
 
+	// Blueprints
+
+	AddBlueprint(blueprint BlueprintRecord) (BlueprintRecord, error)
+	GetBlueprint(id string) (BlueprintRecord, error)
+	GetBlueprints() ([]BlueprintRecord, error)
+	UpdateBlueprint(blueprint BlueprintRecord) (BlueprintRecord, error)
+	DeleteBlueprint(id string) error
+
 	// Global Variables
 
 	SetGlobalParameter(key string, value any) error
 	GetGlobalParameters() (map[string]any, error)
 	DeleteGlobalParameter(key string) error
+
+	// Secrets, values are encrypted before they're passed to the store
+
+	SetSecret(key string, value string) error
+	GetSecrets() (map[string]string, error)
+	DeleteSecret(key string) error
+
+	// Revisions of subscriptions, returned in the order they were added
+
+	AddRevision(revision RevisionRecord) error
+	GetRevisions(subscriptionID string) ([]RevisionRecord, error)
+
+	// Audit log, returned in the order the entries were added
+
+	AddAuditEntry(entry AuditRecord) error
+	GetAuditEntries() ([]AuditRecord, error)
+
+	// Apply makes all the changes in a single write, either all of them take effect or none of them do
+	Apply(changes Changes) error
+
+	// OnChange registers a listener that is called after the data in the store changed, including changes made
+	// outside the application
+	OnChange(listener func())
+
+	// Close flushes pending changes and stops watching for changes made outside the application
+	Close() error
+}
+
+// Changes are applied together by Store.Apply, e.g. a change to a subscription with its revision and audit entry.
+// Deletions are applied before additions, deleting a subscription or blueprint that doesn't exist fails the whole
+// change.
+type Changes struct {
+	// Subscriptions are added, or replace the subscription with the same ID
+	Subscriptions        []SubscriptionRecord
+	DeletedSubscriptions []string
+	// Blueprints are added, or replace the blueprint with the same ID
+	Blueprints        []BlueprintRecord
+	DeletedBlueprints []string
+	// GlobalParameters and Secrets are set to the given values, including empty ones, deletions are listed separately
+	GlobalParameters        map[string]any
+	DeletedGlobalParameters []string
+	Secrets                 map[string]string
+	DeletedSecrets          []string
+
+	Revisions    []RevisionRecord
+	AuditEntries []AuditRecord
+}
+
+// applyChanges applies the changes to the state of a store, its locks must be held. Nothing is changed when an error is
+// returned.
+func applyChanges(
+	changes Changes,
+	subscriptions map[string]SubscriptionRecord,
+	blueprints map[string]BlueprintRecord,
+	globalParameters map[string]any,
+	secrets map[string]string,
+	revisions map[string][]RevisionRecord,
+	audit *[]AuditRecord,
+) error {
+	for _, id := range changes.DeletedSubscriptions {
+		if _, ok := subscriptions[id]; !ok {
+			return fmt.Errorf("%w: %s", ErrSubscriptionNotFound, id)
+		}
+	}
+
+	for _, id := range changes.DeletedBlueprints {
+		if _, ok := blueprints[id]; !ok {
+			return fmt.Errorf("%w: %s", ErrBlueprintNotFound, id)
+		}
+	}
+
+	for _, id := range changes.DeletedSubscriptions {
+		delete(subscriptions, id)
+	}
+
+	for _, sub := range changes.Subscriptions {
+		subscriptions[sub.ID] = sub
+	}
+
+	for _, id := range changes.DeletedBlueprints {
+		delete(blueprints, id)
+	}
+
+	for _, blueprint := range changes.Blueprints {
+		blueprints[blueprint.ID] = blueprint
+	}
+
+	for _, key := range changes.DeletedGlobalParameters {
+		delete(globalParameters, key)
+	}
+
+	for key, value := range changes.GlobalParameters {
+		globalParameters[key] = value
+	}
+
+	for _, key := range changes.DeletedSecrets {
+		delete(secrets, key)
+	}
+
+	for key, value := range changes.Secrets {
+		secrets[key] = value
+	}
+
+	for _, revision := range changes.Revisions {
+		revisions[revision.SubscriptionID] = appendRevision(revisions[revision.SubscriptionID], revision)
+	}
+
+	for _, entry := range changes.AuditEntries {
+		*audit = appendAuditEntry(*audit, entry)
+	}
+
+	return nil
 }
 
 type SubscriptionRecord struct {
@@ -30,12 +164,34 @@ type SubscriptionRecord struct {
 
 	// ID is the unique identifier for the subscription
 	ID string `json:"id"`
+	// Version is incremented on every change, it's used to detect conflicting updates. Subscriptions stored before
+	// versions were introduced have version 0.
+	Version int `json:"version,omitempty"`
 	// Topic is the MQTT topic the subscription is for
 	Topic string `json:"topic"`
+	// Tags are free-form labels to organise and select subscriptions
+	Tags []string `json:"tags,omitempty"`
+	// Group is the optional group the subscription belongs to
+	Group string `json:"group,omitempty"`
+	// Disabled subscriptions are kept, but not processed
+	Disabled bool `json:"disabled,omitempty"`
+	// BlueprintID refers to the blueprint the subscription is an instance of, all fields other than the name, tags,
+	// group and disabled state are taken from the blueprint
+	BlueprintID string `json:"blueprintId,omitempty"`
+	// Parameters are the values for the parameters declared by the blueprint
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// PayloadFormat is the format used to decode the message payload before extraction, defaults to JSON
+	PayloadFormat string `json:"payloadFormat,omitempty"`
 	// Extract is a map of variable names to JSONata expressions
 	Extract map[string]string `json:"extract"`
 	// Filter is a JSONata expression to filter messages, returning true if the message should be processed
 	Filter string `json:"filter"`
+	// SkipRetained indicates retained messages should not be processed
+	SkipRetained bool `json:"skipRetained,omitempty"`
+	// StrictPlaceholders refuses to deliver a message when a placeholder in the request can't be resolved
+	StrictPlaceholders bool `json:"strictPlaceholders,omitempty"`
+	// ErrorPolicy determines what happens when extraction, filtering or rendering fails
+	ErrorPolicy string `json:"errorPolicy,omitempty"`
 
 	// Method is the HTTP method to use for the request
 	Method string `json:"method"`
@@ -45,4 +201,90 @@ type SubscriptionRecord struct {
 	Headers map[string]string `json:"headers"`
 	// Body is the template to use for rendering the HTTP response body
 	Body string `json:"template"`
+	// BodyMode determines how the Body is rendered (template, json or jsonata)
+	BodyMode string `json:"bodyMode,omitempty"`
+}
+
+type BlueprintRecord struct {
+	// ID is the unique identifier for the blueprint
+	ID string `json:"id"`
+	// Name is the name of the blueprint
+	Name string `json:"name"`
+	// Description explains what the blueprint is for
+	Description string `json:"description,omitempty"`
+	// Parameters are the inputs that instances provide values for
+	Parameters []BlueprintParameterRecord `json:"parameters,omitempty"`
+	// Subscription is the subscription of every instance, its fields can refer to the parameters as {{ .param.name }}
+	Subscription SubscriptionRecord `json:"subscription"`
+}
+
+type BlueprintParameterRecord struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Default is used when an instance doesn't provide a value, unless the parameter is required
+	Default  string `json:"default,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+type RevisionRecord struct {
+	// SubscriptionID is the ID of the subscription the revision belongs to
+	SubscriptionID string `json:"subscriptionId"`
+	// Revision is the sequence number of the revision, starting at 1
+	Revision int `json:"revision"`
+	// Timestamp is the time the change was made
+	Timestamp time.Time `json:"timestamp"`
+	// Author is the identity of who made the change, if known
+	Author string `json:"author,omitempty"`
+	// Action is the kind of change, e.g. create, update, delete or restore
+	Action string `json:"action"`
+	// Subscription is the full snapshot of the subscription after the change, or before it was deleted
+	Subscription SubscriptionRecord `json:"subscription"`
+	// Changes are the fields that differ from the previous revision
+	Changes []FieldChangeRecord `json:"changes,omitempty"`
+}
+
+type FieldChangeRecord struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// appendRevision adds the revision, dropping the oldest revisions when there are too many.
+func appendRevision(revisions []RevisionRecord, revision RevisionRecord) []RevisionRecord {
+	revisions = append(revisions, revision)
+
+	if len(revisions) > MaxRevisionsPerSubscription {
+		revisions = revisions[len(revisions)-MaxRevisionsPerSubscription:]
+	}
+
+	return revisions
+}
+
+type AuditRecord struct {
+	// Timestamp is the time the change was made
+	Timestamp time.Time `json:"timestamp"`
+	// Actor is the identity of who made the change, if known
+	Actor string `json:"actor,omitempty"`
+	// SourceIP is the address the change was made from
+	SourceIP string `json:"sourceIp,omitempty"`
+	// Action is the kind of change, e.g. create, update or delete
+	Action string `json:"action"`
+	// EntityType is the kind of entity that was changed, e.g. subscription or globalParameter
+	EntityType string `json:"entityType"`
+	// EntityID identifies the entity that was changed, the ID of a subscription or the key of a parameter
+	EntityID string `json:"entityId,omitempty"`
+	// Before and After are the values before and after the change, when applicable
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+// appendAuditEntry adds the entry, dropping the oldest entries when there are too many.
+func appendAuditEntry(entries []AuditRecord, entry AuditRecord) []AuditRecord {
+	entries = append(entries, entry)
+
+	if len(entries) > MaxAuditEntries {
+		entries = entries[len(entries)-MaxAuditEntries:]
+	}
+
+	return entries
 }
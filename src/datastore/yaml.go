@@ -0,0 +1,515 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ensure yamlStore implements the Store interface.
+var _ Store = &yamlStore{}
+
+// GlobalParametersFile is the name of the file in the YAML directory that contains the global parameters, all other
+// YAML files contain a single subscription each.
+const GlobalParametersFile = "global-parameters"
+
+type yamlStore struct {
+	directory string
+	overlay   Store
+	validate  func(SubscriptionRecord) error
+
+	globalParameters map[string]any
+	subscriptions    map[string]SubscriptionRecord
+	mu               sync.RWMutex
+
+	listeners listeners
+	watcher   *fsnotify.Watcher
+}
+
+// YAML creates a read-only store that loads subscriptions and global parameters from a directory of YAML files, and
+// reloads them when the directory changes. Subscriptions are identified by their id, which defaults to the file name
+// without extension.
+//
+// When an overlay store is given, the subscriptions and global parameters of both stores are combined. Everything
+// that's defined in YAML is read-only, other changes are made in the overlay. Secrets are always kept in the overlay.
+func YAML(directory string, overlay Store, validate func(SubscriptionRecord) error) (Store, error) {
+	store := &yamlStore{
+		directory: directory,
+		overlay:   overlay,
+		validate:  validate,
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	if err := store.watch(); err != nil {
+		return nil, fmt.Errorf("unable to watch yaml directory: %w", err)
+	}
+
+	if overlay != nil {
+		overlay.OnChange(store.listeners.notify)
+	}
+
+	return store, nil
+}
+
+func (s *yamlStore) AddSubscription(sub SubscriptionRecord) (SubscriptionRecord, error) {
+	if s.overlay == nil || s.isYAMLSubscription(sub.ID) {
+		return SubscriptionRecord{}, ErrReadOnly
+	}
+
+	return s.overlay.AddSubscription(sub)
+}
+
+func (s *yamlStore) GetSubscription(id string) (SubscriptionRecord, error) {
+	s.mu.RLock()
+	sub, ok := s.subscriptions[id]
+	s.mu.RUnlock()
+
+	if ok {
+		return sub, nil
+	}
+
+	if s.overlay == nil {
+		return SubscriptionRecord{}, ErrSubscriptionNotFound
+	}
+
+	return s.overlay.GetSubscription(id)
+}
+
+func (s *yamlStore) GetSubscriptions() ([]SubscriptionRecord, error) {
+	s.mu.RLock()
+	subscriptions := slices.Collect(maps.Values(s.subscriptions))
+	s.mu.RUnlock()
+
+	if s.overlay == nil {
+		return subscriptions, nil
+	}
+
+	overlaid, err := s.overlay.GetSubscriptions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range overlaid {
+		if !s.isYAMLSubscription(sub.ID) {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+
+	return subscriptions, nil
+}
+
+func (s *yamlStore) UpdateSubscription(sub SubscriptionRecord) (SubscriptionRecord, error) {
+	if s.overlay == nil || s.isYAMLSubscription(sub.ID) {
+		return SubscriptionRecord{}, ErrReadOnly
+	}
+
+	return s.overlay.UpdateSubscription(sub)
+}
+
+func (s *yamlStore) DeleteSubscription(id string) error {
+	if s.overlay == nil || s.isYAMLSubscription(id) {
+		return ErrReadOnly
+	}
+
+	return s.overlay.DeleteSubscription(id)
+}
+
+// Blueprints are only kept in the overlay, YAML subscriptions can refer to them.
+
+func (s *yamlStore) AddBlueprint(blueprint BlueprintRecord) (BlueprintRecord, error) {
+	if s.overlay == nil {
+		return BlueprintRecord{}, ErrReadOnly
+	}
+
+	return s.overlay.AddBlueprint(blueprint)
+}
+
+func (s *yamlStore) GetBlueprint(id string) (BlueprintRecord, error) {
+	if s.overlay == nil {
+		return BlueprintRecord{}, ErrBlueprintNotFound
+	}
+
+	return s.overlay.GetBlueprint(id)
+}
+
+func (s *yamlStore) GetBlueprints() ([]BlueprintRecord, error) {
+	if s.overlay == nil {
+		return nil, nil
+	}
+
+	return s.overlay.GetBlueprints()
+}
+
+func (s *yamlStore) UpdateBlueprint(blueprint BlueprintRecord) (BlueprintRecord, error) {
+	if s.overlay == nil {
+		return BlueprintRecord{}, ErrReadOnly
+	}
+
+	return s.overlay.UpdateBlueprint(blueprint)
+}
+
+func (s *yamlStore) DeleteBlueprint(id string) error {
+	if s.overlay == nil {
+		return ErrReadOnly
+	}
+
+	return s.overlay.DeleteBlueprint(id)
+}
+
+func (s *yamlStore) SetGlobalParameter(key string, value any) error {
+	if s.overlay == nil || s.isYAMLGlobalParameter(key) {
+		return ErrReadOnly
+	}
+
+	return s.overlay.SetGlobalParameter(key, value)
+}
+
+func (s *yamlStore) GetGlobalParameters() (map[string]any, error) {
+	params := make(map[string]any)
+
+	if s.overlay != nil {
+		overlaid, err := s.overlay.GetGlobalParameters()
+
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(params, overlaid)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	maps.Copy(params, s.globalParameters)
+
+	return params, nil
+}
+
+func (s *yamlStore) DeleteGlobalParameter(key string) error {
+	if s.overlay == nil || s.isYAMLGlobalParameter(key) {
+		return ErrReadOnly
+	}
+
+	return s.overlay.DeleteGlobalParameter(key)
+}
+
+func (s *yamlStore) SetSecret(key string, value string) error {
+	if s.overlay == nil {
+		return ErrReadOnly
+	}
+
+	return s.overlay.SetSecret(key, value)
+}
+
+func (s *yamlStore) GetSecrets() (map[string]string, error) {
+	if s.overlay == nil {
+		return map[string]string{}, nil
+	}
+
+	return s.overlay.GetSecrets()
+}
+
+func (s *yamlStore) DeleteSecret(key string) error {
+	if s.overlay == nil {
+		return ErrReadOnly
+	}
+
+	return s.overlay.DeleteSecret(key)
+}
+
+func (s *yamlStore) AddRevision(revision RevisionRecord) error {
+	if s.overlay == nil {
+		return ErrReadOnly
+	}
+
+	return s.overlay.AddRevision(revision)
+}
+
+// GetRevisions only returns revisions of subscriptions in the overlay, the history of YAML files is kept in git.
+func (s *yamlStore) GetRevisions(subscriptionID string) ([]RevisionRecord, error) {
+	if s.overlay == nil {
+		return nil, nil
+	}
+
+	return s.overlay.GetRevisions(subscriptionID)
+}
+
+func (s *yamlStore) AddAuditEntry(entry AuditRecord) error {
+	if s.overlay == nil {
+		return ErrReadOnly
+	}
+
+	return s.overlay.AddAuditEntry(entry)
+}
+
+func (s *yamlStore) GetAuditEntries() ([]AuditRecord, error) {
+	if s.overlay == nil {
+		return nil, nil
+	}
+
+	return s.overlay.GetAuditEntries()
+}
+
+// Apply fails when any of the changes is to something defined in YAML, all changes are made in the overlay.
+func (s *yamlStore) Apply(changes Changes) error {
+	if s.overlay == nil {
+		return ErrReadOnly
+	}
+
+	for _, id := range slices.Concat(changes.DeletedSubscriptions, subscriptionIDs(changes.Subscriptions)) {
+		if s.isYAMLSubscription(id) {
+			return fmt.Errorf("%w: subscription %s", ErrReadOnly, id)
+		}
+	}
+
+	for _, key := range slices.Concat(changes.DeletedGlobalParameters, slices.Collect(maps.Keys(changes.GlobalParameters))) {
+		if s.isYAMLGlobalParameter(key) {
+			return fmt.Errorf("%w: global parameter %s", ErrReadOnly, key)
+		}
+	}
+
+	return s.overlay.Apply(changes)
+}
+
+func (s *yamlStore) OnChange(listener func()) {
+	s.listeners.add(listener)
+}
+
+// Close stops watching the directory and closes the overlay.
+func (s *yamlStore) Close() error {
+	if s.watcher != nil {
+		_ = s.watcher.Close()
+	}
+
+	if s.overlay != nil {
+		return s.overlay.Close()
+	}
+
+	return nil
+}
+
+func (s *yamlStore) isYAMLSubscription(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.subscriptions[id]
+
+	return ok
+}
+
+func (s *yamlStore) isYAMLGlobalParameter(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.globalParameters[key]
+
+	return ok
+}
+
+func subscriptionIDs(subscriptions []SubscriptionRecord) []string {
+	ids := make([]string, 0, len(subscriptions))
+
+	for _, sub := range subscriptions {
+		ids = append(ids, sub.ID)
+	}
+
+	return ids
+}
+
+// yamlSubscription is a subscription as written in a YAML file, the body is named as in the API.
+type yamlSubscription struct {
+	SubscriptionRecord
+	// Body takes the place of template, which is still accepted for files written before
+	Body string `json:"body"`
+}
+
+func (f yamlSubscription) record() (SubscriptionRecord, error) {
+	sub := f.SubscriptionRecord
+
+	if f.Body != "" {
+		if sub.Body != "" {
+			return SubscriptionRecord{}, errors.New("body and template can't both be set")
+		}
+
+		sub.Body = f.Body
+	}
+
+	return sub, nil
+}
+
+// load reads and validates all files in the directory, the current state is only replaced when all files are valid.
+func (s *yamlStore) load() error {
+	entries, err := os.ReadDir(s.directory)
+
+	if err != nil {
+		return err
+	}
+
+	globalParameters := make(map[string]any)
+	subscriptions := make(map[string]SubscriptionRecord)
+	sources := make(map[string]string)
+
+	var errs []error
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		filename := filepath.Join(s.directory, entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+
+		if name == GlobalParametersFile {
+			if err := decodeYAMLFile(filename, &globalParameters); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+			}
+
+			continue
+		}
+
+		var file yamlSubscription
+
+		if err := decodeYAMLFile(filename, &file); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+			continue
+		}
+
+		sub, err := file.record()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+			continue
+		}
+
+		if sub.ID == "" {
+			sub.ID = name
+		}
+
+		if other, ok := sources[sub.ID]; ok {
+			errs = append(errs, fmt.Errorf("%s: id %s is already used in %s", entry.Name(), sub.ID, other))
+			continue
+		}
+
+		if s.validate != nil {
+			if err := s.validate(sub); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+				continue
+			}
+		}
+
+		subscriptions[sub.ID] = sub
+		sources[sub.ID] = entry.Name()
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidYAML, errors.Join(errs...))
+	}
+
+	s.mu.Lock()
+	s.globalParameters = globalParameters
+	s.subscriptions = subscriptions
+	s.mu.Unlock()
+
+	return nil
+}
+
+// watch reloads the directory whenever a file in it changes.
+func (s *yamlStore) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(s.directory); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	s.watcher = watcher
+
+	reload := func() {
+		if err := s.load(); err != nil {
+			log.Printf("Failed to reload yaml directory, keeping the previous state: %v\n", err)
+			return
+		}
+
+		log.Printf("Reloaded yaml directory %s\n", s.directory)
+		s.listeners.notify()
+	}
+
+	go func() {
+		var debounce *time.Timer
+
+		for {
+			select {
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// Saving several files (e.g. a git checkout) results in a burst of events, wait for them to settle.
+				if debounce != nil {
+					debounce.Stop()
+				}
+
+				debounce = time.AfterFunc(reloadDebounce, reload)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				log.Printf("Error watching yaml directory: %v\n", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// decodeYAMLFile decodes the YAML file into v using its JSON field names, rejecting unknown fields.
+func decodeYAMLFile(filename string, v any) error {
+	contents, err := os.ReadFile(filename)
+
+	if err != nil {
+		return err
+	}
+
+	var document any
+
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return err
+	}
+
+	if document == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(document)
+
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(v)
+}
@@ -0,0 +1,117 @@
+package datastore
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeYAMLFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+}
+
+func TestYAMLStore(t *testing.T) {
+	dir := t.TempDir()
+	writeYAMLFiles(t, dir, map[string]string{
+		"kitchen.yaml":           "name: Kitchen\ntopic: home/kitchen\nmethod: POST\nurl: https://example.com\nextract:\n  temp: temperature\n",
+		"global-parameters.yaml": "room: kitchen\nlimits:\n  max: 25\n",
+		"README.md":              "not a subscription",
+	})
+
+	t.Run("Subscriptions and global parameters are loaded", func(t *testing.T) {
+		store, err := YAML(dir, nil, nil)
+		assert.NoError(t, err)
+
+		sub, err := store.GetSubscription("kitchen")
+		assert.NoError(t, err)
+		assert.Equal(t, "home/kitchen", sub.Topic)
+		assert.Equal(t, map[string]string{"temp": "temperature"}, sub.Extract)
+
+		params, _ := store.GetGlobalParameters()
+		assert.Equal(t, map[string]any{"room": "kitchen", "limits": map[string]any{"max": float64(25)}}, params)
+
+		_, err = store.AddSubscription(SubscriptionRecord{ID: "new"})
+		assert.ErrorIs(t, err, ErrReadOnly)
+		assert.ErrorIs(t, store.SetGlobalParameter("other", "x"), ErrReadOnly)
+	})
+
+	t.Run("Overlay combines both stores", func(t *testing.T) {
+		overlay, _ := Memory()
+		store, err := YAML(dir, overlay, nil)
+		assert.NoError(t, err)
+
+		_, err = store.AddSubscription(SubscriptionRecord{ID: "api"})
+		assert.NoError(t, err)
+		assert.ErrorIs(t, store.DeleteSubscription("kitchen"), ErrReadOnly)
+		assert.ErrorIs(t, store.SetGlobalParameter("room", "hallway"), ErrReadOnly)
+		assert.NoError(t, store.SetGlobalParameter("other", "x"))
+
+		subs, _ := store.GetSubscriptions()
+		assert.Len(t, subs, 2)
+
+		params, _ := store.GetGlobalParameters()
+		assert.Equal(t, "x", params["other"])
+	})
+
+	t.Run("Invalid files are rejected", func(t *testing.T) {
+		_, err := YAML(dir, nil, func(sub SubscriptionRecord) error {
+			return errors.New("invalid subscription")
+		})
+		assert.ErrorIs(t, err, ErrInvalidYAML)
+		assert.ErrorContains(t, err, "kitchen.yaml: invalid subscription")
+
+		invalid := t.TempDir()
+		writeYAMLFiles(t, invalid, map[string]string{"typo.yaml": "name: Typo\ntopics: home/#\n"})
+
+		_, err = YAML(invalid, nil, nil)
+		assert.ErrorContains(t, err, `unknown field "topics"`)
+	})
+
+	t.Run("The body is named as in the API", func(t *testing.T) {
+		bodies := t.TempDir()
+		writeYAMLFiles(t, bodies, map[string]string{
+			"body.yaml":     "name: Body\ntopic: home/#\nbody: '{{ .meta.payload }}'\n",
+			"template.yaml": "name: Template\ntopic: home/#\ntemplate: '{{ .meta.topic }}'\n",
+		})
+
+		store, err := YAML(bodies, nil, nil)
+		assert.NoError(t, err)
+
+		sub, _ := store.GetSubscription("body")
+		assert.Equal(t, "{{ .meta.payload }}", sub.Body)
+
+		sub, _ = store.GetSubscription("template")
+		assert.Equal(t, "{{ .meta.topic }}", sub.Body)
+
+		writeYAMLFiles(t, bodies, map[string]string{"both.yaml": "name: Both\ntopic: home/#\nbody: a\ntemplate: b\n"})
+
+		_, err = YAML(bodies, nil, nil)
+		assert.ErrorContains(t, err, "both.yaml: body and template can't both be set")
+	})
+}
+
+func TestYAMLStoreReloads(t *testing.T) {
+	dir := t.TempDir()
+	store, err := YAML(dir, nil, nil)
+	assert.NoError(t, err)
+
+	changed := make(chan struct{}, 10)
+	store.OnChange(func() { changed <- struct{}{} })
+
+	writeYAMLFiles(t, dir, map[string]string{"hallway.yml": "id: hall\nname: Hallway\ntopic: home/hallway\n"})
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change was not picked up")
+	}
+
+	sub, err := store.GetSubscription("hall")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hallway", sub.Name)
+}
@@ -0,0 +1,69 @@
+package deadletter
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultSize = 100
+
+// Queue keeps the most recent messages that could not be processed for subscriptions with the dead-letter error
+// policy, so they can be inspected through the API.
+type Queue interface {
+	Add(entry Entry)
+	List() []Entry
+}
+
+type Entry struct {
+	SubscriptionID   string    `json:"subscriptionId"`
+	SubscriptionName string    `json:"subscriptionName"`
+	Server           string    `json:"server"`
+	Topic            string    `json:"topic"`
+	Payload          string    `json:"payload"`
+	Stage            string    `json:"stage"`
+	Error            string    `json:"error"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+func New() Queue {
+	return &queue{
+		entries: make([]Entry, 0, defaultSize),
+		size:    defaultSize,
+	}
+}
+
+type queue struct {
+	entries []Entry
+	size    int
+
+	mu sync.RWMutex
+}
+
+func (q *queue) Add(entry Entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	q.entries = append(q.entries, entry)
+
+	if len(q.entries) > q.size {
+		q.entries = q.entries[len(q.entries)-q.size:]
+	}
+}
+
+func (q *queue) List() []Entry {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	entries := make([]Entry, len(q.entries))
+
+	// Most recent first
+	for idx, entry := range q.entries {
+		entries[len(q.entries)-1-idx] = entry
+	}
+
+	return entries
+}
@@ -5,8 +5,10 @@ import (
 	"mqtt-http-bridge/src/subscription"
 )
 
+var devActor = subscription.Actor{Name: "dev"}
+
 func PopulateDataStore(service subscription.Service, logger *log.Logger) error {
-	if err := service.Reset(); err != nil {
+	if err := service.Reset(devActor); err != nil {
 		return err
 	}
 
@@ -26,7 +28,7 @@ func PopulateDataStore(service subscription.Service, logger *log.Logger) error {
 }
 
 func addGlobalVariable(service subscription.Service, name, value string) error {
-	return service.SetGlobalParameter(name, value)
+	return service.SetGlobalParameter(name, value, devActor)
 }
 
 func addSubscription(service subscription.Service) (subscription.Subscription, error) {
@@ -45,7 +47,7 @@ func addSubscription(service subscription.Service) (subscription.Subscription, e
 			"Authorization": "Bearer 123",
 			"Content-Type":  "application/json",
 		},
-	})
+	}, devActor)
 
 	if err != nil {
 		return subscription.Subscription{}, err
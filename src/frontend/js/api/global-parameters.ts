@@ -1,9 +1,15 @@
 import { z } from 'zod';
 import { apiErrorFromResponse, AsyncMaybeAPIError, responseParseError } from './common';
 
-const globalParametersSchema = z.record(z.string(), z.string());
+// Parameters can be any JSON value, non-string values are represented as JSON for display and editing.
+const globalParametersSchema = z.record(z.string(), z.unknown())
+    .transform((parameters) => Object.fromEntries(
+        Object.entries(parameters).map(([ key, value ]) => [ key, typeof value === 'string' ? value : JSON.stringify(value) ]),
+    ));
 const globalParametersResponseSchema = z.object({
     parameters: globalParametersSchema,
+    secrets: z.record(z.string(), z.string()).optional(),
+    readOnly: z.array(z.string()).optional(),
 }).strict();
 
 export type GlobalParameters = z.infer<typeof globalParametersSchema>;
@@ -24,7 +30,7 @@ export const fetchGlobalParameters = async (): AsyncMaybeAPIError<GlobalParamete
     return [ parsedResponse.data.parameters, null ];
 }
 
-export const setGlobalParameter = async (key: string, value: string): AsyncMaybeAPIError<string> => {
+export const setGlobalParameter = async (key: string, value: unknown): AsyncMaybeAPIError<string> => {
     const response = await fetch('/api/v1/global-parameters', {
         method: 'POST',
         headers: {
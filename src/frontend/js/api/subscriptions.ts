@@ -3,14 +3,25 @@ import { z } from 'zod';
 
 const subscriptionSchema = z.object({
     id: z.string().uuid(),
+    version: z.number().int(),
     name: z.string().min(1),
     topic: z.string().min(1),
+    tags: z.array(z.string()).optional(),
+    group: z.string().optional(),
+    enabled: z.boolean().optional(),
+    blueprintId: z.string().optional(),
+    parameters: z.record(z.string(), z.string()).optional(),
+    payloadFormat: z.enum([ 'json', 'text', 'number', 'csv', 'cbor', 'msgpack', 'base64' ]).optional(),
     extract: z.record(z.string(), z.string()).optional(),
     filter: z.string().optional(),
+    skipRetained: z.boolean().optional(),
+    strictPlaceholders: z.boolean().optional(),
+    errorPolicy: z.enum([ 'fail-open', 'fail-closed', 'dead-letter' ]).optional(),
     method: z.enum([ 'GET', 'POST', 'PATCH', 'PUT', 'DELETE', 'HEAD', 'OPTIONS' ]),
     url: z.string(),
     headers: z.record(z.string(), z.string()).optional(),
     body: z.string().optional(),
+    bodyMode: z.enum([ 'template', 'json', 'jsonata' ]).optional(),
 }).strict();
 
 const subscriptionResponseSchema = z.object({
@@ -19,10 +30,11 @@ const subscriptionResponseSchema = z.object({
 
 const subscriptionsResponseSchema = z.object({
     subscriptions: z.array(subscriptionSchema),
+    total: z.number().int(),
 });
 
 export type Subscription = z.infer<typeof subscriptionSchema>;
-export type SubscriptionWithoutID = Omit<Subscription, 'id'>;
+export type SubscriptionWithoutID = Omit<Subscription, 'id' | 'version'>;
 export type SubscriptionResponse = z.infer<typeof subscriptionResponseSchema>; // Single subscription
 export type SubscriptionsResponse = z.infer<typeof subscriptionsResponseSchema>; // Multiple subscriptions
 
@@ -81,11 +93,13 @@ export const createSubscription = async (subscription: SubscriptionWithoutID): A
     return [ parsedResponse.data.subscription, null ];
 }
 
-export const updateSubscription = async ({ id, ...subscription }: Subscription): AsyncMaybeAPIError<Subscription> => {
+// The update is rejected when the subscription has been changed by someone else since this version was fetched.
+export const updateSubscription = async ({ id, version, ...subscription }: Subscription): AsyncMaybeAPIError<Subscription> => {
     const response = await fetch(`/api/v1/subscriptions/${ id }`, {
         method: 'PUT',
         headers: {
             'Content-Type': 'application/json',
+            'If-Match': `"${ version }"`,
         },
         body: JSON.stringify(subscription),
     });
@@ -103,9 +117,12 @@ export const updateSubscription = async ({ id, ...subscription }: Subscription):
     return [ parsedResponse.data.subscription, null ];
 }
 
-export const deleteSubscription = async (id: string): AsyncMaybeAPIError<void> => {
+export const deleteSubscription = async (id: string, version: number): AsyncMaybeAPIError<void> => {
     const response = await fetch(`/api/v1/subscriptions/${ id }`, {
         method: 'DELETE',
+        headers: {
+            'If-Match': `"${ version }"`,
+        },
     });
 
     if (response.status !== 200) {
@@ -7,8 +7,11 @@ import { useLocalStorage } from 'usehooks-ts';
 
 type SocketMessage = {
     payload: string;
+    payloadEncoding?: 'base64';
     topic: string;
     server: string;
+    qos: number;
+    retain: boolean;
     user: string;
     sequence: number;
     timestamp: string;
@@ -34,7 +34,7 @@ export const Parameter = () => {
 
     const saveAction = () => {
         const onSuccess = () => navigate('/parameters');
-        const doSave = (after: () => void) => saveParameter.mutate({ key, value }, { onSuccess: after });
+        const doSave = (after: () => void) => saveParameter.mutate({ key, value: parseValue(value) }, { onSuccess: after });
 
         if (initialKey && initialKey !== key) {
             deleteParameter.mutate({ key: initialKey }, { onSuccess: () => doSave(onSuccess) });
@@ -73,3 +73,14 @@ export const Parameter = () => {
         </div>
     );
 }
+
+// Values that look like JSON objects, arrays, numbers or booleans are stored typed, anything else is stored as string.
+const parseValue = (value: string): unknown => {
+    try {
+        const parsed = JSON.parse(value);
+
+        return typeof parsed === 'string' ? value : parsed;
+    } catch {
+        return value;
+    }
+}
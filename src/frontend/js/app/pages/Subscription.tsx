@@ -41,9 +41,17 @@ export const Subscription = ({ mode }: Props) => {
         extract: [],
         global: [],
         meta: [
+            'server',
             'topic',
             'client',
+            'clientId',
             'payload',
+            'qos',
+            'retain',
+            'packetId',
+            'contentType',
+            'responseTopic',
+            'userProperties',
         ],
     });
 
@@ -95,6 +103,8 @@ export const Subscription = ({ mode }: Props) => {
     }
 
     const buildSubscriptionObject = (): APISubscription => ( {
+        // Keep properties that can't be edited in this form.
+        ...subscription,
         name,
         topic,
         extract,
@@ -109,7 +119,7 @@ export const Subscription = ({ mode }: Props) => {
         if (mode === 'new' || mode === 'copy') {
             createSubscription.mutate({ subscription: buildSubscriptionObject() });
         } else {
-            updateSubscription.mutate({ id: id!, subscription: buildSubscriptionObject() });
+            updateSubscription.mutate({ id: id!, version: subscription!.version, subscription: buildSubscriptionObject() });
         }
     }
 
@@ -131,7 +141,7 @@ export const Subscription = ({ mode }: Props) => {
                     title: 'Delete',
                     onClick: () => {
                         if (confirm('Are you sure you want to delete this subscription?')) {
-                            deleteSubscription.mutate({ id: id! }, { onSuccess: afterSave });
+                            deleteSubscription.mutate({ id: id!, version: subscription!.version }, { onSuccess: afterSave });
                         }
                     }
                 } : undefined}
@@ -49,7 +49,13 @@ const SubscriptionItem = ({ subscription }: { subscription: Subscription }) => {
             <div className="min-w-0">
                 <div className="flex items-start gap-x-3">
                     <p className="text-sm/6 font-semibold text-gray-900">{ subscription.name }</p>
-                    <p className="mt-0.5 whitespace-nowrap rounded-md bg-green-50 px-1.5 py-0.5 text-xs font-medium text-green-700 ring-1 ring-inset ring-green-600/20">Active</p>
+                    { subscription.enabled !== false
+                        ? <p className="mt-0.5 whitespace-nowrap rounded-md bg-green-50 px-1.5 py-0.5 text-xs font-medium text-green-700 ring-1 ring-inset ring-green-600/20">Active</p>
+                        : <p className="mt-0.5 whitespace-nowrap rounded-md bg-gray-50 px-1.5 py-0.5 text-xs font-medium text-gray-600 ring-1 ring-inset ring-gray-500/10">Disabled</p>
+                    }
+                    { subscription.tags?.map(tag => (
+                        <p key={ tag } className="mt-0.5 whitespace-nowrap rounded-md bg-blue-50 px-1.5 py-0.5 text-xs font-medium text-blue-700 ring-1 ring-inset ring-blue-700/10">{ tag }</p>
+                    )) }
                 </div>
                 <div className="mt-1 flex items-center gap-x-2 text-xs/5 text-gray-500">
                     <p className="whitespace-nowrap js-subscription-id flex items-center gap-x-1 cursor-pointer">{ subscription.id }</p>
@@ -82,7 +88,7 @@ const SubscriptionItem = ({ subscription }: { subscription: Subscription }) => {
                            id="options-menu-0-item-0">Duplicate</Link>
                         <Link onClick={ (e) => {
                             e.preventDefault();
-                            deleteSubscription.mutate({ id: subscription.id })
+                            deleteSubscription.mutate({ id: subscription.id, version: subscription.version })
                         }} to="#" className="block px-3 py-1 text-sm/6 text-red-900 js-delete-subscription"
                            role="menuitem" tabIndex={ -1 } id="options-menu-0-item-2">Delete</Link>
                     </div>
@@ -8,7 +8,7 @@ export const useSetGlobalParameter = ({ onSuccess }: { onSuccess?: () => void })
     const queryClient = useQueryClient();
 
     return useMutation({
-        mutationFn: async ({ key, value }: { key: string, value: string }): Promise<string> => {
+        mutationFn: async ({ key, value }: { key: string, value: unknown }): Promise<string> => {
             return unpackMaybeAPIError(await setGlobalParameter(key, value));
         },
         onError: (error: ApiRequestError) => {
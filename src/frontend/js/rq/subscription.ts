@@ -34,8 +34,8 @@ export const useDeleteSubscription = () => {
     const queryClient = useQueryClient();
 
     return useMutation({
-        mutationFn: async ({ id }: { id: string }): Promise<void> => {
-            return unpackMaybeAPIError(await deleteSubscription(id));
+        mutationFn: async ({ id, version }: { id: string, version: number }): Promise<void> => {
+            return unpackMaybeAPIError(await deleteSubscription(id, version));
         },
         onSuccess: (_, { id }) => {
             queryClient.invalidateQueries({ queryKey: listSubscriptionsQueryKey() });
@@ -67,8 +67,8 @@ export const useUpdateSubscription = ({ onSuccess }: { onSuccess?: () => void})
     const queryClient = useQueryClient();
 
     return useMutation({
-        mutationFn: async ({ id, subscription }: { id: string, subscription: SubscriptionWithoutID }): Promise<Subscription> => {
-            return unpackMaybeAPIError(await updateSubscription({ id, ...subscription }));
+        mutationFn: async ({ id, version, subscription }: { id: string, version: number, subscription: SubscriptionWithoutID }): Promise<Subscription> => {
+            return unpackMaybeAPIError(await updateSubscription({ ...subscription, id, version }));
         },
         onSuccess: ({ id }) => {
             queryClient.invalidateQueries({ queryKey: listSubscriptionsQueryKey() });
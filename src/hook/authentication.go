@@ -9,6 +9,9 @@ import (
 type AuthHookInterface interface {
 	mqtt.Hook
 	AddUser(username, password string)
+	// Update replaces the users and whether authentication is required, and returns a check reporting whether a client
+	// that authenticated before the update lost its access.
+	Update(open bool, users map[string]string) (revoked func(username string) bool)
 }
 
 func Authentication(open bool) AuthHookInterface {
@@ -41,6 +44,35 @@ func (a *authHook) AddUser(username, password string) {
 	a.users[username] = user{username: username, password: password}
 }
 
+func (a *authHook) Update(open bool, users map[string]string) func(username string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	wasOpen, previous := a.open, a.users
+
+	a.open = open
+	a.users = make(map[string]user, len(users))
+
+	for username, password := range users {
+		a.users[username] = user{username: username, password: password}
+	}
+
+	return func(username string) bool {
+		if open {
+			return false
+		}
+
+		// Clients connected without authentication have to authenticate now.
+		if wasOpen {
+			return true
+		}
+
+		u, ok := users[username]
+
+		return !ok || u != previous[username].password
+	}
+}
+
 func (a *authHook) ID() string {
 	return "auth-hook"
 }
@@ -50,13 +82,13 @@ func (a *authHook) OnACLCheck(cl *mqtt.Client, topic string, write bool) bool {
 }
 
 func (a *authHook) OnConnectAuthenticate(cl *mqtt.Client, pk packets.Packet) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	if a.open {
 		return true
 	}
 
-	a.mu.RLock()
-	defer a.mu.RUnlock()
-
 	u, ok := a.users[string(cl.Properties.Username)]
 
 	if !ok {
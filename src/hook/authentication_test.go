@@ -0,0 +1,49 @@
+package hook
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAuthHookUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		wasOpen  bool
+		previous map[string]string
+		open     bool
+		users    map[string]string
+		username string
+		revoked  bool
+	}{
+		{name: "unchanged", previous: map[string]string{"alice": "secret"}, users: map[string]string{"alice": "secret"}, username: "alice"},
+		{name: "password changed", previous: map[string]string{"alice": "secret"}, users: map[string]string{"alice": "other"}, username: "alice", revoked: true},
+		{name: "user removed", previous: map[string]string{"alice": "secret", "bob": "secret"}, users: map[string]string{"bob": "secret"}, username: "alice", revoked: true},
+		{name: "other user changed", previous: map[string]string{"alice": "secret", "bob": "secret"}, users: map[string]string{"alice": "secret", "bob": "other"}, username: "alice"},
+		{name: "open to closed", wasOpen: true, users: map[string]string{"alice": "secret"}, username: "alice", revoked: true},
+		{name: "closed to open", previous: map[string]string{"alice": "secret"}, open: true, username: "alice"},
+		{name: "still open", wasOpen: true, open: true, username: "anonymous"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := Authentication(tt.wasOpen)
+
+			for username, password := range tt.previous {
+				auth.AddUser(username, password)
+			}
+
+			revoked := auth.Update(tt.open, tt.users)
+			assert.Equal(t, tt.revoked, revoked(tt.username))
+		})
+	}
+}
+
+func TestAuthHookUpdateReplacesUsers(t *testing.T) {
+	auth := Authentication(false)
+	auth.AddUser("alice", "secret")
+	auth.Update(false, map[string]string{"bob": "secret"})
+
+	hook := auth.(*authHook)
+	assert.Equal(t, map[string]user{"bob": {username: "bob", password: "secret"}}, hook.users)
+	assert.False(t, hook.open)
+}
@@ -4,6 +4,7 @@ import (
 	mqtt "github.com/mochi-mqtt/server/v2"
 	"github.com/mochi-mqtt/server/v2/packets"
 	"mqtt-http-bridge/src/processor"
+	"slices"
 )
 
 func ProcessorHook(processor processor.Processor) mqtt.Hook {
@@ -27,10 +28,27 @@ func (p *processorHook) Provides(b byte) bool {
 }
 
 func (p *processorHook) OnPublished(cl *mqtt.Client, pk packets.Packet) {
+	var userProperties map[string]string
+
+	if len(pk.Properties.User) > 0 {
+		userProperties = make(map[string]string, len(pk.Properties.User))
+
+		for _, prop := range pk.Properties.User {
+			userProperties[prop.Key] = prop.Val
+		}
+	}
+
 	p.processor.Process(processor.MQTTMessage{
-		Server:  processor.InternalBroker,
-		Topic:   pk.TopicName,
-		Payload: string(pk.Payload),
-		User:    string(cl.Properties.Username),
+		Server:         processor.InternalBroker,
+		Topic:          pk.TopicName,
+		Payload:        slices.Clone(pk.Payload),
+		QoS:            pk.FixedHeader.Qos,
+		Retain:         pk.FixedHeader.Retain,
+		PacketID:       pk.PacketID,
+		User:           string(cl.Properties.Username),
+		ClientID:       cl.ID,
+		ContentType:    pk.Properties.ContentType,
+		ResponseTopic:  pk.Properties.ResponseTopic,
+		UserProperties: userProperties,
 	})
 }
@@ -0,0 +1,59 @@
+package hook
+
+import (
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/processor"
+	"testing"
+)
+
+// recordingProcessor keeps the processed messages.
+type recordingProcessor struct {
+	processor.Processor
+	messages []processor.MQTTMessage
+}
+
+func (r *recordingProcessor) Process(message processor.MQTTMessage) {
+	r.messages = append(r.messages, message)
+}
+
+func TestProcessorHookOnPublished(t *testing.T) {
+	recorder := &recordingProcessor{}
+	hook := ProcessorHook(recorder)
+	client := &mqtt.Client{ID: "sensor-1", Properties: mqtt.ClientProperties{Username: []byte("alice")}}
+
+	pk := packets.Packet{
+		FixedHeader: packets.FixedHeader{Type: packets.Publish, Qos: 1, Retain: true},
+		TopicName:   "home/kitchen",
+		Payload:     []byte(`{"on": true}`),
+		PacketID:    7,
+		Properties: packets.Properties{
+			ContentType:   "application/json",
+			ResponseTopic: "home/kitchen/response",
+			User:          []packets.UserProperty{{Key: "room", Val: "kitchen"}, {Key: "room", Val: "pantry"}},
+		},
+	}
+
+	hook.OnPublished(client, pk)
+
+	if assert.Len(t, recorder.messages, 1) {
+		assert.Equal(t, processor.MQTTMessage{
+			Server:         processor.InternalBroker,
+			Topic:          "home/kitchen",
+			Payload:        []byte(`{"on": true}`),
+			QoS:            1,
+			Retain:         true,
+			PacketID:       7,
+			User:           "alice",
+			ClientID:       "sensor-1",
+			ContentType:    "application/json",
+			ResponseTopic:  "home/kitchen/response",
+			UserProperties: map[string]string{"room": "pantry"},
+		}, recorder.messages[0])
+	}
+
+	pk.Payload[1] = 'x'
+
+	assert.Equal(t, `{"on": true}`, string(recorder.messages[0].Payload), "The payload is copied, the packet buffer is reused")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"mqtt-http-bridge/src/cli"
 	"mqtt-http-bridge/src/config"
 	"mqtt-http-bridge/src/process"
 	"os"
@@ -11,6 +12,15 @@ import (
 func main() {
 	ctx := context.Background()
 
+	if cli.IsCommand(os.Args[1:]) {
+		if err := cli.Run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+			log.Printf("%s\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	cfg, err := config.Load()
 
 	if err != nil {
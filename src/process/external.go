@@ -0,0 +1,161 @@
+package process
+
+import (
+	mqtt2 "github.com/eclipse/paho.mqtt.golang"
+	"log"
+	"maps"
+	"mqtt-http-bridge/src/config"
+	"mqtt-http-bridge/src/processor"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// externalClients keeps the connections to the external brokers, so they can be changed when the config is reloaded.
+type externalClients struct {
+	proc    processor.Processor
+	clients map[string]externalClient
+	mu      sync.Mutex
+}
+
+type externalClient struct {
+	config config.ExternalBrokerConfig
+	// client is nil for brokers without topics
+	client mqtt2.Client
+}
+
+func newExternalClients(proc processor.Processor) *externalClients {
+	return &externalClients{
+		proc:    proc,
+		clients: make(map[string]externalClient),
+	}
+}
+
+// apply connects to the added brokers, disconnects from the removed ones and reconnects to the ones whose config
+// changed. It returns the names of the brokers that were changed.
+func (e *externalClients) apply(brokers map[string]config.ExternalBrokerConfig) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var changed []string
+
+	for _, name := range slices.Sorted(maps.Keys(e.clients)) {
+		current := e.clients[name]
+
+		if broker, ok := brokers[name]; ok && reflect.DeepEqual(broker, current.config) {
+			continue
+		}
+
+		disconnectExternalClient(name, current)
+		delete(e.clients, name)
+
+		if _, ok := brokers[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(brokers)) {
+		if _, ok := e.clients[name]; ok {
+			continue
+		}
+
+		e.clients[name] = externalClient{config: brokers[name], client: connectExternalClient(name, brokers[name], e.proc)}
+		changed = append(changed, name)
+	}
+
+	slices.Sort(changed)
+
+	return changed
+}
+
+func connectExternalClient(name string, broker config.ExternalBrokerConfig, proc processor.Processor) mqtt2.Client {
+	if len(broker.Topics) == 0 {
+		// No point in subscribing to nothing.
+		return nil
+	}
+
+	client := mqtt2.NewClient(externalClientOptions(name, broker, proc))
+
+	go func() {
+		token := client.Connect()
+
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Unable to connect to %s: %s\n", name, token.Error())
+		}
+	}()
+
+	return client
+}
+
+// externalClientOptions returns the options of the client for the broker, which subscribes to its topics whenever it
+// connects.
+func externalClientOptions(name string, broker config.ExternalBrokerConfig, proc processor.Processor) *mqtt2.ClientOptions {
+	onMessage := func(client mqtt2.Client, message mqtt2.Message) {
+		proc.Process(processor.MQTTMessage{
+			Server:   name,
+			Topic:    message.Topic(),
+			Payload:  message.Payload(),
+			QoS:      message.Qos(),
+			Retain:   message.Retained(),
+			PacketID: message.MessageID(),
+		})
+	}
+
+	opts := mqtt2.NewClientOptions().
+		AddBroker(broker.Host).
+		SetClientID(broker.ClientID).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(true).
+		SetCleanSession(!broker.PersistentSession).
+		SetResumeSubs(broker.PersistentSession).
+		SetKeepAlive(time.Duration(broker.KeepAlive) * time.Second).
+		// Messages queued in a persistent session can arrive before the subscriptions are (re-)established.
+		SetDefaultPublishHandler(onMessage).
+		SetOnConnectHandler(func(client mqtt2.Client) {
+			log.Printf("Connected to %s\n", name)
+
+			// Subscribing on every (re-)connect, since a clean session drops the subscriptions on the broker.
+			for _, topic := range broker.Topics {
+				token := client.Subscribe(topic.Topic, broker.TopicQoS(topic), onMessage)
+
+				if token.Wait() && token.Error() != nil {
+					log.Printf("Unable to subscribe to %s on %s: %s\n", topic.Topic, name, token.Error())
+				}
+			}
+
+			if broker.StatusTopic != "" {
+				client.Publish(broker.StatusTopic, 1, true, broker.StatusOnlinePayload)
+			}
+		})
+
+	if broker.Username != "" {
+		opts.SetUsername(broker.Username)
+	}
+
+	if broker.Password != "" {
+		opts.SetPassword(broker.Password)
+	}
+
+	if broker.StatusTopic != "" {
+		opts.SetWill(broker.StatusTopic, broker.StatusOfflinePayload, 1, true)
+	}
+
+	return opts
+}
+
+func disconnectExternalClient(name string, external externalClient) {
+	if external.client == nil {
+		return
+	}
+
+	// The last will isn't published on a clean disconnect, so the offline status is published before.
+	if external.config.StatusTopic != "" && external.client.IsConnectionOpen() {
+		external.client.Publish(external.config.StatusTopic, 1, true, external.config.StatusOfflinePayload).WaitTimeout(time.Second)
+	}
+
+	external.client.Disconnect(250)
+
+	log.Printf("Disconnected from %s\n", name)
+}
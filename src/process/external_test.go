@@ -0,0 +1,229 @@
+package process
+
+import (
+	mqtt2 "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/config"
+	"testing"
+)
+
+// fakeClient records whether it was disconnected, and what it subscribed to and published. The other methods aren't
+// used by the tests.
+type fakeClient struct {
+	mqtt2.Client
+	disconnected bool
+	subscribed   map[string]byte
+	published    []fakePublish
+}
+
+type fakePublish struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  any
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, _ mqtt2.MessageHandler) mqtt2.Token {
+	if c.subscribed == nil {
+		c.subscribed = make(map[string]byte)
+	}
+
+	c.subscribed[topic] = qos
+
+	return &mqtt2.DummyToken{}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload any) mqtt2.Token {
+	c.published = append(c.published, fakePublish{topic: topic, qos: qos, retained: retained, payload: payload})
+
+	return &mqtt2.DummyToken{}
+}
+
+func (c *fakeClient) IsConnectionOpen() bool {
+	return false
+}
+
+func (c *fakeClient) Disconnect(uint) {
+	c.disconnected = true
+}
+
+func TestExternalClientsApply(t *testing.T) {
+	// Brokers without topics aren't connected to, so the test doesn't need a broker.
+	kitchen := config.ExternalBrokerConfig{Name: "kitchen", Host: "tcp://kitchen:1883"}
+	garden := config.ExternalBrokerConfig{Name: "garden", Host: "tcp://garden:1883"}
+	moved := config.ExternalBrokerConfig{Name: "kitchen", Host: "tcp://kitchen.local:1883"}
+
+	tests := []struct {
+		name         string
+		current      map[string]config.ExternalBrokerConfig
+		next         map[string]config.ExternalBrokerConfig
+		changed      []string
+		disconnected []string
+	}{
+		{
+			name:    "unchanged brokers are kept",
+			current: map[string]config.ExternalBrokerConfig{"kitchen": kitchen, "garden": garden},
+			next:    map[string]config.ExternalBrokerConfig{"kitchen": kitchen, "garden": garden},
+		},
+		{
+			name:    "added brokers are connected",
+			current: map[string]config.ExternalBrokerConfig{"kitchen": kitchen},
+			next:    map[string]config.ExternalBrokerConfig{"kitchen": kitchen, "garden": garden},
+			changed: []string{"garden"},
+		},
+		{
+			name:         "removed brokers are disconnected",
+			current:      map[string]config.ExternalBrokerConfig{"kitchen": kitchen, "garden": garden},
+			next:         map[string]config.ExternalBrokerConfig{"kitchen": kitchen},
+			changed:      []string{"garden"},
+			disconnected: []string{"garden"},
+		},
+		{
+			name:         "changed brokers are reconnected",
+			current:      map[string]config.ExternalBrokerConfig{"kitchen": kitchen, "garden": garden},
+			next:         map[string]config.ExternalBrokerConfig{"kitchen": moved, "garden": garden},
+			changed:      []string{"kitchen"},
+			disconnected: []string{"kitchen"},
+		},
+		{
+			name:         "all brokers removed",
+			current:      map[string]config.ExternalBrokerConfig{"kitchen": kitchen, "garden": garden},
+			next:         map[string]config.ExternalBrokerConfig{},
+			changed:      []string{"garden", "kitchen"},
+			disconnected: []string{"garden", "kitchen"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			externals := newExternalClients(nil)
+			clients := make(map[string]*fakeClient)
+
+			for name, broker := range tt.current {
+				clients[name] = &fakeClient{}
+				externals.clients[name] = externalClient{config: broker, client: clients[name]}
+			}
+
+			assert.Equal(t, tt.changed, externals.apply(tt.next))
+
+			var disconnected []string
+
+			for _, name := range []string{"garden", "kitchen"} {
+				if client, ok := clients[name]; ok && client.disconnected {
+					disconnected = append(disconnected, name)
+				}
+			}
+
+			assert.Equal(t, tt.disconnected, disconnected)
+
+			for name, broker := range tt.next {
+				assert.Equal(t, broker, externals.clients[name].config)
+			}
+
+			assert.Len(t, externals.clients, len(tt.next))
+		})
+	}
+}
+
+func TestExternalClientOptions(t *testing.T) {
+	qos2 := byte(2)
+	base := config.ExternalBrokerConfig{
+		Host:                 "tcp://mqtt.example.com:1883",
+		ClientID:             "bridge",
+		Topics:               []config.ExternalBrokerTopic{{Topic: "home/#"}},
+		KeepAlive:            30,
+		StatusOnlinePayload:  "online",
+		StatusOfflinePayload: "offline",
+	}
+
+	tests := []struct {
+		name       string
+		change     func(b *config.ExternalBrokerConfig)
+		check      func(t *testing.T, opts *mqtt2.ClientOptions)
+		subscribed map[string]byte
+		published  []fakePublish
+	}{
+		{
+			name:   "defaults",
+			change: func(b *config.ExternalBrokerConfig) {},
+			check: func(t *testing.T, opts *mqtt2.ClientOptions) {
+				assert.Equal(t, "bridge", opts.ClientID)
+				assert.Equal(t, "mqtt.example.com:1883", opts.Servers[0].Host)
+				assert.True(t, opts.CleanSession)
+				assert.False(t, opts.ResumeSubs)
+				assert.Equal(t, int64(30), opts.KeepAlive)
+				assert.False(t, opts.WillEnabled)
+				assert.Empty(t, opts.Username)
+			},
+			subscribed: map[string]byte{"home/#": 0},
+		},
+		{
+			name: "qos per broker and topic",
+			change: func(b *config.ExternalBrokerConfig) {
+				b.QoS = 1
+				b.Topics = []config.ExternalBrokerTopic{{Topic: "home/#"}, {Topic: "alarm/#", QoS: &qos2}}
+			},
+			subscribed: map[string]byte{"home/#": 1, "alarm/#": 2},
+		},
+		{
+			name: "persistent session",
+			change: func(b *config.ExternalBrokerConfig) {
+				b.PersistentSession = true
+				b.KeepAlive = 60
+			},
+			check: func(t *testing.T, opts *mqtt2.ClientOptions) {
+				assert.False(t, opts.CleanSession)
+				assert.True(t, opts.ResumeSubs)
+				assert.Equal(t, int64(60), opts.KeepAlive)
+			},
+			subscribed: map[string]byte{"home/#": 0},
+		},
+		{
+			name: "status topic with last will",
+			change: func(b *config.ExternalBrokerConfig) {
+				b.StatusTopic = "bridge/status"
+			},
+			check: func(t *testing.T, opts *mqtt2.ClientOptions) {
+				assert.True(t, opts.WillEnabled)
+				assert.Equal(t, "bridge/status", opts.WillTopic)
+				assert.Equal(t, []byte("offline"), opts.WillPayload)
+				assert.Equal(t, byte(1), opts.WillQos)
+				assert.True(t, opts.WillRetained)
+			},
+			subscribed: map[string]byte{"home/#": 0},
+			published:  []fakePublish{{topic: "bridge/status", qos: 1, retained: true, payload: "online"}},
+		},
+		{
+			name: "credentials",
+			change: func(b *config.ExternalBrokerConfig) {
+				b.Username = "bridge"
+				b.Password = "secret"
+			},
+			check: func(t *testing.T, opts *mqtt2.ClientOptions) {
+				assert.Equal(t, "bridge", opts.Username)
+				assert.Equal(t, "secret", opts.Password)
+			},
+			subscribed: map[string]byte{"home/#": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := base
+			tt.change(&broker)
+
+			opts := externalClientOptions("home", broker, nil)
+
+			if tt.check != nil {
+				tt.check(t, opts)
+			}
+
+			// Subscribing and publishing the online status happen on every connect.
+			client := &fakeClient{}
+			opts.OnConnect(client)
+
+			assert.Equal(t, tt.subscribed, client.subscribed)
+			assert.Equal(t, tt.published, client.published)
+		})
+	}
+}
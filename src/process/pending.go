@@ -0,0 +1,101 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mqtt-http-bridge/src/publisher"
+	"mqtt-http-bridge/src/utilities"
+	"os"
+	"slices"
+)
+
+// savePendingDeliveries writes the jobs that weren't delivered before shutting down, so they're sent after the next
+// start, and returns how many were saved. The placeholders of the jobs are applied, including secrets, so the file is
+// encrypted with the secrets key when there is one. Without a key, the jobs containing the value of a secret (as
+// detected by redact) are left out.
+func savePendingDeliveries(filename string, secretsKey string, redact func(string) string, jobs []publisher.Job) (int, error) {
+	if secretsKey == "" {
+		jobs = slices.DeleteFunc(slices.Clone(jobs), func(job publisher.Job) bool { return containsSecret(job, redact) })
+	}
+
+	data, err := json.Marshal(jobs)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if secretsKey != "" {
+		encrypted, err := utilities.Encrypt(secretsKey, string(data))
+
+		if err != nil {
+			return 0, fmt.Errorf("unable to encrypt pending deliveries: %w", err)
+		}
+
+		data = []byte(encrypted)
+	}
+
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		return 0, err
+	}
+
+	// WriteFile keeps the permissions of an existing file.
+	if err := os.Chmod(filename, 0600); err != nil {
+		return 0, err
+	}
+
+	return len(jobs), nil
+}
+
+// containsSecret reports whether redact changes any part of the request of the job.
+func containsSecret(job publisher.Job, redact func(string) string) bool {
+	parts := []string{job.Subscription.URL, string(job.Body)}
+
+	for _, value := range job.Subscription.Headers {
+		parts = append(parts, value)
+	}
+
+	for _, part := range parts {
+		if redact(part) != part {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadPendingDeliveries reads and removes the jobs saved on the previous shutdown, a missing file has no jobs.
+func loadPendingDeliveries(filename string, secretsKey string) ([]publisher.Job, error) {
+	data, err := os.ReadFile(filename)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if secretsKey != "" {
+		decrypted, err := utilities.Decrypt(secretsKey, string(data))
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt pending deliveries: %w", err)
+		}
+
+		data = []byte(decrypted)
+	}
+
+	var jobs []publisher.Job
+
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("unable to decode pending deliveries: %w", err)
+	}
+
+	// Removed before the jobs are queued, they're saved again when they can't be delivered before the next shutdown.
+	if err := os.Remove(filename); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
@@ -0,0 +1,54 @@
+package process
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mqtt-http-bridge/src/publisher"
+	"mqtt-http-bridge/src/subscription"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPendingDeliveries(t *testing.T) {
+	redact := func(s string) string { return strings.ReplaceAll(s, "s3cr3t", "********") }
+
+	plain := publisher.Job{Body: []byte(`{"on":true}`), Subscription: subscription.Subscription{ID: "plain", URL: "https://example.com"}}
+	secret := publisher.Job{Body: []byte(`{"on":true}`), Subscription: subscription.Subscription{ID: "secret", URL: "https://example.com", Headers: map[string]string{"Authorization": "Bearer s3cr3t"}}}
+
+	tests := []struct {
+		name      string
+		secretKey string
+		saved     []publisher.Job
+	}{
+		{name: "encrypted with the secrets key", secretKey: "secret-key", saved: []publisher.Job{plain, secret}},
+		{name: "jobs with secrets are left out without a key", saved: []publisher.Job{plain}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "pending.json")
+
+			// An existing file with wider permissions is restricted.
+			require.NoError(t, os.WriteFile(filename, nil, 0644))
+
+			saved, err := savePendingDeliveries(filename, tt.secretKey, redact, []publisher.Job{plain, secret})
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.saved), saved)
+
+			info, err := os.Stat(filename)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+			contents, _ := os.ReadFile(filename)
+			assert.NotContains(t, string(contents), "s3cr3t")
+
+			jobs, err := loadPendingDeliveries(filename, tt.secretKey)
+			require.NoError(t, err)
+			assert.Equal(t, tt.saved, jobs)
+
+			assert.NoFileExists(t, filename, "Loaded deliveries are removed")
+		})
+	}
+}
@@ -2,8 +2,10 @@ package process
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	mqtt2 "github.com/eclipse/paho.mqtt.golang"
 	mqtt "github.com/mochi-mqtt/server/v2"
 	"github.com/mochi-mqtt/server/v2/listeners"
 	"io"
@@ -11,17 +13,18 @@ import (
 	"log/slog"
 	"mqtt-http-bridge/src/config"
 	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/deadletter"
 	"mqtt-http-bridge/src/dev"
 	"mqtt-http-bridge/src/hook"
 	"mqtt-http-bridge/src/processor"
 	"mqtt-http-bridge/src/publisher"
 	"mqtt-http-bridge/src/server"
 	"mqtt-http-bridge/src/subscription"
+	"mqtt-http-bridge/src/utilities"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 )
 
 func Start(ctx context.Context, cfg *config.Config, appStartErr chan error) {
@@ -39,15 +42,15 @@ func Start(ctx context.Context, cfg *config.Config, appStartErr chan error) {
 
 	logStartWithConfig(cfg, logger)
 
-	store, err := setUpStore(cfg)
+	utilities.AllowTemplateEnv(cfg.Templates.EnvAllowList...)
+
+	service, err := SetUpService(cfg)
 
 	if err != nil {
-		appStartErr <- fmt.Errorf("unable to load store: %w", err)
+		appStartErr <- err
 		return
 	}
 
-	service := subscription.NewService(store)
-
 	if cfg.IsDevelopment() && cfg.PrepareData {
 		logger.Println("Development mode detected, preparing data store.")
 
@@ -58,8 +61,11 @@ func Start(ctx context.Context, cfg *config.Config, appStartErr chan error) {
 	}
 
 	mqttMessageChan := make(chan processor.MQTTMessage, 100)
+	deadLetters := deadletter.New()
 
-	proc := processor.New(service, setUpPublisher(ctx, 10, logger), mqttMessageChan, logger)
+	// The publisher isn't stopped with the context, it's drained when shutting down.
+	pub := setUpPublisher(context.WithoutCancel(ctx), cfg.Publisher.Parallel, service.RedactSecrets, logger)
+	proc := processor.New(service, pub, mqttMessageChan, deadLetters, logger)
 
 	// Create signals channel to run broker until interrupted
 	sigs := make(chan os.Signal, 1)
@@ -83,11 +89,13 @@ func Start(ctx context.Context, cfg *config.Config, appStartErr chan error) {
 		ClientNetReadBufferSize:  4096,
 		SysTopicResendInterval:   10,
 		InlineClient:             false,
+		// Set as option, since the hooks take their logger from it.
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
 	})
 
-	broker.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	authHook, err := attachHooks(broker, proc, cfg)
 
-	if err := attachHooks(broker, proc, cfg); err != nil {
+	if err != nil {
 		appStartErr <- fmt.Errorf("unable to attach hooks: %w", err)
 		return
 	}
@@ -97,9 +105,24 @@ func Start(ctx context.Context, cfg *config.Config, appStartErr chan error) {
 		return
 	}
 
-	setUpExternalClients(cfg, proc)
+	externals := newExternalClients(proc)
+	externals.apply(cfg.ExternalBrokers)
+
+	queuePendingDeliveries(cfg, pub, logger)
+
+	reloader := &reloader{
+		current:   cfg,
+		service:   service,
+		broker:    broker,
+		authHook:  authHook,
+		externals: externals,
+		publisher: pub,
+		logger:    logger,
+	}
+
+	reloadOnHangup(reloader)
 
-	httpServer := setUpServer(service, mqttMessageChan, cfg)
+	httpServer := setUpServer(service, proc, mqttMessageChan, deadLetters, cfg)
 
 	go func() {
 		err := broker.Serve()
@@ -111,7 +134,7 @@ func Start(ctx context.Context, cfg *config.Config, appStartErr chan error) {
 
 	go func() {
 		err := httpServer.Start(fmt.Sprintf("%s:%d", cfg.Server.Address, cfg.Server.Port))
-		if err != nil {
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			appStartErr <- fmt.Errorf("unable to start httpServer: %w", err)
 			return
 		}
@@ -122,9 +145,42 @@ func Start(ctx context.Context, cfg *config.Config, appStartErr chan error) {
 	<-done
 
 	logger.Println("Shutting down MQTT forwarder...")
+
+	shutdown(reloader.config(), broker, httpServer, externals, proc, pub, service, logger)
+}
+
+// SetUpService creates the subscription service on top of the configured store.
+func SetUpService(cfg *config.Config) (subscription.Service, error) {
+	store, err := setUpStore(cfg)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to load store: %w", err)
+	}
+
+	service := subscription.NewService(store, cfg.Secrets.Key)
+
+	if err := loadConfiguredGlobalParameters(cfg, service); err != nil {
+		return nil, err
+	}
+
+	return service, nil
 }
 
-func attachHooks(server *mqtt.Server, processor processor.Processor, cfg *config.Config) error {
+func loadConfiguredGlobalParameters(cfg *config.Config, service subscription.Service) error {
+	params, err := cfg.ResolveGlobalParameters()
+
+	if err != nil {
+		return err
+	}
+
+	if err := service.SetConfiguredGlobalParameters(params); err != nil {
+		return fmt.Errorf("invalid global parameters in config: %w", err)
+	}
+
+	return nil
+}
+
+func attachHooks(server *mqtt.Server, processor processor.Processor, cfg *config.Config) (hook.AuthHookInterface, error) {
 	authHook := hook.Authentication(cfg.Broker.OpenAuth)
 
 	if !cfg.Broker.OpenAuth {
@@ -134,16 +190,16 @@ func attachHooks(server *mqtt.Server, processor processor.Processor, cfg *config
 	}
 
 	if err := server.AddHook(authHook, nil); err != nil {
-		return err
+		return nil, err
 	}
 
 	processorHook := hook.ProcessorHook(processor)
 
 	if err := server.AddHook(processorHook, nil); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return authHook, nil
 }
 
 func attachListeners(server *mqtt.Server, cfg *config.Config) error {
@@ -153,9 +209,89 @@ func attachListeners(server *mqtt.Server, cfg *config.Config) error {
 		return err
 	}
 
+	var tlsConfig *tls.Config
+
+	if cfg.Broker.TLS.Enabled || (cfg.Broker.WebSocket.Enabled && cfg.Broker.WebSocket.TLS) {
+		var err error
+
+		if tlsConfig, err = buildTLSConfig(cfg.Broker.TLS); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Broker.TLS.Enabled {
+		tlsListener := listeners.NewTCP(listeners.Config{
+			ID:        "tls1",
+			Address:   fmt.Sprintf("%s:%d", cfg.Broker.TLS.Address, cfg.Broker.TLS.Port),
+			TLSConfig: tlsConfig,
+		})
+
+		if err := server.AddListener(tlsListener); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Broker.WebSocket.Enabled {
+		wsConfig := listeners.Config{ID: "ws1", Address: fmt.Sprintf("%s:%d", cfg.Broker.WebSocket.Address, cfg.Broker.WebSocket.Port)}
+
+		if cfg.Broker.WebSocket.TLS {
+			wsConfig.TLSConfig = tlsConfig
+		}
+
+		if err := server.AddListener(listeners.NewWebsocket(wsConfig)); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Broker.UnixSocket.Enabled {
+		unix := listeners.NewUnixSock(listeners.Config{ID: "unix1", Address: cfg.Broker.UnixSocket.Path})
+
+		if err := server.AddListener(unix); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func buildTLSConfig(cfg config.BrokerTLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to load tls certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caCert, err := os.ReadFile(cfg.ClientCAFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read client ca file: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+
+	if !clientCAs.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no valid certificates found in client ca file %s", cfg.ClientCAFile)
+	}
+
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	if cfg.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
 func logStartWithConfig(cfg *config.Config, logger *log.Logger) {
 	a := "without authentication"
 
@@ -164,62 +300,31 @@ func logStartWithConfig(cfg *config.Config, logger *log.Logger) {
 	}
 
 	logger.Printf("Starting MQTT broker on %s:%d %s\n", cfg.Broker.Address, cfg.Broker.Port, a)
-	logger.Printf("Starting HTTP server on %s:%d\n", cfg.Server.Address, cfg.Server.Port)
-	logger.Printf("Using %s storage driver\n", cfg.Storage.Driver)
-}
 
-func setUpExternalClients(cfg *config.Config, proc processor.Processor) {
-	for name, broker := range cfg.ExternalBrokers {
-		if len(broker.Topics) == 0 {
-			// No point in subscribing to nothing.
-			continue
-		}
+	if cfg.Broker.TLS.Enabled {
+		logger.Printf("Starting MQTT TLS listener on %s:%d\n", cfg.Broker.TLS.Address, cfg.Broker.TLS.Port)
+	}
 
-		go func(name string, broker config.ExternalBrokerConfig) {
-			opts := mqtt2.NewClientOptions().
-				AddBroker(broker.Host).
-				SetClientID(broker.ClientID).
-				SetAutoReconnect(true).
-				SetOrderMatters(true).
-				SetOnConnectHandler(func(client mqtt2.Client) {
-					log.Printf("Connected to %s\n", name)
-				})
-
-			if broker.Username != "" {
-				opts.SetUsername(broker.Username)
-			}
-
-			if broker.Password != "" {
-				opts.SetPassword(broker.Password)
-			}
-
-			client := mqtt2.NewClient(opts)
-
-			token := client.Connect()
-
-			token.Wait()
-
-			for _, topic := range broker.Topics {
-				client.Subscribe(topic, 0, func(client mqtt2.Client, message mqtt2.Message) {
-					proc.Process(processor.MQTTMessage{
-						Server:  name,
-						Topic:   message.Topic(),
-						Payload: string(message.Payload()),
-					})
-				})
-			}
-		}(name, broker)
+	if cfg.Broker.WebSocket.Enabled {
+		logger.Printf("Starting MQTT WebSocket listener on %s:%d\n", cfg.Broker.WebSocket.Address, cfg.Broker.WebSocket.Port)
 	}
+
+	if cfg.Broker.UnixSocket.Enabled {
+		logger.Printf("Starting MQTT Unix socket listener on %s\n", cfg.Broker.UnixSocket.Path)
+	}
+
+	logger.Printf("Starting HTTP server on %s:%d\n", cfg.Server.Address, cfg.Server.Port)
+	logger.Printf("Using %s storage driver\n", cfg.Storage.Driver)
 }
 
-func setUpPublisher(ctx context.Context, parallel int, logger *log.Logger) publisher.Publisher {
+func setUpPublisher(ctx context.Context, parallel int, redact func(string) string, logger *log.Logger) publisher.Publisher {
 	return publisher.New(ctx, parallel, func() *http.Client {
 		return &http.Client{}
-	}, logger)
+	}, redact, logger)
 }
 
-func setUpServer(service subscription.Service, mqttMessageChan <-chan processor.MQTTMessage, cfg *config.Config) server.HTTPServer {
-	return server.New(service, mqttMessageChan, cfg)
+func setUpServer(service subscription.Service, proc processor.Processor, mqttMessageChan <-chan processor.MQTTMessage, deadLetters deadletter.Queue, cfg *config.Config) server.HTTPServer {
+	return server.New(service, proc, mqttMessageChan, deadLetters, cfg)
 }
 
 func setUpStore(cfg *config.Config) (datastore.Store, error) {
@@ -233,7 +338,28 @@ func setUpStore(cfg *config.Config) (datastore.Store, error) {
 			return nil, err
 		}
 
-		return datastore.File(storageConfig.File, 5*time.Second)
+		return datastore.File(storageConfig.File, storageConfig.Backups)
+	case "yaml":
+		storageConfig, err := cfg.StorageConfigYAML()
+
+		if err != nil {
+			return nil, err
+		}
+
+		var overlay datastore.Store
+
+		switch storageConfig.Overlay {
+		case "memory":
+			overlay, err = datastore.Memory()
+		case "file":
+			overlay, err = datastore.File(storageConfig.File, storageConfig.Backups)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return datastore.YAML(storageConfig.Directory, overlay, server.ValidateSubscriptionRecord)
 	}
 
 	return nil, fmt.Errorf("unknown storage driver: %s", cfg.Storage.Driver)
@@ -0,0 +1,130 @@
+package process
+
+import (
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"log"
+	"mqtt-http-bridge/src/config"
+	"mqtt-http-bridge/src/hook"
+	"mqtt-http-bridge/src/publisher"
+	"mqtt-http-bridge/src/subscription"
+	"mqtt-http-bridge/src/utilities"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// reloader applies the changes to the config file while running, as far as possible without a restart.
+type reloader struct {
+	current   *config.Config
+	service   subscription.Service
+	broker    *mqtt.Server
+	authHook  hook.AuthHookInterface
+	externals *externalClients
+	publisher publisher.Publisher
+	logger    *log.Logger
+
+	mu sync.Mutex
+}
+
+// reloadOnHangup reloads the config file when receiving a SIGHUP.
+func reloadOnHangup(r *reloader) {
+	hup := make(chan os.Signal, 1)
+
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			r.reload()
+		}
+	}()
+}
+
+// config returns the config as it was last reloaded.
+func (r *reloader) config() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current
+}
+
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := config.Load()
+
+	if err != nil {
+		r.logger.Printf("Unable to reload config, keeping the previous config: %s\n", err)
+		return
+	}
+
+	// The global parameters are reloaded even when the config is unchanged, since their sources can change.
+	if err := loadConfiguredGlobalParameters(next, r.service); err != nil {
+		r.logger.Printf("Unable to reload global parameters, keeping the previous values: %s\n", err)
+	} else {
+		r.logger.Println("Reloaded global parameters from config.")
+	}
+
+	if r.current.Broker.OpenAuth != next.Broker.OpenAuth || !reflect.DeepEqual(r.current.Broker.Users, next.Broker.Users) {
+		r.applyUsers(next.Broker)
+	}
+
+	if changed := r.externals.apply(next.ExternalBrokers); len(changed) > 0 {
+		r.logger.Printf("Applied changes to external brokers %s\n", strings.Join(changed, ", "))
+	}
+
+	if r.current.Publisher.Parallel != next.Publisher.Parallel {
+		r.publisher.SetParallel(next.Publisher.Parallel)
+		r.logger.Printf("Changed publisher parallelism from %d to %d\n", r.current.Publisher.Parallel, next.Publisher.Parallel)
+	}
+
+	if !reflect.DeepEqual(r.current.Templates, next.Templates) {
+		utilities.AllowTemplateEnv(next.Templates.EnvAllowList...)
+		r.logger.Println("Reloaded the environment variables allowed in templates.")
+	}
+
+	if settings := r.current.RestartRequired(next); len(settings) > 0 {
+		r.logger.Printf("Changes to %s require a restart, they are ignored until then.\n", strings.Join(settings, ", "))
+	}
+
+	// Settings requiring a restart keep their running values, so they are reported again on the next reload.
+	next.AppEnv = r.current.AppEnv
+	next.Broker.Address, next.Broker.Port = r.current.Broker.Address, r.current.Broker.Port
+	next.Broker.TLS, next.Broker.WebSocket, next.Broker.UnixSocket = r.current.Broker.TLS, r.current.Broker.WebSocket, r.current.Broker.UnixSocket
+	next.Server, next.Storage, next.Secrets = r.current.Server, r.current.Storage, r.current.Secrets
+
+	r.current = next
+}
+
+// applyUsers updates the users of the built-in broker, and disconnects the clients that lost their access.
+func (r *reloader) applyUsers(cfg config.BrokerConfig) {
+	users := make(map[string]string, len(cfg.Users))
+
+	if !cfg.OpenAuth {
+		for _, user := range cfg.Users {
+			users[user.Username] = user.Password
+		}
+	}
+
+	revoked := r.authHook.Update(cfg.OpenAuth, users)
+	disconnected := 0
+
+	for _, cl := range r.broker.Clients.GetAll() {
+		if cl.Net.Inline || cl.Closed() || !revoked(string(cl.Properties.Username)) {
+			continue
+		}
+
+		_ = r.broker.DisconnectClient(cl, packets.ErrNotAuthorized)
+		disconnected++
+	}
+
+	if cfg.OpenAuth {
+		r.logger.Println("Reloaded built-in broker users, authentication is disabled.")
+	} else {
+		r.logger.Printf("Reloaded built-in broker users, %d configured, %d clients disconnected.\n", len(users), disconnected)
+	}
+}
@@ -0,0 +1,104 @@
+package process
+
+import (
+	"context"
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"log"
+	"mqtt-http-bridge/src/config"
+	"mqtt-http-bridge/src/processor"
+	"mqtt-http-bridge/src/publisher"
+	"mqtt-http-bridge/src/server"
+	"mqtt-http-bridge/src/subscription"
+	"time"
+)
+
+// httpShutdownTimeout is how long running API requests get to finish when shutting down.
+const httpShutdownTimeout = 5 * time.Second
+
+// shutdown stops accepting MQTT messages and HTTP requests, lets the processor finish and drains the publisher, before
+// flushing the store. Deliveries that couldn't be made before the drain timeout are saved to the pending file.
+func shutdown(cfg *config.Config, broker *mqtt.Server, httpServer server.HTTPServer, externals *externalClients, proc processor.Processor, pub publisher.Publisher, service subscription.Service, logger *log.Logger) {
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancelHTTP()
+
+	if err := httpServer.Shutdown(httpCtx); err != nil {
+		logger.Printf("Error shutting down HTTP server: %s\n", err)
+	}
+
+	externals.apply(nil)
+
+	if err := broker.Close(); err != nil {
+		logger.Printf("Error shutting down MQTT broker: %s\n", err)
+	}
+
+	logger.Printf("Waiting up to %ds for queued deliveries...\n", cfg.Publisher.DrainTimeout)
+
+	// The deadline covers both the processing and the deliveries, processing waits when the queue is full.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), time.Duration(cfg.Publisher.DrainTimeout)*time.Second)
+	defer cancelDrain()
+
+	processed := make(chan struct{})
+
+	go func() {
+		proc.Wait()
+		close(processed)
+	}()
+
+	select {
+	case <-processed:
+	case <-drainCtx.Done():
+		logger.Println("Processing didn't finish before the drain timeout, messages waiting for the queue are kept as undelivered")
+	}
+
+	undelivered := pub.Close(drainCtx)
+
+	switch {
+	case len(undelivered) == 0:
+	case cfg.Publisher.PendingFile == "":
+		logger.Printf("%d deliveries were not made and are lost, configure publisher.pending-file to keep them\n", len(undelivered))
+	default:
+		saved, err := savePendingDeliveries(cfg.Publisher.PendingFile, cfg.Secrets.Key, service.RedactSecrets, undelivered)
+
+		switch {
+		case err != nil:
+			logger.Printf("Unable to save %d pending deliveries, they are lost: %s\n", len(undelivered), err)
+		case saved < len(undelivered):
+			logger.Printf("Saved %d pending deliveries to %s, %d containing secrets are lost as there is no secrets key to encrypt them with\n", saved, cfg.Publisher.PendingFile, len(undelivered)-saved)
+		default:
+			logger.Printf("Saved %d pending deliveries to %s, they are sent after the next start\n", saved, cfg.Publisher.PendingFile)
+		}
+	}
+
+	if err := service.Close(); err != nil {
+		logger.Printf("Error flushing store: %s\n", err)
+	}
+
+	logger.Println("Shutdown complete.")
+}
+
+// queuePendingDeliveries sends the deliveries saved on the previous shutdown.
+func queuePendingDeliveries(cfg *config.Config, pub publisher.Publisher, logger *log.Logger) {
+	if cfg.Publisher.PendingFile == "" {
+		return
+	}
+
+	jobs, err := loadPendingDeliveries(cfg.Publisher.PendingFile, cfg.Secrets.Key)
+
+	if err != nil {
+		logger.Printf("Unable to load pending deliveries from %s: %s\n", cfg.Publisher.PendingFile, err)
+		return
+	}
+
+	if len(jobs) == 0 {
+		return
+	}
+
+	logger.Printf("Sending %d pending deliveries from the previous run\n", len(jobs))
+
+	// Queued in the background, as there may be more jobs than the queue holds.
+	go func() {
+		for _, job := range jobs {
+			pub.Publish(job.Body, job.Subscription)
+		}
+	}()
+}
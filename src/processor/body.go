@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blues/jsonata-go"
+	"mqtt-http-bridge/src/subscription"
+	"regexp"
+	"strings"
+)
+
+func (p *processor) renderBody(sub subscription.Subscription, parameters map[string]any, message []byte) ([]byte, error) {
+	switch sub.BodyMode {
+	case subscription.BodyModeJSON:
+		return p.renderJSONBody(sub.Body, parameters)
+	case subscription.BodyModeJSONata:
+		return p.renderJSONataBody(sub.Body, parameters)
+	default:
+		return p.renderTemplate(sub, parameters, message)
+	}
+}
+
+func (p *processor) renderJSONBody(body string, parameters map[string]any) ([]byte, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, errors.New("body is empty")
+	}
+
+	var document any
+
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		return nil, fmt.Errorf("body is not valid JSON: %w", err)
+	}
+
+	rendered, err := p.renderJSONValue(document, parameters)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(rendered)
+}
+
+var singlePlaceholderRegexp = regexp.MustCompile(`^\{\{\s*\.([a-zA-Z0-9_.]+)\s*\}\}$`)
+
+// renderJSONValue walks a JSON document, rendering all keys and string values as templates. A string value that only
+// consists of a single placeholder (e.g. "{{ .extract.value }}") is replaced by the value itself, retaining its type.
+func (p *processor) renderJSONValue(value any, parameters map[string]any) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		rendered := make(map[string]any, len(v))
+
+		for key, item := range v {
+			renderedKey, err := p.executeTemplate(key, parameters)
+
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", key, err)
+			}
+
+			if rendered[renderedKey], err = p.renderJSONValue(item, parameters); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+
+		return rendered, nil
+	case []any:
+		rendered := make([]any, len(v))
+
+		for idx, item := range v {
+			var err error
+
+			if rendered[idx], err = p.renderJSONValue(item, parameters); err != nil {
+				return nil, fmt.Errorf("[%d]: %w", idx, err)
+			}
+		}
+
+		return rendered, nil
+	case string:
+		if match := singlePlaceholderRegexp.FindStringSubmatch(strings.TrimSpace(v)); match != nil {
+			return lookupParameter(parameters, match[1]), nil
+		}
+
+		return p.executeTemplate(v, parameters)
+	default:
+		return v, nil
+	}
+}
+
+func lookupParameter(parameters map[string]any, path string) any {
+	var current any = parameters
+
+	for _, segment := range strings.Split(path, ".") {
+		m, ok := current.(map[string]any)
+
+		if !ok {
+			return nil
+		}
+
+		if current, ok = m[segment]; !ok {
+			return nil
+		}
+	}
+
+	return current
+}
+
+func (p *processor) renderJSONataBody(body string, parameters map[string]any) ([]byte, error) {
+	expr := p.cacheExpression(body, "body")
+
+	if expr == nil {
+		return nil, errors.New("expression invalid")
+	}
+
+	res, err := expr.Eval(parameters)
+
+	if err != nil && !errors.Is(err, jsonata.ErrUndefined) {
+		return nil, err
+	}
+
+	return json.Marshal(res)
+}
+
+func (p *processor) executeTemplate(text string, parameters map[string]any) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := p.cacheTemplate(text)
+
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+
+	if err := tmpl.Execute(buf, parameters); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"fmt"
+	"github.com/blues/jsonata-go"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"mqtt-http-bridge/src/subscription"
+	"testing"
+	"text/template"
+)
+
+func TestRenderBody(t *testing.T) {
+	p := &processor{
+		logger:          log.New(io.Discard, "", 0),
+		expressionCache: make(map[string]*jsonata.Expr),
+		templateCache:   make(map[string]*template.Template),
+	}
+
+	parameters := map[string]any{
+		"extract": map[string]any{
+			"action":  `say "hi"`,
+			"battery": float64(87),
+			"state":   map[string]any{"on": true},
+		},
+		"global": map[string]any{
+			"room": "kitchen",
+		},
+	}
+
+	tt := []struct {
+		mode     string
+		body     string
+		expected string
+	}{
+		{subscription.BodyModeTemplate, `{"action":"{{.extract.action}}"}`, `{"action":"say "hi""}`},
+		{subscription.BodyModeJSON, `{"action":"{{.extract.action}}"}`, `{"action":"say \"hi\""}`},
+		{subscription.BodyModeJSON, `{"battery":"{{ .extract.battery }}","state":"{{.extract.state}}"}`, `{"battery":87,"state":{"on":true}}`},
+		{subscription.BodyModeJSON, `{"{{.global.room}}":["light {{.global.room}}","{{.extract.missing}}"]}`, `{"kitchen":["light kitchen",null]}`},
+		{subscription.BodyModeJSONata, `{"room": global.room, "low": extract.battery < 90}`, `{"low":true,"room":"kitchen"}`},
+	}
+
+	for n, tc := range tt {
+		t.Run(fmt.Sprintf("Render Body Test Case #%d (%s)", n+1, tc.mode), func(t *testing.T) {
+			body, err := p.renderBody(subscription.Subscription{Body: tc.body, BodyMode: tc.mode}, parameters, []byte("raw"))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(body))
+		})
+	}
+
+	t.Run("Invalid JSON bodies return an error", func(t *testing.T) {
+		_, err := p.renderBody(subscription.Subscription{Body: `{"broken":`, BodyMode: subscription.BodyModeJSON}, parameters, []byte("raw"))
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	PayloadFormatJSON    = "json"
+	PayloadFormatText    = "text"
+	PayloadFormatNumber  = "number"
+	PayloadFormatCSV     = "csv"
+	PayloadFormatCBOR    = "cbor"
+	PayloadFormatMsgPack = "msgpack"
+	PayloadFormatBase64  = "base64"
+)
+
+var (
+	ErrUnsupportedPayloadFormat = errors.New("unsupported payload format")
+	ErrUnsupportedMapKey        = errors.New("unsupported map key")
+)
+
+type payloadDecoder func(payload []byte) (any, error)
+
+var payloadDecoders = map[string]payloadDecoder{
+	PayloadFormatJSON:    decodeJSON,
+	PayloadFormatText:    decodeText,
+	PayloadFormatNumber:  decodeNumber,
+	PayloadFormatCSV:     decodeCSV,
+	PayloadFormatCBOR:    decodeCBOR,
+	PayloadFormatMsgPack: decodeMsgPack,
+	PayloadFormatBase64:  decodeBase64,
+}
+
+// decodePayload turns a raw MQTT payload into a value JSONata expressions can be evaluated against. An empty format
+// is treated as JSON, for backwards compatibility.
+func decodePayload(format string, payload []byte) (any, error) {
+	if format == "" {
+		format = PayloadFormatJSON
+	}
+
+	decoder, ok := payloadDecoders[format]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPayloadFormat, format)
+	}
+
+	return decoder(payload)
+}
+
+func payloadFormatName(format string) string {
+	if format == "" {
+		return PayloadFormatJSON
+	}
+
+	return format
+}
+
+func decodeJSON(payload []byte) (any, error) {
+	var data any
+
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func decodeText(payload []byte) (any, error) {
+	return strings.TrimSpace(string(payload)), nil
+}
+
+func decodeNumber(payload []byte) (any, error) {
+	return strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+}
+
+func decodeCSV(payload []byte) (any, error) {
+	reader := csv.NewReader(bytes.NewReader(payload))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]any, 0, len(records))
+
+	for _, record := range records {
+		row := make([]any, 0, len(record))
+
+		for _, field := range record {
+			row = append(row, field)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// cborDecMode decodes maps with keys of any type, as CBOR allows integer keys. normalizeDecodedValue turns them into
+// strings.
+var cborDecMode = mustCBORDecMode(cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[any]any{}),
+})
+
+func mustCBORDecMode(options cbor.DecOptions) cbor.DecMode {
+	mode, err := options.DecMode()
+
+	if err != nil {
+		panic(err)
+	}
+
+	return mode
+}
+
+func decodeCBOR(payload []byte) (any, error) {
+	var data any
+
+	if err := cborDecMode.Unmarshal(payload, &data); err != nil {
+		return nil, err
+	}
+
+	return normalizeDecodedValue(data)
+}
+
+func decodeMsgPack(payload []byte) (any, error) {
+	decoder := msgpack.NewDecoder(bytes.NewReader(payload))
+	// Like CBOR, MessagePack allows keys of any type.
+	decoder.SetMapDecoder(func(d *msgpack.Decoder) (any, error) {
+		return d.DecodeUntypedMap()
+	})
+
+	var data any
+
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return normalizeDecodedValue(data)
+}
+
+func decodeBase64(payload []byte) (any, error) {
+	return base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// normalizeDecodedValue round-trips a decoded value through JSON, so binary formats end up with the same types
+// (float64, string, []any, map[string]any) as JSON payloads do. Number and boolean map keys become strings.
+func normalizeDecodedValue(data any) (any, error) {
+	data, err := stringifyMapKeys(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJSON(encoded)
+}
+
+func stringifyMapKeys(data any) (any, error) {
+	var err error
+
+	switch value := data.(type) {
+	case map[any]any:
+		result := make(map[string]any, len(value))
+
+		for key, item := range value {
+			var name string
+
+			switch key.(type) {
+			case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+				name = fmt.Sprint(key)
+			default:
+				return nil, fmt.Errorf("%w: %T", ErrUnsupportedMapKey, key)
+			}
+
+			if _, ok := result[name]; ok {
+				return nil, fmt.Errorf("%w: %s is used more than once", ErrUnsupportedMapKey, name)
+			}
+
+			if result[name], err = stringifyMapKeys(item); err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	case map[string]any:
+		for key, item := range value {
+			if value[key], err = stringifyMapKeys(item); err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		for i, item := range value {
+			if value[i], err = stringifyMapKeys(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"testing"
+)
+
+func TestDecodePayload(t *testing.T) {
+	cborPayload, _ := cbor.Marshal(map[string]any{"action": "single", "battery": 87})
+	msgpackPayload, _ := msgpack.Marshal(map[string]any{"action": "single", "battery": 87})
+
+	tt := []struct {
+		format   string
+		payload  []byte
+		expected any
+	}{
+		{"", []byte(`{"action":"single"}`), map[string]any{"action": "single"}},
+		{PayloadFormatJSON, []byte(`[1,2]`), []any{float64(1), float64(2)}},
+		{PayloadFormatText, []byte("ON\n"), "ON"},
+		{PayloadFormatNumber, []byte(" 21.5 "), 21.5},
+		{PayloadFormatCSV, []byte("a,b\n1, 2\n"), []any{[]any{"a", "b"}, []any{"1", "2"}}},
+		{PayloadFormatCBOR, cborPayload, map[string]any{"action": "single", "battery": float64(87)}},
+		{PayloadFormatMsgPack, msgpackPayload, map[string]any{"action": "single", "battery": float64(87)}},
+		{PayloadFormatBase64, []byte{0xde, 0xad, 0xbe, 0xef}, "3q2+7w=="},
+	}
+
+	for n, tc := range tt {
+		t.Run(fmt.Sprintf("Decode Payload Test Case #%d (%s)", n+1, tc.format), func(t *testing.T) {
+			decoded, err := decodePayload(tc.format, tc.payload)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, decoded)
+		})
+	}
+
+	t.Run("Invalid payloads return an error", func(t *testing.T) {
+		_, err := decodePayload(PayloadFormatNumber, []byte("ON"))
+		assert.Error(t, err)
+
+		_, err = decodePayload(PayloadFormatJSON, []byte("ON"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Map keys are turned into strings", func(t *testing.T) {
+		expected := map[string]any{"1": "temperature", "2": map[string]any{"3": float64(21)}, "true": []any{map[string]any{"-1": "low"}}}
+		value := map[any]any{1: "temperature", 2: map[any]any{3: 21}, true: []any{map[any]any{-1: "low"}}}
+
+		cborPayload, _ := cbor.Marshal(value)
+		msgpackPayload, _ := msgpack.Marshal(value)
+
+		for format, payload := range map[string][]byte{PayloadFormatCBOR: cborPayload, PayloadFormatMsgPack: msgpackPayload} {
+			decoded, err := decodePayload(format, payload)
+
+			assert.NoError(t, err, format)
+			assert.Equal(t, expected, decoded, format)
+		}
+	})
+
+	t.Run("Unsupported map keys return an error", func(t *testing.T) {
+		bytesKey, _ := cbor.Marshal(map[cbor.ByteString]string{"\x01": "bytes"})
+		_, err := decodePayload(PayloadFormatCBOR, bytesKey)
+		assert.ErrorIs(t, err, ErrUnsupportedMapKey)
+
+		duplicateKey, _ := cbor.Marshal(map[any]any{1: "number", "1": "string"})
+		_, err = decodePayload(PayloadFormatCBOR, duplicateKey)
+		assert.ErrorIs(t, err, ErrUnsupportedMapKey)
+	})
+
+	t.Run("Unknown formats return an error", func(t *testing.T) {
+		_, err := decodePayload("xml", []byte("<on/>"))
+		assert.ErrorIs(t, err, ErrUnsupportedPayloadFormat)
+	})
+}
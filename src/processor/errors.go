@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"mqtt-http-bridge/src/deadletter"
+	"mqtt-http-bridge/src/subscription"
+)
+
+const (
+	stageExtract      = "extract"
+	stagePlaceholders = "placeholders"
+	stageFilter       = "filter"
+	stageBody         = "body"
+)
+
+// handleError applies the error policy of the subscription, and returns whether processing of the message should
+// continue.
+func (p *processor) handleError(sub subscription.Subscription, message MQTTMessage, stage string, err error) bool {
+	switch sub.ErrorPolicy {
+	case subscription.ErrorPolicyFailClosed:
+		p.logger.Printf("Error in %s for subscription %s, message dropped: %s\n", stage, sub.ID, err)
+		return false
+	case subscription.ErrorPolicyDeadLetter:
+		p.logger.Printf("Error in %s for subscription %s, message sent to dead letter queue: %s\n", stage, sub.ID, err)
+		p.addDeadLetter(sub, message, stage, err)
+
+		return false
+	default:
+		p.logger.Printf("Error in %s for subscription %s, continuing: %s\n", stage, sub.ID, err)
+		return true
+	}
+}
+
+// failsOpen reports whether the error policy of the subscription continues processing after an error.
+func failsOpen(sub subscription.Subscription) bool {
+	return sub.ErrorPolicy != subscription.ErrorPolicyFailClosed && sub.ErrorPolicy != subscription.ErrorPolicyDeadLetter
+}
+
+func (p *processor) addDeadLetter(sub subscription.Subscription, message MQTTMessage, stage string, err error) {
+	if p.deadLetters == nil {
+		return
+	}
+
+	errMessage, payload := err.Error(), string(message.Payload)
+
+	if p.service != nil {
+		errMessage = p.service.RedactSecrets(errMessage)
+		payload = p.service.RedactSecrets(payload)
+	}
+
+	p.deadLetters.Add(deadletter.Entry{
+		SubscriptionID:   sub.ID,
+		SubscriptionName: sub.Name,
+		Server:           message.Server,
+		Topic:            message.Topic,
+		Payload:          payload,
+		Stage:            stage,
+		Error:            errMessage,
+	})
+}
+
+// errFilteredOut is returned by prepare when the filter of the subscription rejects the message.
+var errFilteredOut = errors.New("message was filtered out")
+
+// stageError is returned by prepare when a failing stage stops processing of the message.
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.stage, e.err)
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
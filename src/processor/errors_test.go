@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/deadletter"
+	"mqtt-http-bridge/src/subscription"
+	"testing"
+)
+
+func TestHandleError(t *testing.T) {
+	deadLetters := deadletter.New()
+
+	p := &processor{
+		deadLetters: deadLetters,
+		logger:      log.New(io.Discard, "", 0),
+	}
+
+	message := MQTTMessage{Server: InternalBroker, Topic: "test/topic", Payload: []byte("ON")}
+	err := errors.New("filter expression invalid")
+
+	assert.True(t, p.handleError(subscription.Subscription{ID: "1"}, message, stageFilter, err), "Subscriptions without a policy should fail open")
+	assert.True(t, p.handleError(subscription.Subscription{ID: "2", ErrorPolicy: subscription.ErrorPolicyFailOpen}, message, stageFilter, err))
+	assert.False(t, p.handleError(subscription.Subscription{ID: "3", ErrorPolicy: subscription.ErrorPolicyFailClosed}, message, stageFilter, err))
+	assert.False(t, p.handleError(subscription.Subscription{ID: "4", ErrorPolicy: subscription.ErrorPolicyDeadLetter}, message, stageFilter, err))
+
+	entries := deadLetters.List()
+
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "4", entries[0].SubscriptionID)
+		assert.Equal(t, stageFilter, entries[0].Stage)
+		assert.Equal(t, "ON", entries[0].Payload)
+		assert.Equal(t, err.Error(), entries[0].Error)
+	}
+}
+
+func TestDeadLettersAreRedacted(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := subscription.NewService(store, "secret-key")
+	assert.NoError(t, service.SetSecret("token", "s3cr3t", subscription.Actor{Name: "alice"}))
+
+	deadLetters := deadletter.New()
+	p := &processor{
+		deadLetters: deadLetters,
+		logger:      log.New(io.Discard, "", 0),
+		service:     service,
+	}
+
+	message := MQTTMessage{Server: InternalBroker, Topic: "test/topic", Payload: []byte(`{"token": "s3cr3t"}`)}
+	p.addDeadLetter(subscription.Subscription{ID: "1"}, message, stageBody, errors.New("unable to send s3cr3t"))
+
+	entries := deadLetters.List()
+
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, `{"token": "********"}`, entries[0].Payload)
+		assert.Equal(t, "unable to send ********", entries[0].Error)
+	}
+}
@@ -2,14 +2,15 @@ package processor
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/blues/jsonata-go"
 	"log"
+	"mqtt-http-bridge/src/deadletter"
 	"mqtt-http-bridge/src/publisher"
 	"mqtt-http-bridge/src/subscription"
 	"mqtt-http-bridge/src/utilities"
+	"strings"
 	"sync"
 	"text/template"
 )
@@ -18,18 +19,54 @@ const InternalBroker = "---internal---"
 
 type Processor interface {
 	Process(message MQTTMessage)
+	// Simulate returns what processing the message would do for each subscription, without sending any requests.
+	Simulate(message MQTTMessage) ([]Simulation, error)
+	// Wait blocks until the messages being processed have been handed to the publisher.
+	Wait()
 }
 
 type MQTTMessage struct {
-	Server  string
-	Topic   string
-	Payload string
+	Server   string
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retain   bool
+	PacketID uint16
 	// Internal Server Only
-	User string
+	User     string
+	ClientID string
+	// MQTT v5 Only
+	ContentType   string
+	ResponseTopic string
+	// UserProperties contains the MQTT v5 user properties, if a key is used more than once, the last value wins
+	UserProperties map[string]string
 }
 
-func New(store subscription.Service, publisher publisher.Publisher, mqttMessageChan chan<- MQTTMessage, logger *log.Logger) Processor {
-	return &processor{
+func (m MQTTMessage) metaParameters() map[string]any {
+	userProperties := make(map[string]any, len(m.UserProperties))
+
+	for key, value := range m.UserProperties {
+		userProperties[key] = value
+	}
+
+	return map[string]any{
+		"server":         m.Server,
+		"topic":          m.Topic,
+		"client":         m.User,
+		"clientId":       m.ClientID,
+		"payload":        string(m.Payload),
+		"qos":            int(m.QoS),
+		"retain":         m.Retain,
+		"packetId":       int(m.PacketID),
+		"contentType":    m.ContentType,
+		"responseTopic":  m.ResponseTopic,
+		"userProperties": userProperties,
+	}
+}
+
+func New(store subscription.Service, publisher publisher.Publisher, mqttMessageChan chan<- MQTTMessage, deadLetters deadletter.Queue, logger *log.Logger) Processor {
+	p := &processor{
+		deadLetters:     deadLetters,
 		logger:          logger,
 		mqttMessageChan: mqttMessageChan,
 		publisher:       publisher,
@@ -38,9 +75,15 @@ func New(store subscription.Service, publisher publisher.Publisher, mqttMessageC
 		expressionCache: make(map[string]*jsonata.Expr),
 		templateCache:   make(map[string]*template.Template),
 	}
+
+	// Expressions and templates that are no longer used would otherwise pile up in the caches.
+	store.OnChange(p.clearCaches)
+
+	return p
 }
 
 type processor struct {
+	deadLetters     deadletter.Queue
 	logger          *log.Logger
 	mqttMessageChan chan<- MQTTMessage
 	publisher       publisher.Publisher
@@ -51,6 +94,9 @@ type processor struct {
 
 	templateCache   map[string]*template.Template
 	templateCacheMu sync.RWMutex
+
+	// inFlight tracks the subscriptions that are being processed
+	inFlight sync.WaitGroup
 }
 
 func (p *processor) Process(message MQTTMessage) {
@@ -70,37 +116,125 @@ func (p *processor) Process(message MQTTMessage) {
 		return
 	}
 
+	secrets, err := p.service.GetSecrets()
+	if err != nil {
+		// Continue with the secrets that could be decrypted, subscriptions depending on others will report those.
+		p.logger.Printf("Error getting secrets: %s\n", err)
+	}
+
 	for _, sub := range subs {
+		if sub.SkipRetained && message.Retain {
+			p.logger.Printf("Retained message for subscription %s was skipped\n", sub.ID)
+			continue
+		}
+
+		p.inFlight.Add(1)
+
 		go func() {
-			parameters := map[string]any{
-				"meta": map[string]any{
-					"topic":   message.Topic,
-					"client":  message.User,
-					"payload": message.Payload,
-				},
-				"global":  globalParams,
-				"extract": p.extractParametersFromMessage(sub, message.Payload),
-			}
+			defer p.inFlight.Done()
 
-			sub, err = p.service.ApplyPlaceholdersOnSubscription(sub, parameters)
+			sub, requestBody, err := p.prepare(sub, message, globalParams, secrets, func(sub subscription.Subscription, stage string, err error) bool {
+				return p.handleError(sub, message, stage, err)
+			})
 
-			if err != nil {
-				p.logger.Printf("Error applying placeholders to subscription %s: %s\n", sub.ID, err)
-				return
-			}
+			var stageErr *stageError
 
-			if !p.filterMessage(sub, parameters) {
+			switch {
+			case errors.Is(err, errFilteredOut):
 				p.logger.Printf("Message for subscription %s was filtered out\n", sub.ID)
 				return
-			}
+			case errors.As(err, &stageErr) && stageErr.stage == stagePlaceholders:
+				// Without the placeholders applied there is nothing sensible to deliver, regardless of the error policy.
+				p.logger.Printf("Error applying placeholders to subscription %s: %s\n", sub.ID, stageErr.err)
+
+				if sub.ErrorPolicy == subscription.ErrorPolicyDeadLetter {
+					p.addDeadLetter(sub, message, stagePlaceholders, stageErr.err)
+				}
 
-			requestBody := p.renderTemplate(sub, parameters, message.Payload)
+				return
+			case err != nil:
+				// The error policy was already applied.
+				return
+			}
 
 			p.publisher.Publish(requestBody, sub)
 		}()
 	}
 }
 
+func (p *processor) Wait() {
+	p.inFlight.Wait()
+}
+
+// prepare runs the message through the stages of the subscription, and returns the subscription with its placeholders
+// applied and the body of the request. onError is called when a stage fails and reports whether processing continues,
+// the placeholders stage always stops processing. Processing that stops returns a *stageError, or errFilteredOut.
+func (p *processor) prepare(sub subscription.Subscription, message MQTTMessage, globalParams map[string]any, secrets map[string]any, onError func(sub subscription.Subscription, stage string, err error) bool) (subscription.Subscription, []byte, error) {
+	extracted, err := p.extractParametersFromMessage(sub, message.Payload)
+
+	if err != nil && !onError(sub, stageExtract, err) {
+		return sub, nil, &stageError{stage: stageExtract, err: err}
+	}
+
+	parameters := map[string]any{
+		"meta":    message.metaParameters(),
+		"global":  globalParams,
+		"secret":  secrets,
+		"extract": extracted,
+		"param":   blueprintParameters(sub),
+	}
+
+	hydrated, err := p.service.ApplyPlaceholdersOnSubscription(sub, parameters)
+
+	if err != nil {
+		return sub, nil, &stageError{stage: stagePlaceholders, err: err}
+	}
+
+	sub = hydrated
+
+	matches, err := p.filterMessage(sub, parameters)
+
+	if err != nil {
+		if !onError(sub, stageFilter, err) {
+			return sub, nil, &stageError{stage: stageFilter, err: err}
+		}
+	} else if !matches {
+		return sub, nil, errFilteredOut
+	}
+
+	requestBody, err := p.renderBody(sub, parameters, message.Payload)
+
+	if err != nil {
+		if !onError(sub, stageBody, err) {
+			return sub, nil, &stageError{stage: stageBody, err: err}
+		}
+
+		// Failing open on the body means forwarding the original message.
+		requestBody = message.Payload
+	}
+
+	if !sub.IsBodyTemplated() && !hasHeader(sub.Headers, "Content-Type") {
+		if sub.Headers == nil {
+			sub.Headers = make(map[string]string)
+		}
+
+		sub.Headers["Content-Type"] = "application/json"
+	}
+
+	return sub, requestBody, nil
+}
+
+// hasHeader reports whether the header is set, header names are case-insensitive.
+func hasHeader(headers map[string]string, name string) bool {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) && value != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (p *processor) cacheExpression(expression string, context string) *jsonata.Expr {
 	if p.expressionCache == nil {
 		p.expressionCache = make(map[string]*jsonata.Expr)
@@ -129,32 +263,68 @@ func (p *processor) cacheExpression(expression string, context string) *jsonata.
 	return expr
 }
 
-func (p *processor) extractParametersFromMessage(sub subscription.Subscription, message string) map[string]any {
+func (p *processor) clearCaches() {
+	p.expressionCacheMu.Lock()
+	p.expressionCache = make(map[string]*jsonata.Expr)
+	p.expressionCacheMu.Unlock()
+
+	p.templateCacheMu.Lock()
+	p.templateCache = make(map[string]*template.Template)
+	p.templateCacheMu.Unlock()
+}
+
+func (p *processor) cacheTemplate(text string) (*template.Template, error) {
+	cacheKey := utilities.MD5Hash(text)
+
+	p.templateCacheMu.RLock()
+	tmpl, ok := p.templateCache[cacheKey]
+	p.templateCacheMu.RUnlock()
+
+	if ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.New(cacheKey).Funcs(utilities.TemplateFuncs()).Parse(text)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.templateCacheMu.Lock()
+	p.templateCache[cacheKey] = tmpl
+	p.templateCacheMu.Unlock()
+
+	return tmpl, nil
+}
+
+// extractParametersFromMessage returns all values that could be extracted, and any errors that occurred along the way.
+func (p *processor) extractParametersFromMessage(sub subscription.Subscription, message []byte) (map[string]any, error) {
 	values := make(map[string]any)
 
 	if len(sub.Extract) == 0 {
-		return values
+		return values, nil
 	}
 
-	var data interface{}
+	data, err := decodePayload(sub.PayloadFormat, message)
 
-	if err := json.Unmarshal([]byte(message), &data); err != nil {
-		p.logger.Printf("Topic message for sub %s was not JSON: %s\n", sub.ID, err)
-		return values
+	if err != nil {
+		return values, fmt.Errorf("message could not be decoded as %s: %w", payloadFormatName(sub.PayloadFormat), err)
 	}
 
+	var errs []error
+
 	for key, expression := range sub.Extract {
 		value, err := p.extractParameterFromData(data, expression, fmt.Sprintf("parameter[%s]", key))
 
 		if err != nil && !errors.Is(err, jsonata.ErrUndefined) {
-			p.logger.Printf("Error extracting value for key %s: %s\n", key, err)
+			errs = append(errs, fmt.Errorf("unable to extract value for key %s: %w", key, err))
 			continue
 		}
 
 		values[key] = value
 	}
 
-	return values
+	return values, errors.Join(errs...)
 }
 
 func (p *processor) extractParameterFromData(data interface{}, expression string, context string) (any, error) {
@@ -173,66 +343,63 @@ func (p *processor) extractParameterFromData(data interface{}, expression string
 	return res, nil
 }
 
-func (p *processor) filterMessage(sub subscription.Subscription, parameters map[string]any) bool {
+func (p *processor) filterMessage(sub subscription.Subscription, parameters map[string]any) (bool, error) {
 	if sub.Filter == "" {
-		return true
+		return true, nil
 	}
 
 	expr := p.cacheExpression(sub.Filter, "filter")
 
 	if expr == nil {
-		return true
+		return false, errors.New("filter expression invalid")
 	}
 
 	res, err := expr.Eval(parameters)
 
+	if errors.Is(err, jsonata.ErrUndefined) {
+		// Filters on fields the message doesn't have don't match.
+		return false, nil
+	}
+
 	if err != nil {
-		p.logger.Printf("Error evaluating filter expression for subscription %s: %s\n", sub.ID, err)
-		return true
+		return false, fmt.Errorf("unable to evaluate filter expression: %w", err)
 	}
 
 	if b, ok := res.(bool); ok && !b {
 		// Only if the expression was successfully parsed, and evaluated to false
-		return false
+		return false, nil
 	}
 
-	return true
+	return true, nil
 }
 
-func (p *processor) renderTemplate(sub subscription.Subscription, parameters map[string]any, message string) []byte {
-	cacheKey := utilities.MD5Hash(sub.Body)
+func (p *processor) renderTemplate(sub subscription.Subscription, parameters map[string]any, message []byte) ([]byte, error) {
+	if sub.Body == "" {
+		return message, nil
+	}
 
-	p.templateCacheMu.RLock()
-	tmpl, ok := p.templateCache[cacheKey]
-	p.templateCacheMu.RUnlock()
+	tmpl, err := p.cacheTemplate(sub.Body)
 
-	if !ok {
-		if sub.Body == "" {
-			tmpl = nil
-		} else {
-			var err error
-			tmpl, err = template.New(cacheKey).Parse(sub.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template: %w", err)
+	}
 
-			if err != nil {
-				tmpl = nil
-			}
-		}
+	buf := new(bytes.Buffer)
 
-		p.templateCacheMu.Lock()
-		p.templateCache[cacheKey] = tmpl
-		p.templateCacheMu.Unlock()
+	if err := tmpl.Execute(buf, parameters); err != nil {
+		return nil, fmt.Errorf("unable to render template: %w", err)
 	}
 
-	if tmpl == nil {
-		return []byte(message)
-	}
+	return buf.Bytes(), nil
+}
 
-	buf := new(bytes.Buffer)
+// blueprintParameters returns the parameters of a blueprint instance, which are empty for other subscriptions.
+func blueprintParameters(sub subscription.Subscription) map[string]any {
+	params := make(map[string]any, len(sub.ResolvedParameters))
 
-	if err := tmpl.Execute(buf, parameters); err != nil {
-		p.logger.Printf("Error rendering template for subscription %s: %s\n", sub.ID, err)
-		return []byte(message)
+	for key, value := range sub.ResolvedParameters {
+		params[key] = value
 	}
 
-	return buf.Bytes()
+	return params
 }
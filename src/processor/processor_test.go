@@ -0,0 +1,243 @@
+package processor
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log"
+	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/deadletter"
+	"mqtt-http-bridge/src/publisher"
+	"mqtt-http-bridge/src/subscription"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recordingPublisher keeps the published jobs instead of sending them.
+type recordingPublisher struct {
+	jobs []publisher.Job
+	mu   sync.Mutex
+}
+
+func (r *recordingPublisher) Publish(body []byte, sub subscription.Subscription) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.jobs = append(r.jobs, publisher.Job{Body: body, Subscription: sub})
+}
+
+func (r *recordingPublisher) SetParallel(int) {}
+
+func (r *recordingPublisher) Close(context.Context) []publisher.Job {
+	return nil
+}
+
+// process runs the message through a processor for the service, and returns the published jobs.
+func process(t *testing.T, service subscription.Service, message MQTTMessage) []publisher.Job {
+	t.Helper()
+
+	messages := make(chan MQTTMessage, 1)
+	recorder := &recordingPublisher{}
+
+	p := New(service, recorder, messages, deadletter.New(), log.New(io.Discard, "", 0))
+	p.Process(message)
+	p.Wait()
+
+	return recorder.jobs
+}
+
+func TestProcessRendersTheBodyOnce(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := subscription.NewService(store, "secret-key")
+	alice := subscription.Actor{Name: "alice"}
+
+	require.NoError(t, service.SetSecret("token", "s3cr3t", alice))
+
+	_, err := service.AddSubscription(subscription.Subscription{
+		Name:    "Action",
+		Topic:   "home/action",
+		Extract: map[string]string{"action": "action"},
+		Method:  "POST",
+		URL:     "https://example.com",
+		Body:    `{"a":"{{ .extract.action }}"}`,
+	}, alice)
+	require.NoError(t, err)
+
+	jobs := process(t, service, MQTTMessage{Server: InternalBroker, Topic: "home/action", Payload: []byte(`{"action":"{{ .secret.token }}"}`)})
+
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, `{"a":"{{ .secret.token }}"}`, string(jobs[0].Body), "Placeholders in the message must not be executed")
+	}
+}
+
+func TestProcessAppliesPipelinesToExtractedValues(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := subscription.NewService(store, "")
+
+	_, err := service.AddSubscription(subscription.Subscription{
+		Name:    "Device",
+		Topic:   "home/device",
+		Extract: map[string]string{"id": "id", "state": "state"},
+		Method:  "POST",
+		URL:     `https://example.com/{{ .extract.id | default "0" }}`,
+		Headers: map[string]string{"X-State": "{{ .extract.state | toJson }}"},
+	}, subscription.Actor{Name: "alice"})
+	require.NoError(t, err)
+
+	subs, err := service.GetSubscriptionsForTopic("home/device")
+	require.NoError(t, err)
+
+	if assert.Len(t, subs, 1) {
+		assert.Equal(t, `https://example.com/{{ .extract.id | default "0" }}`, subs[0].URL, "Placeholders are applied when processing")
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		url     string
+		state   string
+	}{
+		{name: "extracted", payload: `{"id": 42, "state": {"on": true}}`, url: "https://example.com/42", state: `{"on":true}`},
+		{name: "default", payload: `{"state": "off"}`, url: "https://example.com/0", state: `"off"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := process(t, service, MQTTMessage{Server: InternalBroker, Topic: "home/device", Payload: []byte(tt.payload)})
+
+			if assert.Len(t, jobs, 1) {
+				assert.Equal(t, tt.url, jobs[0].Subscription.URL)
+				assert.Equal(t, tt.state, jobs[0].Subscription.Headers["X-State"])
+			}
+		})
+	}
+}
+
+func TestProcessSkipsRetainedMessages(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := subscription.NewService(store, "")
+	alice := subscription.Actor{Name: "alice"}
+
+	for _, sub := range []subscription.Subscription{
+		{Name: "All", Topic: "home/lights", Method: "POST", URL: "https://example.com/all"},
+		{Name: "Live", Topic: "home/lights", SkipRetained: true, Method: "POST", URL: "https://example.com/live"},
+	} {
+		_, err := service.AddSubscription(sub, alice)
+		require.NoError(t, err)
+	}
+
+	urls := func(jobs []publisher.Job) []string {
+		var urls []string
+
+		for _, job := range jobs {
+			urls = append(urls, job.Subscription.URL)
+		}
+
+		slices.Sort(urls)
+
+		return urls
+	}
+
+	t.Run("Retained messages are skipped", func(t *testing.T) {
+		jobs := process(t, service, MQTTMessage{Server: InternalBroker, Topic: "home/lights", Payload: []byte(`{}`), Retain: true})
+
+		assert.Equal(t, []string{"https://example.com/all"}, urls(jobs))
+	})
+
+	t.Run("Live messages are delivered", func(t *testing.T) {
+		jobs := process(t, service, MQTTMessage{Server: InternalBroker, Topic: "home/lights", Payload: []byte(`{}`)})
+
+		assert.Equal(t, []string{"https://example.com/all", "https://example.com/live"}, urls(jobs))
+	})
+}
+
+func TestProcessExposesMessageMetadata(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := subscription.NewService(store, "")
+
+	_, err := service.AddSubscription(subscription.Subscription{
+		Name:   "Meta",
+		Topic:  "home/#",
+		Method: "POST",
+		URL:    "https://example.com/{{ .meta.topic }}",
+		Headers: map[string]string{
+			"X-Client":   "{{ .meta.client }}/{{ .meta.clientId }}",
+			"X-Delivery": "{{ .meta.qos }} {{ .meta.retain }} {{ .meta.packetId }}",
+			"X-Reply":    "{{ .meta.responseTopic }}",
+			"X-Room":     "{{ .meta.userProperties.room }}",
+		},
+		Body: `{{ .meta.server }} {{ .meta.contentType }} {{ .meta.payload }}`,
+	}, subscription.Actor{Name: "alice"})
+	require.NoError(t, err)
+
+	jobs := process(t, service, MQTTMessage{
+		Server:         InternalBroker,
+		Topic:          "home/kitchen",
+		Payload:        []byte(`{"on":true}`),
+		QoS:            1,
+		Retain:         true,
+		PacketID:       7,
+		User:           "alice",
+		ClientID:       "sensor-1",
+		ContentType:    "application/json",
+		ResponseTopic:  "home/kitchen/response",
+		UserProperties: map[string]string{"room": "kitchen"},
+	})
+
+	if assert.Len(t, jobs, 1) {
+		sub := jobs[0].Subscription
+
+		assert.Equal(t, "https://example.com/home/kitchen", sub.URL)
+		assert.Equal(t, "alice/sensor-1", sub.Headers["X-Client"])
+		assert.Equal(t, "1 true 7", sub.Headers["X-Delivery"])
+		assert.Equal(t, "home/kitchen/response", sub.Headers["X-Reply"])
+		assert.Equal(t, "kitchen", sub.Headers["X-Room"])
+		assert.Equal(t, InternalBroker+` application/json {"on":true}`, string(jobs[0].Body))
+	}
+}
+
+func TestProcessFiltersOnMissingFields(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := subscription.NewService(store, "")
+	alice := subscription.Actor{Name: "alice"}
+
+	for _, policy := range []string{subscription.ErrorPolicyFailOpen, subscription.ErrorPolicyDeadLetter} {
+		_, err := service.AddSubscription(subscription.Subscription{
+			Name:        "Alarm " + policy,
+			Topic:       "home/" + policy,
+			Extract:     map[string]string{"alarm": "alarm"},
+			Filter:      "extract.alarm",
+			ErrorPolicy: policy,
+			Method:      "POST",
+			URL:         "https://example.com",
+		}, alice)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		payload   string
+		delivered bool
+	}{
+		{payload: `{"alarm": true}`, delivered: true},
+		{payload: `{"alarm": false}`},
+		{payload: `{"temperature": 15}`},
+	}
+
+	for _, policy := range []string{subscription.ErrorPolicyFailOpen, subscription.ErrorPolicyDeadLetter} {
+		for _, tt := range tests {
+			t.Run(policy+" "+tt.payload, func(t *testing.T) {
+				recorder := &recordingPublisher{}
+				deadLetters := deadletter.New()
+
+				p := New(service, recorder, make(chan MQTTMessage, 1), deadLetters, log.New(io.Discard, "", 0))
+				p.Process(MQTTMessage{Server: InternalBroker, Topic: "home/" + policy, Payload: []byte(tt.payload)})
+				p.Wait()
+
+				assert.Equal(t, tt.delivered, len(recorder.jobs) == 1)
+				assert.Empty(t, deadLetters.List(), "Missing fields aren't an error")
+			})
+		}
+	}
+}
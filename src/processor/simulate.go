@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"mqtt-http-bridge/src/subscription"
+)
+
+const (
+	SimulationSkippedRetained = "retained"
+	SimulationFilteredOut     = "filtered"
+)
+
+// Simulation is the outcome of processing a message for a single subscription, without sending the request.
+type Simulation struct {
+	SubscriptionID   string
+	SubscriptionName string
+	// Reason explains why no request would be sent, one of the Simulation constants or the stage that failed
+	Reason string
+	// Errors contains the failing stages, including those the error policy continued after
+	Errors []SimulationError
+	// Request is the request that would be sent, nil when there is none
+	Request *SimulatedRequest
+}
+
+type SimulationError struct {
+	Stage string
+	Error string
+}
+
+type SimulatedRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    []byte
+}
+
+// Simulate processes the message like Process does, but returns the requests instead of sending them. The message
+// isn't logged, and failures don't end up in the dead letter queue. Secrets are redacted from the outcome.
+func (p *processor) Simulate(message MQTTMessage) ([]Simulation, error) {
+	subs, err := p.service.GetSubscriptionsForTopic(message.Topic)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get subscriptions for topic %s: %w", message.Topic, err)
+	}
+
+	globalParams, err := p.service.GetGlobalParameters()
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get global parameters: %w", err)
+	}
+
+	// Subscriptions depending on secrets that couldn't be decrypted report those themselves.
+	secrets, _ := p.service.GetSecrets()
+
+	simulations := make([]Simulation, 0, len(subs))
+
+	for _, sub := range subs {
+		simulation := Simulation{SubscriptionID: sub.ID, SubscriptionName: sub.Name, Errors: []SimulationError{}}
+
+		if sub.SkipRetained && message.Retain {
+			simulation.Reason = SimulationSkippedRetained
+			simulations = append(simulations, simulation)
+
+			continue
+		}
+
+		hydrated, requestBody, err := p.prepare(sub, message, globalParams, secrets, func(sub subscription.Subscription, stage string, err error) bool {
+			simulation.Errors = append(simulation.Errors, SimulationError{Stage: stage, Error: p.service.RedactSecrets(err.Error())})
+
+			return failsOpen(sub)
+		})
+
+		var stageErr *stageError
+
+		switch {
+		case errors.Is(err, errFilteredOut):
+			simulation.Reason = SimulationFilteredOut
+		case errors.As(err, &stageErr):
+			simulation.Reason = stageErr.stage
+
+			if stageErr.stage == stagePlaceholders {
+				simulation.Errors = append(simulation.Errors, SimulationError{Stage: stageErr.stage, Error: p.service.RedactSecrets(stageErr.err.Error())})
+			}
+		default:
+			simulation.Request = p.redactRequest(hydrated, requestBody)
+		}
+
+		simulations = append(simulations, simulation)
+	}
+
+	return simulations, nil
+}
+
+func (p *processor) redactRequest(sub subscription.Subscription, body []byte) *SimulatedRequest {
+	headers := make(map[string]string, len(sub.Headers))
+
+	for key, value := range sub.Headers {
+		headers[key] = p.service.RedactSecrets(value)
+	}
+
+	return &SimulatedRequest{
+		Method:  sub.Method,
+		URL:     p.service.RedactSecrets(sub.URL),
+		Headers: headers,
+		Body:    []byte(p.service.RedactSecrets(string(body))),
+	}
+}
@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log"
+	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/deadletter"
+	"mqtt-http-bridge/src/subscription"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := subscription.NewService(store, "secret-key")
+	alice := subscription.Actor{Name: "alice"}
+
+	require.NoError(t, service.SetSecret("token", "s3cr3t", alice))
+
+	add := func(sub subscription.Subscription) string {
+		added, err := service.AddSubscription(sub, alice)
+		require.NoError(t, err)
+
+		return added.ID
+	}
+
+	lights := add(subscription.Subscription{
+		Name:    "Lights",
+		Topic:   "home/+/lights",
+		Extract: map[string]string{"on": "on"},
+		Filter:  "extract.on = true",
+		Method:  "POST",
+		URL:     "https://lights.example.com/{{ .meta.topic }}?token={{ .secret.token }}",
+		Body:    `{"room": "{{ .meta.topic }}"}`,
+	})
+	retained := add(subscription.Subscription{Name: "Retained", Topic: "home/#", SkipRetained: true, Method: "GET", URL: "https://example.com"})
+	closed := add(subscription.Subscription{Name: "Closed", Topic: "home/#", Extract: map[string]string{"on": "on"}, PayloadFormat: "number", ErrorPolicy: subscription.ErrorPolicyFailClosed, Method: "GET", URL: "https://example.com"})
+
+	deadLetters := deadletter.New()
+	p := New(service, nil, make(chan MQTTMessage), deadLetters, log.New(io.Discard, "", 0))
+
+	byID := func(simulations []Simulation) map[string]Simulation {
+		result := make(map[string]Simulation, len(simulations))
+
+		for _, simulation := range simulations {
+			result[simulation.SubscriptionID] = simulation
+		}
+
+		return result
+	}
+
+	t.Run("delivered", func(t *testing.T) {
+		simulations, err := p.Simulate(MQTTMessage{Server: InternalBroker, Topic: "home/kitchen/lights", Payload: []byte(`{"on": true}`)})
+		require.NoError(t, err)
+		require.Len(t, simulations, 3)
+
+		simulation := byID(simulations)[lights]
+
+		if assert.NotNil(t, simulation.Request) {
+			assert.Equal(t, "POST", simulation.Request.Method)
+			assert.Equal(t, "https://lights.example.com/home/kitchen/lights?token=********", simulation.Request.URL)
+			assert.Equal(t, `{"room": "home/kitchen/lights"}`, string(simulation.Request.Body))
+		}
+
+		assert.Empty(t, simulation.Reason)
+		assert.Empty(t, simulation.Errors)
+	})
+
+	t.Run("filtered out", func(t *testing.T) {
+		simulations, err := p.Simulate(MQTTMessage{Server: InternalBroker, Topic: "home/kitchen/lights", Payload: []byte(`{"on": false}`)})
+		require.NoError(t, err)
+
+		simulation := byID(simulations)[lights]
+		assert.Equal(t, SimulationFilteredOut, simulation.Reason)
+		assert.Nil(t, simulation.Request)
+	})
+
+	t.Run("retained", func(t *testing.T) {
+		simulations, err := p.Simulate(MQTTMessage{Server: InternalBroker, Topic: "home/kitchen/lights", Payload: []byte(`{"on": true}`), Retain: true})
+		require.NoError(t, err)
+
+		assert.Equal(t, SimulationSkippedRetained, byID(simulations)[retained].Reason)
+	})
+
+	t.Run("failing stage", func(t *testing.T) {
+		simulations, err := p.Simulate(MQTTMessage{Server: InternalBroker, Topic: "home/kitchen/lights", Payload: []byte(`{"on": true}`)})
+		require.NoError(t, err)
+
+		simulation := byID(simulations)[closed]
+		assert.Equal(t, stageExtract, simulation.Reason)
+		assert.Len(t, simulation.Errors, 1)
+		assert.Nil(t, simulation.Request)
+		assert.Empty(t, deadLetters.List(), "Simulations should not add dead letters")
+	})
+
+	t.Run("content type set in any case", func(t *testing.T) {
+		plain := add(subscription.Subscription{Name: "Plain", Topic: "office/lights", BodyMode: subscription.BodyModeJSON, Body: `{"on": "{{ .meta.payload }}"}`, Headers: map[string]string{"content-type": "text/plain"}, Method: "POST", URL: "https://example.com"})
+
+		simulations, err := p.Simulate(MQTTMessage{Server: InternalBroker, Topic: "office/lights", Payload: []byte(`on`)})
+		require.NoError(t, err)
+
+		simulation := byID(simulations)[plain]
+
+		if assert.NotNil(t, simulation.Request) {
+			assert.Equal(t, map[string]string{"content-type": "text/plain"}, simulation.Request.Headers)
+		}
+	})
+}
@@ -6,81 +6,234 @@ import (
 	"log"
 	"mqtt-http-bridge/src/subscription"
 	"net/http"
+	"sync"
 )
 
 type Publisher interface {
 	Publish(body []byte, subscription subscription.Subscription)
+	// SetParallel changes the number of workers, removed workers finish the job they are working on.
+	SetParallel(parallel int)
+	// Close stops accepting jobs and waits until the queued jobs are delivered, or the context is done. Requests that
+	// are still running at that point are aborted. It returns the jobs that weren't delivered.
+	Close(ctx context.Context) []Job
 }
 
-type publisher struct {
-	jobs   chan publisherJob
-	logger *log.Logger
+// Job is a request to a subscription, with its placeholders applied.
+type Job struct {
+	Body         []byte                    `json:"body"`
+	Subscription subscription.Subscription `json:"subscription"`
 }
 
-type publisherJob struct {
-	body         []byte
-	subscription subscription.Subscription
+type publisher struct {
+	jobs          chan Job
+	logger        *log.Logger
+	redact        func(string) string
+	ctx           context.Context
+	clientFactory func() *http.Client
+
+	// workers contains a function to stop each running worker
+	workers []context.CancelFunc
+	mu      sync.Mutex
+	running sync.WaitGroup
+
+	// abort cancels the running requests once the deadline for closing has passed
+	requestCtx context.Context
+	abort      context.CancelFunc
+
+	// done is closed when closing starts, closed is set at the same time so no more jobs are accepted
+	done     chan struct{}
+	closed   bool
+	closedMu sync.RWMutex
+	// publishing tracks the Publish calls that are waiting for room in the queue
+	publishing sync.WaitGroup
+
+	undelivered   []Job
+	undeliveredMu sync.Mutex
 }
 
-func New(ctx context.Context, parallel int, clientFactory func() *http.Client, logger *log.Logger) *publisher {
-	p := &publisher{
-		jobs:   make(chan publisherJob, 100),
-		logger: logger,
+// New creates a publisher with the given number of workers, redact is applied to everything that is logged, so the
+// values of secrets don't end up in the logs.
+func New(ctx context.Context, parallel int, clientFactory func() *http.Client, redact func(string) string, logger *log.Logger) *publisher {
+	if redact == nil {
+		redact = func(s string) string { return s }
 	}
 
-	for range parallel {
-		client := clientFactory()
+	requestCtx, abort := context.WithCancel(context.Background())
 
-		go p.start(ctx, client)
+	p := &publisher{
+		jobs:          make(chan Job, 100),
+		logger:        logger,
+		redact:        redact,
+		ctx:           ctx,
+		clientFactory: clientFactory,
+		requestCtx:    requestCtx,
+		abort:         abort,
+		done:          make(chan struct{}),
 	}
 
+	p.SetParallel(parallel)
+
 	return p
 }
 
 func (p *publisher) Publish(body []byte, subscription subscription.Subscription) {
-	p.jobs <- publisherJob{
-		body:         body,
-		subscription: subscription,
+	job := Job{
+		Body:         body,
+		Subscription: subscription,
+	}
+
+	p.closedMu.RLock()
+
+	if p.closed {
+		p.closedMu.RUnlock()
+		p.logger.Printf("Publisher is closed, dropping message to subscription %s\n", subscription.ID)
+		return
+	}
+
+	p.publishing.Add(1)
+	p.closedMu.RUnlock()
+
+	defer p.publishing.Done()
+
+	// The lock isn't held while waiting for room in the queue, so closing isn't blocked by a full queue.
+	select {
+	case p.jobs <- job:
+	case <-p.done:
+		p.keepUndelivered(job)
 	}
 }
 
+func (p *publisher) SetParallel(parallel int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.workers) < parallel {
+		ctx, cancel := context.WithCancel(p.ctx)
+		p.workers = append(p.workers, cancel)
+		p.running.Add(1)
+
+		go p.start(ctx, p.clientFactory())
+	}
+
+	for len(p.workers) > parallel {
+		p.workers[len(p.workers)-1]()
+		p.workers = p.workers[:len(p.workers)-1]
+	}
+}
+
+func (p *publisher) Close(ctx context.Context) []Job {
+	p.closedMu.Lock()
+
+	if p.closed {
+		p.closedMu.Unlock()
+		return nil
+	}
+
+	p.closed = true
+	close(p.done)
+	p.closedMu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		p.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.abort()
+		<-done
+	}
+
+	p.abort()
+	p.publishing.Wait()
+
+	// Jobs are left in the queue when there are no workers, e.g. because the context of the publisher was done, or
+	// when they were added while the workers were stopping.
+	for len(p.jobs) > 0 {
+		p.keepUndelivered(<-p.jobs)
+	}
+
+	p.undeliveredMu.Lock()
+	defer p.undeliveredMu.Unlock()
+
+	return p.undelivered
+}
+
+func (p *publisher) keepUndelivered(job Job) {
+	p.undeliveredMu.Lock()
+	defer p.undeliveredMu.Unlock()
+
+	p.undelivered = append(p.undelivered, job)
+}
+
 func (p *publisher) start(ctx context.Context, client *http.Client) {
+	defer p.running.Done()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-p.done:
+			// Closing, the worker stops once the queue is drained.
+			p.drain(ctx, client)
+			return
+		case job := <-p.jobs:
+			p.publish(job, client)
+		}
+	}
+}
+
+// drain publishes the queued jobs until the queue is empty, or the worker is stopped.
+func (p *publisher) drain(ctx context.Context, client *http.Client) {
+	for ctx.Err() == nil {
+		select {
 		case job := <-p.jobs:
-			p.doPublish(job, client)
+			p.publish(job, client)
+		default:
+			return
 		}
 	}
 }
 
-func (p *publisher) doPublish(job publisherJob, client *http.Client) {
-	p.logger.Printf("Publishing message to subscription %s (%s %s %s)\n", job.subscription.ID, job.subscription.Method, job.subscription.URL, job.body)
+func (p *publisher) publish(job Job, client *http.Client) {
+	// Only requests aborted by closing are kept, others failed on their own and would fail again.
+	if !p.doPublish(job, client) && p.requestCtx.Err() != nil {
+		p.keepUndelivered(job)
+	}
+}
+
+// doPublish sends the request of the job, and reports whether it was delivered.
+func (p *publisher) doPublish(job Job, client *http.Client) bool {
+	p.logger.Printf("Publishing message to subscription %s (%s %s %s)\n", job.Subscription.ID, job.Subscription.Method, p.redact(job.Subscription.URL), p.redact(string(job.Body)))
 
-	req, err := http.NewRequest(job.subscription.Method, job.subscription.URL, bytes.NewReader(job.body))
+	req, err := http.NewRequestWithContext(p.requestCtx, job.Subscription.Method, job.Subscription.URL, bytes.NewReader(job.Body))
 	if err != nil {
-		p.logger.Printf("Error creating request for subscription %s: %s\n", job.subscription.ID, err)
-		return
+		p.logger.Printf("Error creating request for subscription %s: %s\n", job.Subscription.ID, p.redact(err.Error()))
+		return false
 	}
 
-	for k, v := range job.subscription.Headers {
+	for k, v := range job.Subscription.Headers {
 		req.Header.Add(k, v)
 	}
 
-	req.Header.Add("Subscription-ID", job.subscription.ID)
-	req.Header.Add("Subscription-Name", job.subscription.Name)
+	req.Header.Add("Subscription-ID", job.Subscription.ID)
+	req.Header.Add("Subscription-Name", job.Subscription.Name)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		p.logger.Printf("Error publishing message to subscription %s: %s\n", job.subscription.ID, err)
-		return
+		p.logger.Printf("Error publishing message to subscription %s: %s\n", job.Subscription.ID, p.redact(err.Error()))
+		return false
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		p.logger.Printf("Unexpected status code publishing message to subscription %s: %s\n", job.subscription.ID, resp.Status)
-		return
+		p.logger.Printf("Unexpected status code publishing message to subscription %s: %s\n", job.Subscription.ID, resp.Status)
+		return false
 	}
+
+	return true
 }
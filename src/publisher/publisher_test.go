@@ -0,0 +1,125 @@
+package publisher
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCloseDrainsQueue(t *testing.T) {
+	var delivered atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		delivered.Add(1)
+	}))
+	defer server.Close()
+
+	p := New(context.Background(), 2, func() *http.Client { return &http.Client{} }, nil, log.New(io.Discard, "", 0))
+
+	for range 10 {
+		p.Publish(nil, subscription.Subscription{ID: "sub", Method: http.MethodPost, URL: server.URL})
+	}
+
+	assert.Empty(t, p.Close(context.Background()))
+	assert.Equal(t, int32(10), delivered.Load())
+
+	// Messages published after closing are dropped rather than blocking forever.
+	p.Publish(nil, subscription.Subscription{ID: "late", Method: http.MethodPost, URL: server.URL})
+	assert.Nil(t, p.Close(context.Background()))
+}
+
+func TestCloseReturnsUndeliveredAfterDeadline(t *testing.T) {
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	p := New(context.Background(), 1, func() *http.Client { return &http.Client{} }, nil, log.New(io.Discard, "", 0))
+
+	for _, id := range []string{"a", "b", "c"} {
+		p.Publish([]byte(id), subscription.Subscription{ID: id, Method: http.MethodPost, URL: server.URL})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	undelivered := p.Close(ctx)
+
+	ids := make([]string, 0, len(undelivered))
+
+	for _, job := range undelivered {
+		ids = append(ids, job.Subscription.ID)
+		assert.Equal(t, job.Subscription.ID, string(job.Body))
+	}
+
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, ids)
+}
+
+func TestSetParallel(t *testing.T) {
+	p := New(context.Background(), 3, func() *http.Client { return &http.Client{} }, nil, log.New(io.Discard, "", 0))
+
+	p.SetParallel(1)
+	assert.Len(t, p.workers, 1)
+
+	p.SetParallel(4)
+	assert.Len(t, p.workers, 4)
+
+	assert.Empty(t, p.Close(context.Background()))
+}
+
+func TestCloseWithFullQueue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	p := New(context.Background(), 1, func() *http.Client { return &http.Client{} }, nil, log.New(io.Discard, "", 0))
+
+	var publishing sync.WaitGroup
+
+	// One job is being sent, the queue holds 100 and the last ones wait for room.
+	for range 103 {
+		publishing.Add(1)
+
+		go func() {
+			defer publishing.Done()
+			p.Publish(nil, subscription.Subscription{ID: "sub", Method: http.MethodPost, URL: server.URL})
+		}()
+	}
+
+	require.Eventually(t, func() bool { return len(p.jobs) == cap(p.jobs) }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	closed := make(chan []Job)
+
+	go func() {
+		closed <- p.Close(ctx)
+	}()
+
+	select {
+	case undelivered := <-closed:
+		assert.GreaterOrEqual(t, len(undelivered), 101)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close didn't return after the deadline")
+	}
+
+	publishing.Wait()
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+)
+
+// actorHeaders are set by authenticating reverse proxies to pass on the identity of the user.
+var actorHeaders = []string{"X-Forwarded-User", "X-Remote-User", "Remote-User"}
+
+// actor returns who makes the request and from where, the name is empty when unknown. The API has no authentication
+// of its own, so the identity comes from basic auth, or from the header set by a reverse proxy in front of it. It's
+// only used to attribute changes, never to authorize them.
+func actor(c echo.Context) subscription.Actor {
+	return subscription.Actor{
+		Name:     actorName(c),
+		SourceIP: c.RealIP(),
+	}
+}
+
+func actorName(c echo.Context) string {
+	if username, _, ok := c.Request().BasicAuth(); ok {
+		return username
+	}
+
+	for _, header := range actorHeaders {
+		if user := c.Request().Header.Get(header); user != "" {
+			return user
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+	"time"
+)
+
+type listAuditEntriesRequest struct {
+	EntityType string `query:"entityType" validate:"omitempty,oneof=subscription blueprint globalParameter secret store"`
+	EntityID   string `query:"entityId"`
+	Actor      string `query:"actor"`
+	// From and To are RFC 3339 timestamps, both inclusive
+	From time.Time `query:"from"`
+	To   time.Time `query:"to"`
+}
+
+func listAuditEntries(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req listAuditEntriesRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		entries, err := service.GetAuditEntries(subscription.AuditFilter{
+			EntityType: req.EntityType,
+			EntityID:   req.EntityID,
+			Actor:      req.Actor,
+			From:       req.From,
+			To:         req.To,
+		})
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to list audit entries: %w", err))
+		}
+
+		response := make([]any, 0, len(entries))
+
+		for _, entry := range entries {
+			response = append(response, auditEntryToResponse(entry))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"entries": response})
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+)
+
+type blueprintRequest struct {
+	Name        string                      `json:"name" validate:"required"`
+	Description string                      `json:"description"`
+	Parameters  []blueprintParameterRequest `json:"parameters" validate:"dive"`
+	// Subscription is the subscription of every instance, its fields can refer to the parameters as {{ .param.name }}
+	Subscription updateSubscriptionRequest `json:"subscription"`
+}
+
+type blueprintParameterRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	Default     string `json:"default"`
+	Required    bool   `json:"required"`
+}
+
+func (req blueprintRequest) toBlueprint(id string) subscription.Blueprint {
+	params := make([]subscription.BlueprintParameter, 0, len(req.Parameters))
+
+	for _, param := range req.Parameters {
+		params = append(params, subscription.BlueprintParameter{
+			Name:        param.Name,
+			Description: param.Description,
+			Default:     param.Default,
+			Required:    param.Required,
+		})
+	}
+
+	return subscription.Blueprint{
+		ID:           id,
+		Name:         req.Name,
+		Description:  req.Description,
+		Parameters:   params,
+		Subscription: req.Subscription.toSubscription("", 0),
+	}
+}
+
+func (req blueprintRequest) validateExpressions() []error {
+	return validateSubscriptionExpressions(req.Subscription.Filter, req.Subscription.Extract, req.Subscription.Body, req.Subscription.BodyMode)
+}
+
+func addBlueprint(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req blueprintRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		if errs := req.validateExpressions(); len(errs) > 0 {
+			return ErrorResponse(c, http.StatusBadRequest, errs)
+		}
+
+		blueprint, err := service.AddBlueprint(req.toBlueprint(""), actor(c))
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to add blueprint: %w", err))
+		}
+
+		return c.JSON(http.StatusCreated, map[string]any{"blueprint": blueprintToResponse(blueprint)})
+	}
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+)
+
+type deleteBlueprintRequest struct {
+	ID string `param:"id" validate:"required"`
+}
+
+// deleteBlueprint removes the blueprint, which is refused while subscriptions are instances of it.
+func deleteBlueprint(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req deleteBlueprintRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		if err := service.DeleteBlueprint(req.ID, actor(c)); err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to delete blueprint: %w", err))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"status": "success"})
+	}
+}
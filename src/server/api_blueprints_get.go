@@ -0,0 +1,30 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+)
+
+type getBlueprintRequest struct {
+	ID string `param:"id" validate:"required"`
+}
+
+func getBlueprint(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req getBlueprintRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		blueprint, err := service.GetBlueprint(req.ID)
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to get blueprint: %w", err))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"blueprint": blueprintToResponse(blueprint)})
+	}
+}
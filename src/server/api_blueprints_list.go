@@ -0,0 +1,21 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"mqtt-http-bridge/src/utilities"
+	"net/http"
+)
+
+func listBlueprints(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		blueprints, err := service.GetBlueprints()
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to list blueprints: %w", err))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"blueprints": utilities.MapSlice(blueprints, blueprintToResponse)})
+	}
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+)
+
+// updateBlueprint replaces the blueprint, the changes apply to all of its instances.
+func updateBlueprint(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req blueprintRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		if errs := req.validateExpressions(); len(errs) > 0 {
+			return ErrorResponse(c, http.StatusBadRequest, errs)
+		}
+
+		blueprint, err := service.UpdateBlueprint(req.toBlueprint(c.Param("id")), actor(c))
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to update blueprint: %w", err))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"blueprint": blueprintToResponse(blueprint)})
+	}
+}
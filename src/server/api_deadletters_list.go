@@ -0,0 +1,13 @@
+package server
+
+import (
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/deadletter"
+	"net/http"
+)
+
+func listDeadLetters(deadLetters deadletter.Queue) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]any{"deadLetters": deadLetters.List()})
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+)
+
+type exportRequest struct {
+	Format string `query:"format" validate:"omitempty,oneof=json yaml"`
+	// Secrets are included unless explicitly disabled
+	Secrets *bool `query:"secrets"`
+}
+
+func export(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req exportRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		bundle, err := service.Export(req.Secrets == nil || *req.Secrets)
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to export: %w", err))
+		}
+
+		if req.Format != subscription.BundleFormatYAML {
+			return c.JSON(http.StatusOK, bundle)
+		}
+
+		data, err := subscription.MarshalBundle(bundle, subscription.BundleFormatYAML)
+
+		if err != nil {
+			return ErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("failed to export: %w", err))
+		}
+
+		return c.Blob(http.StatusOK, "application/yaml", data)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 type deleteGlobalParameterRequest struct {
 	Parameter string `param:"parameter" validate:"required"`
+	Type      string `query:"type" validate:"omitempty,oneof=value secret"`
 }
 
 func deleteGlobalParameter(service subscription.Service) echo.HandlerFunc {
@@ -20,7 +21,15 @@ func deleteGlobalParameter(service subscription.Service) echo.HandlerFunc {
 			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
 		}
 
-		if err := service.DeleteGlobalParameter(strings.TrimSpace(req.Parameter)); err != nil {
+		if req.Type == parameterTypeSecret {
+			if err := service.DeleteSecret(strings.TrimSpace(req.Parameter), actor(c)); err != nil {
+				return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to delete secret: %w", err))
+			}
+
+			return c.JSON(http.StatusOK, map[string]any{"status": "ok"})
+		}
+
+		if err := service.DeleteGlobalParameter(strings.TrimSpace(req.Parameter), actor(c)); err != nil {
 			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to set global parameter: %w", err))
 		}
 
@@ -15,6 +15,23 @@ func listGlobalParameters(service subscription.Service) echo.HandlerFunc {
 			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to list global parameters: %w", err))
 		}
 
-		return c.JSON(http.StatusOK, map[string]interface{}{"parameters": params})
+		secretKeys, err := service.GetSecretKeys()
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to list secrets: %w", err))
+		}
+
+		// Secrets are write-only, only their names are exposed.
+		secrets := make(map[string]string, len(secretKeys))
+
+		for _, key := range secretKeys {
+			secrets[key] = maskedSecret
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"parameters": params,
+			"secrets":    secrets,
+			"readOnly":   service.GetConfiguredGlobalParameterKeys(),
+		})
 	}
 }
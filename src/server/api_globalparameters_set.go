@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"mqtt-http-bridge/src/subscription"
@@ -9,8 +10,11 @@ import (
 )
 
 type setGlobalParameterRequest struct {
-	Key   string `json:"key" validate:"required"`
-	Value string `json:"value" validate:"required"`
+	Key string `json:"key" validate:"required"`
+	// Value is any JSON value, secrets only support strings
+	Value json.RawMessage `json:"value" validate:"required"`
+	// Type is either "value" (default) or "secret", secrets are encrypted at rest and can't be read back
+	Type string `json:"type" validate:"omitempty,oneof=value secret"`
 }
 
 func setGlobalParameter(service subscription.Service) echo.HandlerFunc {
@@ -21,7 +25,31 @@ func setGlobalParameter(service subscription.Service) echo.HandlerFunc {
 			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
 		}
 
-		if err := service.SetGlobalParameter(strings.TrimSpace(req.Key), strings.TrimSpace(req.Value)); err != nil {
+		var value any
+
+		if err := json.Unmarshal(req.Value, &value); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid value: %w", err))
+		}
+
+		if s, ok := value.(string); ok {
+			value = strings.TrimSpace(s)
+		}
+
+		if req.Type == parameterTypeSecret {
+			secret, ok := value.(string)
+
+			if !ok {
+				return ErrorResponse(c, http.StatusBadRequest, "secrets can only be strings")
+			}
+
+			if err := service.SetSecret(strings.TrimSpace(req.Key), secret, actor(c)); err != nil {
+				return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to set secret: %w", err))
+			}
+
+			return c.JSON(http.StatusOK, map[string]any{"status": "ok"})
+		}
+
+		if err := service.SetGlobalParameter(strings.TrimSpace(req.Key), value, actor(c)); err != nil {
 			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to set global parameter: %w", err))
 		}
 
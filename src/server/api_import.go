@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+	"strings"
+)
+
+type importRequest struct {
+	// Format defaults to yaml when the content type mentions yaml, and json otherwise
+	Format   string `query:"format" validate:"omitempty,oneof=json yaml"`
+	Mode     string `query:"mode" validate:"omitempty,oneof=merge replace"`
+	Conflict string `query:"conflict" validate:"omitempty,oneof=overwrite skip fail rename"`
+	DryRun   bool   `query:"dryRun"`
+}
+
+func importBundle(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req importRequest
+
+		// The body is the bundle itself, so only the query parameters are bound.
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, &req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		if err := c.Validate(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		if req.Format == "" && strings.Contains(c.Request().Header.Get(echo.HeaderContentType), "yaml") {
+			req.Format = subscription.BundleFormatYAML
+		}
+
+		data, err := io.ReadAll(c.Request().Body)
+
+		if err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		bundle, err := subscription.ParseBundle(data, req.Format)
+
+		if err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid bundle: %w", err))
+		}
+
+		if err := ValidateBundle(bundle); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, err)
+		}
+
+		changes, err := service.Import(bundle, subscription.ImportOptions{
+			Mode:     req.Mode,
+			Conflict: req.Conflict,
+			DryRun:   req.DryRun,
+			Actor:    actor(c),
+		})
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to import: %w", err))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"dryRun": req.DryRun, "changes": changes})
+	}
+}
+
+// ValidateBundle validates all subscriptions in the bundle the same way the API does.
+func ValidateBundle(bundle subscription.Bundle) error {
+	var errs []error
+
+	for i, sub := range bundle.Subscriptions {
+		if err := ValidateSubscriptionRecord(sub); err != nil {
+			errs = append(errs, fmt.Errorf("subscription %d (%s): %w", i, sub.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
@@ -9,6 +10,7 @@ import (
 	"slices"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 const defaultHistorySize = 50
@@ -121,21 +123,34 @@ func (s *mqttSocketServer) addMessageToHistory(m processor.MQTTMessage) historyE
 
 func (s *mqttSocketServer) historyEntryToSocketMessage(e historyEntry) []byte {
 	type socketMessage struct {
-		Server    string `json:"server"`
-		Topic     string `json:"topic"`
-		Payload   string `json:"payload"`
-		User      string `json:"user"`
-		Sequence  int    `json:"sequence"`
-		Timestamp string `json:"timestamp"`
+		Server  string `json:"server"`
+		Topic   string `json:"topic"`
+		Payload string `json:"payload"`
+		// PayloadEncoding is set to base64 when the payload is not valid UTF-8
+		PayloadEncoding string `json:"payloadEncoding,omitempty"`
+		QoS             byte   `json:"qos"`
+		Retain          bool   `json:"retain"`
+		User            string `json:"user"`
+		Sequence        int    `json:"sequence"`
+		Timestamp       string `json:"timestamp"`
+	}
+
+	payload, payloadEncoding := string(e.message.Payload), ""
+
+	if !utf8.Valid(e.message.Payload) {
+		payload, payloadEncoding = base64.StdEncoding.EncodeToString(e.message.Payload), "base64"
 	}
 
 	b, err := json.Marshal(socketMessage{
-		Server:    e.message.Server,
-		Topic:     e.message.Topic,
-		Payload:   e.message.Payload,
-		User:      e.message.User,
-		Sequence:  e.sequence,
-		Timestamp: e.timestamp.Format(time.RFC3339),
+		Server:          e.message.Server,
+		Topic:           e.message.Topic,
+		Payload:         payload,
+		PayloadEncoding: payloadEncoding,
+		QoS:             e.message.QoS,
+		Retain:          e.message.Retain,
+		User:            e.message.User,
+		Sequence:        e.sequence,
+		Timestamp:       e.timestamp.Format(time.RFC3339),
 	})
 
 	if err != nil {
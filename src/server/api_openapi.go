@@ -0,0 +1,18 @@
+package server
+
+import (
+	_ "embed"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// openAPISpec documents all routes of the API, the contract tests make sure the handlers conform to it.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func openAPI() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, openAPISpec)
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/processor"
+	"net/http"
+)
+
+type simulateRequest struct {
+	// Server is the broker the message appears to come from, defaults to the internal broker
+	Server  string `json:"server"`
+	Topic   string `json:"topic" validate:"required"`
+	Payload string `json:"payload"`
+	// PayloadEncoding is set to base64 for binary payloads
+	PayloadEncoding string            `json:"payloadEncoding" validate:"omitempty,oneof=base64"`
+	Retain          bool              `json:"retain"`
+	UserProperties  map[string]string `json:"userProperties"`
+}
+
+// simulate runs a message through the matching subscriptions and returns the requests they would send, without
+// sending them.
+func simulate(proc processor.Processor) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req simulateRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		payload := []byte(req.Payload)
+
+		if req.PayloadEncoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(req.Payload)
+
+			if err != nil {
+				return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid payload: %w", err))
+			}
+
+			payload = decoded
+		}
+
+		if req.Server == "" {
+			req.Server = processor.InternalBroker
+		}
+
+		simulations, err := proc.Simulate(processor.MQTTMessage{
+			Server:         req.Server,
+			Topic:          req.Topic,
+			Payload:        payload,
+			Retain:         req.Retain,
+			UserProperties: req.UserProperties,
+		})
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to simulate message: %w", err))
+		}
+
+		response := make([]any, 0, len(simulations))
+
+		for _, simulation := range simulations {
+			response = append(response, simulationToResponse(simulation))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"results": response})
+	}
+}
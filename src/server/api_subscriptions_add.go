@@ -8,16 +8,33 @@ import (
 )
 
 type addSubscriptionRequest struct {
-	Name  string `json:"name" validate:"required"`
-	Topic string `json:"topic" validate:"required"`
+	Name  string `json:"name" validate:"required_without=BlueprintID"`
+	Topic string `json:"topic" validate:"required_without=BlueprintID"`
+
+	// BlueprintID makes the subscription an instance of the blueprint, which provides all fields except the name, tags,
+	// group and enabled state
+	BlueprintID string            `json:"blueprintId"`
+	Parameters  map[string]string `json:"parameters"`
+
+	Tags    []string `json:"tags" validate:"dive,required"`
+	Group   string   `json:"group"`
+	Enabled *bool    `json:"enabled"`
 
 	Extract map[string]string `json:"extract"`
 	Filter  string            `json:"filter"`
 
-	Method  string            `json:"method" validate:"required,oneof=GET POST PUT PATCH DELETE"`
-	URL     string            `json:"url" validate:"required"`
+	PayloadFormat string `json:"payloadFormat" validate:"omitempty,oneof=json text number csv cbor msgpack base64"`
+	SkipRetained  bool   `json:"skipRetained"`
+	ErrorPolicy   string `json:"errorPolicy" validate:"omitempty,oneof=fail-open fail-closed dead-letter"`
+
+	StrictPlaceholders bool `json:"strictPlaceholders"`
+
+	Method  string            `json:"method" validate:"required_without=BlueprintID,omitempty,oneof=GET POST PUT PATCH DELETE"`
+	URL     string            `json:"url" validate:"required_without=BlueprintID"`
 	Headers map[string]string `json:"headers"`
 	Body    string            `json:"body"`
+
+	BodyMode string `json:"bodyMode" validate:"omitempty,oneof=template json jsonata"`
 }
 
 func addSubscription(service subscription.Service) echo.HandlerFunc {
@@ -28,23 +45,44 @@ func addSubscription(service subscription.Service) echo.HandlerFunc {
 			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
 		}
 
+		if errs := validateSubscriptionExpressions(req.Filter, req.Extract, req.Body, req.BodyMode); len(errs) > 0 {
+			return ErrorResponse(c, http.StatusBadRequest, errs)
+		}
+
 		sub, err := service.AddSubscription(subscription.Subscription{
 			Name:  req.Name,
 			Topic: req.Topic,
 
+			Tags:     req.Tags,
+			Group:    req.Group,
+			Disabled: req.Enabled != nil && !*req.Enabled,
+
+			BlueprintID: req.BlueprintID,
+			Parameters:  req.Parameters,
+
 			Extract: req.Extract,
 			Filter:  req.Filter,
 
+			PayloadFormat: req.PayloadFormat,
+			SkipRetained:  req.SkipRetained,
+			ErrorPolicy:   req.ErrorPolicy,
+
+			StrictPlaceholders: req.StrictPlaceholders,
+
 			Method:  req.Method,
 			URL:     req.URL,
 			Headers: req.Headers,
 			Body:    req.Body,
-		})
+
+			BodyMode: req.BodyMode,
+		}, actor(c))
 
 		if err != nil {
 			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to add subscription: %w", err))
 		}
 
+		setETag(c, sub.Version)
+
 		return c.JSON(http.StatusCreated, map[string]any{"subscription": subscriptionToResponse(sub)})
 	}
 }
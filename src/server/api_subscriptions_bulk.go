@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+)
+
+type bulkSubscriptionsRequest struct {
+	Action   string               `json:"action" validate:"required,oneof=enable disable delete"`
+	Selector subscriptionSelector `json:"selector"`
+}
+
+// bulkSubscriptions enables, disables or deletes all subscriptions matching the selector, which uses the same fields
+// as the query parameters of the list.
+func bulkSubscriptions(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req bulkSubscriptionsRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		ids, err := service.ApplyBulkAction(req.Selector.toFilter(), req.Action, actor(c))
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to %s subscriptions: %w", req.Action, err))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"affected": ids})
+	}
+}
@@ -19,7 +19,13 @@ func deleteSubscription(service subscription.Service) echo.HandlerFunc {
 			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
 		}
 
-		if err := service.DeleteSubscription(req.ID); err != nil {
+		version, err := ifMatchVersion(c)
+
+		if err != nil {
+			return ErrorResponse(c, ifMatchErrorCode(err), err)
+		}
+
+		if err := service.DeleteSubscription(req.ID, version, actor(c)); err != nil {
 			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to delete subscription: %w", err))
 		}
 
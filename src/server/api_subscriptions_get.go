@@ -25,6 +25,8 @@ func getSubscription(service subscription.Service) echo.HandlerFunc {
 			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to get subscription: %w", err))
 		}
 
+		setETag(c, sub.Version)
+
 		return c.JSON(http.StatusOK, map[string]interface{}{"subscription": subscriptionToResponse(sub)})
 	}
 }
@@ -8,14 +8,62 @@ import (
 	"net/http"
 )
 
+// subscriptionSelector selects subscriptions by the query parameters of the list, or the selector of a bulk action.
+type subscriptionSelector struct {
+	// Tags must all be present, e.g. ?tag=lights&tag=kitchen
+	Tags        []string `query:"tag" json:"tags"`
+	Group       string   `query:"group" json:"group"`
+	TopicPrefix string   `query:"topicPrefix" json:"topicPrefix"`
+	Host        string   `query:"host" json:"host"`
+	Enabled     *bool    `query:"enabled" json:"enabled"`
+	Search      string   `query:"q" json:"q"`
+	BlueprintID string   `query:"blueprintId" json:"blueprintId"`
+}
+
+func (s subscriptionSelector) toFilter() subscription.SubscriptionFilter {
+	return subscription.SubscriptionFilter{
+		Tags:        s.Tags,
+		Group:       s.Group,
+		TopicPrefix: s.TopicPrefix,
+		Host:        s.Host,
+		Enabled:     s.Enabled,
+		Search:      s.Search,
+		BlueprintID: s.BlueprintID,
+	}
+}
+
+type listSubscriptionsRequest struct {
+	Selector subscriptionSelector
+
+	// Limit is the maximum number of subscriptions to return, all are returned when omitted
+	Limit  int `query:"limit" validate:"omitempty,min=1,max=1000"`
+	Offset int `query:"offset" validate:"min=0"`
+}
+
 func listSubscriptions(service subscription.Service) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		subs, err := service.GetSubscriptions()
+		var req listSubscriptionsRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		subs, err := service.FindSubscriptions(req.Selector.toFilter())
 
 		if err != nil {
 			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to list subscriptions: %w", err))
 		}
 
-		return c.JSON(http.StatusOK, map[string]interface{}{"subscriptions": utilities.MapSlice(subs, subscriptionToResponse)})
+		total := len(subs)
+		subs = subs[min(req.Offset, total):]
+
+		if req.Limit > 0 && req.Limit < len(subs) {
+			subs = subs[:req.Limit]
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"subscriptions": utilities.MapSlice(subs, subscriptionToResponse),
+			"total":         total,
+		})
 	}
 }
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"mqtt-http-bridge/src/subscription"
+	"mqtt-http-bridge/src/utilities"
+	"net/http"
+)
+
+// patchSubscription applies a JSON Merge Patch (RFC 7396) to the subscription as it's returned by the API, e.g.
+// {"filter": null} removes the filter and {"headers": {"X-Token": "abc"}} adds or replaces a single header.
+func patchSubscription(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		version, err := ifMatchVersion(c)
+
+		if err != nil {
+			return ErrorResponse(c, ifMatchErrorCode(err), err)
+		}
+
+		patch, err := io.ReadAll(c.Request().Body)
+
+		if err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		current, err := service.GetSubscription(c.Param("id"))
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to get subscription: %w", err))
+		}
+
+		if version == 0 {
+			// The patch must be applied to the version it was merged with.
+			version = current.Version
+		}
+
+		document, err := json.Marshal(subscriptionToResponse(current))
+
+		if err != nil {
+			return ErrorResponse(c, http.StatusInternalServerError, fmt.Errorf("failed to patch subscription: %w", err))
+		}
+
+		patched, err := utilities.MergePatch(document, patch)
+
+		if err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		var req updateSubscriptionRequest
+
+		if err := json.Unmarshal(patched, &req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		if err := c.Validate(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		if errs := validateSubscriptionExpressions(req.Filter, req.Extract, req.Body, req.BodyMode); len(errs) > 0 {
+			return ErrorResponse(c, http.StatusBadRequest, errs)
+		}
+
+		sub, err := service.UpdateSubscription(req.toSubscription(current.ID, version), actor(c))
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to update subscription: %w", err))
+		}
+
+		setETag(c, sub.Version)
+
+		return c.JSON(http.StatusOK, map[string]any{"subscription": subscriptionToResponse(sub)})
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+)
+
+type listRevisionsRequest struct {
+	ID string `param:"id" validate:"required"`
+}
+
+func listRevisions(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req listRevisionsRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		revisions, err := service.GetRevisions(req.ID)
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to list revisions: %w", err))
+		}
+
+		response := make([]any, 0, len(revisions))
+
+		for _, rev := range revisions {
+			response = append(response, revisionToResponse(rev))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{"revisions": response})
+	}
+}
+
+type restoreRevisionRequest struct {
+	ID       string `param:"id" validate:"required"`
+	Revision int    `param:"revision" validate:"required,min=1"`
+}
+
+func restoreRevision(service subscription.Service) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req restoreRevisionRequest
+
+		if err := c.Bind(&req); err != nil {
+			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		}
+
+		sub, err := service.RestoreRevision(req.ID, req.Revision, actor(c))
+
+		if err != nil {
+			return ErrorResponse(c, mapErrorCode(err), fmt.Errorf("failed to restore revision: %w", err))
+		}
+
+		setETag(c, sub.Version)
+
+		return c.JSON(http.StatusOK, map[string]any{"subscription": subscriptionToResponse(sub)})
+	}
+}
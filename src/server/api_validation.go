@@ -1,16 +1,22 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/blues/jsonata-go"
 	"github.com/labstack/echo/v4"
+	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/subscription"
+	"mqtt-http-bridge/src/utilities"
 	"net/http"
 	"regexp"
+	"slices"
 	"text/template"
 )
 
 type validationRequest struct {
-	ValidationType string `json:"type" validate:"required,oneof=jsonata template"`
+	ValidationType string `json:"type" validate:"required,oneof=jsonata template json"`
 	Subject        string `json:"subject" validate:"required"`
 }
 
@@ -34,6 +40,12 @@ func validate() echo.HandlerFunc {
 				return c.JSON(http.StatusOK, map[string]any{"error": err.Error()})
 			}
 
+			return c.JSON(http.StatusOK, nil)
+		case "json":
+			if err := validateJSONTemplate(req.Subject); err != nil {
+				return c.JSON(http.StatusOK, map[string]any{"error": err.Error()})
+			}
+
 			return c.JSON(http.StatusOK, nil)
 		default:
 			return ErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid validation type: %s", req.ValidationType))
@@ -52,7 +64,7 @@ func validateJsonata(filter string) error {
 }
 
 func validateTemplate(templateString string) error {
-	_, err := template.New("test").Parse(templateString)
+	_, err := template.New("test").Funcs(utilities.TemplateFuncs()).Parse(templateString)
 
 	if err == nil {
 		return nil
@@ -68,3 +80,118 @@ func validateTemplate(templateString string) error {
 
 	return fmt.Errorf("invalid template: %s", errMessage)
 }
+
+func validateJSONTemplate(document string) error {
+	var decoded any
+
+	if err := json.Unmarshal([]byte(document), &decoded); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+
+	return validateJSONTemplateValue(decoded)
+}
+
+func validateJSONTemplateValue(value any) error {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if err := validateTemplate(key); err != nil {
+				return err
+			}
+
+			if err := validateJSONTemplateValue(item); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := validateJSONTemplateValue(item); err != nil {
+				return err
+			}
+		}
+	case string:
+		return validateTemplate(v)
+	}
+
+	return nil
+}
+
+var templateActionRegexp = regexp.MustCompile(`\{\{[^}]*\}\}`)
+
+// validateSubscriptionExpressions compiles the filter, extract expressions and body of a subscription, so mistakes are
+// reported when saving the subscription, rather than when processing messages.
+func validateSubscriptionExpressions(filter string, extract map[string]string, body string, bodyMode string) []error {
+	var errs []error
+
+	if filter != "" {
+		// Placeholders in the filter are replaced before it's evaluated, so they're validated separately.
+		if err := validateTemplate(filter); err != nil {
+			errs = append(errs, fmt.Errorf("filter: %w", err))
+		} else if err := validateJsonata(templateActionRegexp.ReplaceAllString(filter, "null")); err != nil {
+			errs = append(errs, fmt.Errorf("filter: %w", err))
+		}
+	}
+
+	keys := make([]string, 0, len(extract))
+
+	for key := range extract {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if err := validateJsonata(extract[key]); err != nil {
+			errs = append(errs, fmt.Errorf("extract %s: %w", key, err))
+		}
+	}
+
+	if body != "" {
+		var err error
+
+		switch bodyMode {
+		case subscription.BodyModeJSON:
+			err = validateJSONTemplate(body)
+		case subscription.BodyModeJSONata:
+			err = validateJsonata(body)
+		default:
+			err = validateTemplate(body)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("body: %w", err))
+		}
+	}
+
+	return errs
+}
+
+// ValidateSubscriptionRecord applies the same validation as the API to a subscription that's defined outside it, e.g.
+// in YAML storage.
+func ValidateSubscriptionRecord(sub datastore.SubscriptionRecord) error {
+	req := addSubscriptionRequest{
+		Name:               sub.Name,
+		Topic:              sub.Topic,
+		Tags:               sub.Tags,
+		Group:              sub.Group,
+		BlueprintID:        sub.BlueprintID,
+		Parameters:         sub.Parameters,
+		Extract:            sub.Extract,
+		Filter:             sub.Filter,
+		PayloadFormat:      sub.PayloadFormat,
+		SkipRetained:       sub.SkipRetained,
+		ErrorPolicy:        sub.ErrorPolicy,
+		StrictPlaceholders: sub.StrictPlaceholders,
+		Method:             sub.Method,
+		URL:                sub.URL,
+		Headers:            sub.Headers,
+		Body:               sub.Body,
+		BodyMode:           sub.BodyMode,
+	}
+
+	if err := newValidator().Validate(req); err != nil {
+		return err
+	}
+
+	return errors.Join(validateSubscriptionExpressions(sub.Filter, sub.Extract, sub.Body, sub.BodyMode)...)
+}
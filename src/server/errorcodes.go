@@ -2,14 +2,36 @@ package server
 
 import (
 	"errors"
+	"mqtt-http-bridge/src/datastore"
 	"mqtt-http-bridge/src/subscription"
 	"net/http"
 )
 
 func mapErrorCode(err error) int {
 	switch {
-	case errors.Is(err, subscription.ErrMissingRequiredParametersForTemplate):
+	case errors.Is(err, subscription.ErrMissingRequiredParametersForTemplate),
+		errors.Is(err, subscription.ErrInvalidGlobalParameterKey),
+		errors.Is(err, subscription.ErrInvalidGlobalParameterValue),
+		errors.Is(err, subscription.ErrSecretsNotConfigured),
+		errors.Is(err, subscription.ErrInvalidBundleSecret),
+		errors.Is(err, subscription.ErrDuplicateBundleID),
+		errors.Is(err, subscription.ErrEmptySelector),
+		errors.Is(err, subscription.ErrInvalidBulkAction),
+		errors.Is(err, subscription.ErrInvalidBlueprint),
+		errors.Is(err, subscription.ErrUnknownBlueprint),
+		errors.Is(err, subscription.ErrInvalidBlueprintParameters):
 		return http.StatusBadRequest
+	case errors.Is(err, datastore.ErrSubscriptionNotFound),
+		errors.Is(err, datastore.ErrBlueprintNotFound),
+		errors.Is(err, subscription.ErrRevisionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, subscription.ErrReadOnlyGlobalParameter),
+		errors.Is(err, datastore.ErrReadOnly),
+		errors.Is(err, subscription.ErrImportConflict),
+		errors.Is(err, subscription.ErrBlueprintInUse):
+		return http.StatusConflict
+	case errors.Is(err, subscription.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
 	}
 
 	return http.StatusInternalServerError
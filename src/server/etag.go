@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	errMissingIfMatch = errors.New("the If-Match header with the ETag of the subscription is required")
+	errInvalidIfMatch = errors.New("the If-Match header doesn't contain an ETag of the subscription")
+)
+
+// setETag sets the ETag header to the version of the subscription.
+func setETag(c echo.Context, version int) {
+	c.Response().Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// ifMatchVersion returns the version of the subscription in the If-Match header, 0 when it matches any version.
+func ifMatchVersion(c echo.Context) (int, error) {
+	value := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+
+	if value == "" {
+		return 0, errMissingIfMatch
+	}
+
+	if value == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(value, "W/"), `"`))
+
+	if err != nil || version < 1 {
+		return 0, errInvalidIfMatch
+	}
+
+	return version, nil
+}
+
+// ifMatchErrorCode maps errors from ifMatchVersion to their status codes.
+func ifMatchErrorCode(err error) int {
+	if errors.Is(err, errMissingIfMatch) {
+		return http.StatusPreconditionRequired
+	}
+
+	return http.StatusPreconditionFailed
+}
@@ -1,31 +1,221 @@
 package server
 
 import (
+	"encoding/base64"
+	"mqtt-http-bridge/src/processor"
 	"mqtt-http-bridge/src/subscription"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	parameterTypeSecret = "secret"
+	maskedSecret        = "********"
 )
 
 type subscriptionResponse struct {
-	ID      string            `json:"id"`
-	Name    string            `json:"name"`
-	Topic   string            `json:"topic"`
+	ID      string   `json:"id,omitempty"`
+	Version int      `json:"version,omitempty"`
+	Name    string   `json:"name"`
+	Topic   string   `json:"topic"`
+	Tags    []string `json:"tags,omitempty"`
+	Group   string   `json:"group,omitempty"`
+	Enabled bool     `json:"enabled"`
+
+	BlueprintID string            `json:"blueprintId,omitempty"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+
 	Extract map[string]string `json:"extract,omitempty"`
 	Filter  string            `json:"filter,omitempty"`
 	Method  string            `json:"method"`
 	URL     string            `json:"url"`
 	Headers map[string]string `json:"headers,omitempty"`
 	Body    string            `json:"body,omitempty"`
+
+	BodyMode string `json:"bodyMode,omitempty"`
+
+	PayloadFormat string `json:"payloadFormat,omitempty"`
+	SkipRetained  bool   `json:"skipRetained"`
+	ErrorPolicy   string `json:"errorPolicy,omitempty"`
+
+	StrictPlaceholders bool `json:"strictPlaceholders"`
 }
 
 func subscriptionToResponse(sub subscription.Subscription) any {
 	return subscriptionResponse{
 		ID:      sub.ID,
+		Version: sub.Version,
 		Name:    sub.Name,
 		Topic:   sub.Topic,
+		Tags:    sub.Tags,
+		Group:   sub.Group,
+		Enabled: !sub.Disabled,
+
+		BlueprintID: sub.BlueprintID,
+		Parameters:  sub.Parameters,
+
 		Extract: sub.Extract,
 		Filter:  sub.Filter,
 		Method:  sub.Method,
 		URL:     sub.URL,
 		Headers: sub.Headers,
 		Body:    sub.Body,
+
+		BodyMode: sub.BodyMode,
+
+		PayloadFormat: sub.PayloadFormat,
+		SkipRetained:  sub.SkipRetained,
+		ErrorPolicy:   sub.ErrorPolicy,
+
+		StrictPlaceholders: sub.StrictPlaceholders,
+	}
+}
+
+type blueprintResponse struct {
+	ID           string                       `json:"id"`
+	Name         string                       `json:"name"`
+	Description  string                       `json:"description,omitempty"`
+	Parameters   []blueprintParameterResponse `json:"parameters"`
+	Subscription any                          `json:"subscription"`
+}
+
+type blueprintParameterResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required"`
+}
+
+func blueprintToResponse(blueprint subscription.Blueprint) any {
+	params := make([]blueprintParameterResponse, 0, len(blueprint.Parameters))
+
+	for _, param := range blueprint.Parameters {
+		params = append(params, blueprintParameterResponse{
+			Name:        param.Name,
+			Description: param.Description,
+			Default:     param.Default,
+			Required:    param.Required,
+		})
+	}
+
+	return blueprintResponse{
+		ID:           blueprint.ID,
+		Name:         blueprint.Name,
+		Description:  blueprint.Description,
+		Parameters:   params,
+		Subscription: subscriptionToResponse(blueprint.Subscription),
+	}
+}
+
+type revisionResponse struct {
+	Revision     int              `json:"revision"`
+	Timestamp    time.Time        `json:"timestamp"`
+	Author       string           `json:"author,omitempty"`
+	Action       string           `json:"action"`
+	Subscription any              `json:"subscription"`
+	Changes      []revisionChange `json:"changes"`
+}
+
+type revisionChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+func revisionToResponse(rev subscription.Revision) any {
+	changes := make([]revisionChange, 0, len(rev.Changes))
+
+	for _, change := range rev.Changes {
+		changes = append(changes, revisionChange{Field: change.Field, Old: change.Old, New: change.New})
+	}
+
+	return revisionResponse{
+		Revision:     rev.Revision,
+		Timestamp:    rev.Timestamp,
+		Author:       rev.Author,
+		Action:       rev.Action,
+		Subscription: subscriptionToResponse(rev.Subscription),
+		Changes:      changes,
+	}
+}
+
+type auditEntryResponse struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Actor      string    `json:"actor,omitempty"`
+	SourceIP   string    `json:"sourceIp,omitempty"`
+	Action     string    `json:"action"`
+	EntityType string    `json:"entityType"`
+	EntityID   string    `json:"entityId,omitempty"`
+	Before     any       `json:"before,omitempty"`
+	After      any       `json:"after,omitempty"`
+}
+
+func auditEntryToResponse(entry subscription.AuditEntry) any {
+	return auditEntryResponse{
+		Timestamp:  entry.Timestamp,
+		Actor:      entry.Actor,
+		SourceIP:   entry.SourceIP,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Before:     entry.Before,
+		After:      entry.After,
+	}
+}
+
+type simulationResponse struct {
+	SubscriptionID   string                    `json:"subscriptionId"`
+	SubscriptionName string                    `json:"subscriptionName"`
+	Delivered        bool                      `json:"delivered"`
+	Reason           string                    `json:"reason,omitempty"`
+	Errors           []simulationErrorResponse `json:"errors"`
+	Request          *simulatedRequestResponse `json:"request,omitempty"`
+}
+
+type simulationErrorResponse struct {
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+type simulatedRequestResponse struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// BodyEncoding is set to base64 when the body is not valid UTF-8
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+}
+
+func simulationToResponse(simulation processor.Simulation) any {
+	errs := make([]simulationErrorResponse, 0, len(simulation.Errors))
+
+	for _, err := range simulation.Errors {
+		errs = append(errs, simulationErrorResponse{Stage: err.Stage, Error: err.Error})
 	}
+
+	response := simulationResponse{
+		SubscriptionID:   simulation.SubscriptionID,
+		SubscriptionName: simulation.SubscriptionName,
+		Delivered:        simulation.Request != nil,
+		Reason:           simulation.Reason,
+		Errors:           errs,
+	}
+
+	if request := simulation.Request; request != nil {
+		body, bodyEncoding := string(request.Body), ""
+
+		if !utf8.Valid(request.Body) {
+			body, bodyEncoding = base64.StdEncoding.EncodeToString(request.Body), "base64"
+		}
+
+		response.Request = &simulatedRequestResponse{
+			Method:       request.Method,
+			URL:          request.URL,
+			Headers:      request.Headers,
+			Body:         body,
+			BodyEncoding: bodyEncoding,
+		}
+	}
+
+	return response
 }
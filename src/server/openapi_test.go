@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log"
+	"mqtt-http-bridge/src/config"
+	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/deadletter"
+	"mqtt-http-bridge/src/processor"
+	"mqtt-http-bridge/src/subscription"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadOpenAPISpec(t *testing.T) *openapi3.T {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+
+	return doc
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	doc := loadOpenAPISpec(t)
+	router, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+
+	store, _ := datastore.Memory()
+	service := subscription.NewService(store, "")
+	alice := subscription.Actor{Name: "alice"}
+
+	blueprint, err := service.AddBlueprint(subscription.Blueprint{
+		Name:       "Printer",
+		Parameters: []subscription.BlueprintParameter{{Name: "room", Required: true}},
+		Subscription: subscription.Subscription{
+			Name:   "Printer {{ .param.room }}",
+			Topic:  "office/{{ .param.room }}/printer",
+			Method: "POST",
+			URL:    "https://printer.example.com/{{ .param.room }}",
+		},
+	}, alice)
+	require.NoError(t, err)
+
+	_, err = service.AddSubscription(subscription.Subscription{BlueprintID: blueprint.ID, Parameters: map[string]string{"room": "lobby"}}, alice)
+	require.NoError(t, err)
+
+	sub, err := service.AddSubscription(subscription.Subscription{
+		Name:    "Kitchen lights",
+		Topic:   "home/kitchen/lights",
+		Tags:    []string{"lights"},
+		Method:  "POST",
+		URL:     "https://lights.example.com/kitchen",
+		Headers: map[string]string{"Content-Type": "application/json"},
+	}, alice)
+	require.NoError(t, err)
+
+	deadLetters := deadletter.New()
+	deadLetters.Add(deadletter.Entry{SubscriptionID: sub.ID, SubscriptionName: sub.Name, Topic: sub.Topic, Stage: "http", Error: "connection refused", Timestamp: time.Now()})
+
+	proc := processor.New(service, nil, make(chan processor.MQTTMessage), deadLetters, log.New(io.Discard, "", 0))
+	handler := New(service, proc, make(chan processor.MQTTMessage), deadLetters, &config.Config{}).(http.Handler)
+
+	// The requests run in order against the same service, later ones rely on the changes of earlier ones.
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		header  map[string]string
+		body    string
+		status  int
+		invalid bool
+	}{
+		{"health", http.MethodGet, "/health", nil, "", http.StatusOK, false},
+		{"openapi", http.MethodGet, "/openapi.json", nil, "", http.StatusOK, false},
+		{"validate valid expression", http.MethodPost, "/validate", nil, `{"type": "jsonata", "subject": "payload.value > 10"}`, http.StatusOK, false},
+		{"validate invalid expression", http.MethodPost, "/validate", nil, `{"type": "jsonata", "subject": "(("}`, http.StatusOK, false},
+		{"validate without fields", http.MethodPost, "/validate", nil, `{}`, http.StatusBadRequest, true},
+		{"simulate message", http.MethodPost, "/simulate", nil, `{"topic": "home/kitchen/lights", "payload": "{\"on\": true}", "userProperties": {"source": "test"}}`, http.StatusOK, false},
+		{"simulate without topic", http.MethodPost, "/simulate", nil, `{"payload": "ON"}`, http.StatusBadRequest, true},
+		{"add subscription", http.MethodPost, "/subscriptions", nil, `{"name": "Hallway lights", "topic": "home/hallway/lights", "tags": ["lights"], "method": "PUT", "url": "https://lights.example.com/hallway", "enabled": false}`, http.StatusCreated, false},
+		{"add invalid subscription", http.MethodPost, "/subscriptions", nil, `{"topic": "home/#", "method": "TRACE"}`, http.StatusBadRequest, true},
+		{"list subscriptions", http.MethodGet, "/subscriptions?tag=lights&enabled=true&limit=10&offset=0", nil, "", http.StatusOK, false},
+		{"list blueprint instances", http.MethodGet, "/subscriptions?blueprintId=" + blueprint.ID, nil, "", http.StatusOK, false},
+		{"get subscription", http.MethodGet, "/subscriptions/" + sub.ID, nil, "", http.StatusOK, false},
+		{"get missing subscription", http.MethodGet, "/subscriptions/missing", nil, "", http.StatusNotFound, false},
+		{"update subscription", http.MethodPut, "/subscriptions/" + sub.ID, map[string]string{"If-Match": `"1"`}, `{"name": "Kitchen lights", "topic": "home/kitchen/lights", "method": "POST", "url": "https://lights.example.com/kitchen", "filter": "payload.on"}`, http.StatusCreated, false},
+		{"update stale subscription", http.MethodPut, "/subscriptions/" + sub.ID, map[string]string{"If-Match": `"1"`}, `{"name": "Kitchen lights", "topic": "home/kitchen/lights", "method": "POST", "url": "https://lights.example.com/kitchen"}`, http.StatusPreconditionFailed, false},
+		{"patch subscription", http.MethodPatch, "/subscriptions/" + sub.ID, map[string]string{"If-Match": "*", "Content-Type": "application/merge-patch+json"}, `{"filter": null, "headers": {"X-Room": "kitchen"}}`, http.StatusOK, false},
+		{"list revisions", http.MethodGet, "/subscriptions/" + sub.ID + "/revisions", nil, "", http.StatusOK, false},
+		{"restore revision", http.MethodPost, "/subscriptions/" + sub.ID + "/revisions/1/restore", nil, "", http.StatusOK, false},
+		{"restore missing revision", http.MethodPost, "/subscriptions/" + sub.ID + "/revisions/99/restore", nil, "", http.StatusNotFound, false},
+		{"bulk disable", http.MethodPost, "/subscriptions/bulk", nil, `{"action": "disable", "selector": {"tags": ["lights"]}}`, http.StatusOK, false},
+		{"bulk without selector", http.MethodPost, "/subscriptions/bulk", nil, `{"action": "enable", "selector": {}}`, http.StatusBadRequest, false},
+		{"list blueprints", http.MethodGet, "/blueprints", nil, "", http.StatusOK, false},
+		{"get blueprint", http.MethodGet, "/blueprints/" + blueprint.ID, nil, "", http.StatusOK, false},
+		{"add blueprint", http.MethodPost, "/blueprints", nil, `{"name": "Sensor", "parameters": [{"name": "sensor", "default": "temperature"}], "subscription": {"name": "Sensor", "topic": "sensors/{{ .param.sensor }}", "method": "POST", "url": "https://sensors.example.com"}}`, http.StatusCreated, false},
+		{"update blueprint", http.MethodPut, "/blueprints/" + blueprint.ID, nil, `{"name": "Printer", "parameters": [{"name": "room", "required": true}], "subscription": {"name": "Printer {{ .param.room }}", "topic": "office/{{ .param.room }}/printer", "method": "PUT", "url": "https://printer.example.com/{{ .param.room }}"}}`, http.StatusOK, false},
+		{"delete blueprint in use", http.MethodDelete, "/blueprints/" + blueprint.ID, nil, "", http.StatusConflict, false},
+		{"set global parameter", http.MethodPost, "/global-parameters", nil, `{"key": "host", "value": "example.com"}`, http.StatusOK, false},
+		{"set secret without secret key", http.MethodPost, "/global-parameters", nil, `{"key": "token", "value": "abc", "type": "secret"}`, http.StatusBadRequest, false},
+		{"list global parameters", http.MethodGet, "/global-parameters", nil, "", http.StatusOK, false},
+		{"delete global parameter", http.MethodDelete, "/global-parameters/host?type=value", nil, "", http.StatusOK, false},
+		{"list dead letters", http.MethodGet, "/dead-letters", nil, "", http.StatusOK, false},
+		{"list audit entries", http.MethodGet, "/audit?entityType=subscription&actor=alice", nil, "", http.StatusOK, false},
+		{"list audit entries with invalid type", http.MethodGet, "/audit?entityType=printer", nil, "", http.StatusBadRequest, true},
+		{"export json", http.MethodGet, "/export?format=json&secrets=false", nil, "", http.StatusOK, false},
+		{"export yaml", http.MethodGet, "/export?format=yaml", nil, "", http.StatusOK, false},
+		{"import dry run", http.MethodPost, "/import?mode=merge&conflict=skip&dryRun=true", map[string]string{"Content-Type": "application/json"}, `{"version": 1, "subscriptions": [{"id": "hallway", "name": "Hallway", "topic": "home/hallway", "method": "GET", "URL": "https://example.com"}]}`, http.StatusOK, false},
+		{"import yaml", http.MethodPost, "/import?conflict=rename", map[string]string{"Content-Type": "application/yaml"}, "version: 1\nsubscriptions:\n  - id: attic\n    name: Attic\n    topic: home/attic\n    method: GET\n    URL: https://example.com\n", http.StatusOK, false},
+		{"delete subscription without If-Match", http.MethodDelete, "/subscriptions/" + sub.ID, nil, "", http.StatusPreconditionRequired, true},
+		{"delete subscription", http.MethodDelete, "/subscriptions/" + sub.ID, map[string]string{"If-Match": "*"}, "", http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1"+tt.path, strings.NewReader(tt.body))
+
+			if tt.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+
+			route, pathParams, err := router.FindRoute(req)
+			require.NoError(t, err)
+
+			requestInput := &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route}
+
+			// Invalid requests make sure the errors are documented, the request itself must not conform.
+			if err := openapi3filter.ValidateRequest(context.Background(), requestInput); tt.invalid {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			req.Body = io.NopCloser(strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 rec.Code,
+				Header:                 rec.Header(),
+				Body:                   io.NopCloser(rec.Body),
+				Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	doc := loadOpenAPISpec(t)
+	e := New(nil, nil, make(chan processor.MQTTMessage), deadletter.New(), &config.Config{}).(*echo.Echo)
+	pathParam := regexp.MustCompile(`:(\w+)`)
+
+	for _, route := range e.Routes() {
+		path, found := strings.CutPrefix(route.Path, "/api/v1")
+
+		// The catch-all only returns 404 for unknown routes.
+		if !found || strings.HasSuffix(path, "*") {
+			continue
+		}
+
+		path = pathParam.ReplaceAllString(path, "{$1}")
+		item := doc.Paths.Value(path)
+
+		if assert.NotNil(t, item, "%s is not documented", path) {
+			assert.NotNil(t, item.GetOperation(route.Method), "%s %s is not documented", route.Method, path)
+		}
+	}
+}
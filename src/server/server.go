@@ -1,10 +1,12 @@
 package server
 
 import (
+	"context"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 	"io"
 	"mqtt-http-bridge/src/config"
+	"mqtt-http-bridge/src/deadletter"
 	"mqtt-http-bridge/src/processor"
 	"mqtt-http-bridge/src/subscription"
 	"net/http"
@@ -12,9 +14,11 @@ import (
 
 type HTTPServer interface {
 	Start(address string) error
+	// Shutdown stops accepting requests and waits for the running ones to finish, or the context to be done
+	Shutdown(ctx context.Context) error
 }
 
-func New(service subscription.Service, mqttMessageChan <-chan processor.MQTTMessage, cfg *config.Config) HTTPServer {
+func New(service subscription.Service, proc processor.Processor, mqttMessageChan <-chan processor.MQTTMessage, deadLetters deadletter.Queue, cfg *config.Config) HTTPServer {
 	server := echo.New()
 	server.Binder = newBinder()
 	server.Validator = newValidator()
@@ -32,18 +36,37 @@ func New(service subscription.Service, mqttMessageChan <-chan processor.MQTTMess
 	api.GET("/health", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]any{"status": "ok"})
 	})
+	api.GET("/openapi.json", openAPI())
 	api.POST("/validate", validate())
+	api.POST("/simulate", simulate(proc))
 
 	api.DELETE("/subscriptions/:id", deleteSubscription(service))
 	api.GET("/subscriptions/:id", getSubscription(service))
 	api.PUT("/subscriptions/:id", updateSubscription(service))
+	api.PATCH("/subscriptions/:id", patchSubscription(service))
 	api.GET("/subscriptions", listSubscriptions(service))
 	api.POST("/subscriptions", addSubscription(service))
+	api.POST("/subscriptions/bulk", bulkSubscriptions(service))
+	api.GET("/subscriptions/:id/revisions", listRevisions(service))
+	api.POST("/subscriptions/:id/revisions/:revision/restore", restoreRevision(service))
+
+	api.DELETE("/blueprints/:id", deleteBlueprint(service))
+	api.GET("/blueprints/:id", getBlueprint(service))
+	api.PUT("/blueprints/:id", updateBlueprint(service))
+	api.GET("/blueprints", listBlueprints(service))
+	api.POST("/blueprints", addBlueprint(service))
 
 	api.DELETE("/global-parameters/:parameter", deleteGlobalParameter(service))
 	api.GET("/global-parameters", listGlobalParameters(service))
 	api.POST("/global-parameters", setGlobalParameter(service))
 
+	api.GET("/dead-letters", listDeadLetters(deadLetters))
+
+	api.GET("/audit", listAuditEntries(service))
+
+	api.GET("/export", export(service))
+	api.POST("/import", importBundle(service))
+
 	mqttSocketServer := newMqttSocketServer(mqttMessageChan)
 	mqttSocketServer.run()
 
@@ -0,0 +1,98 @@
+package subscription
+
+import (
+	"mqtt-http-bridge/src/datastore"
+	"slices"
+	"time"
+)
+
+const (
+	AuditEntitySubscription    = "subscription"
+	AuditEntityBlueprint       = "blueprint"
+	AuditEntityGlobalParameter = "globalParameter"
+	AuditEntitySecret          = "secret"
+	AuditEntityStore           = "store"
+)
+
+// Actor identifies who makes a change, and from where. It's recorded in the audit log and revisions.
+type Actor struct {
+	Name     string
+	SourceIP string
+}
+
+type AuditEntry struct {
+	Timestamp  time.Time
+	Actor      string
+	SourceIP   string
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     any
+	After      any
+}
+
+// AuditFilter narrows down the audit entries, empty fields match everything.
+type AuditFilter struct {
+	EntityType string
+	EntityID   string
+	Actor      string
+	From       time.Time
+	To         time.Time
+}
+
+func (f AuditFilter) matches(entry datastore.AuditRecord) bool {
+	switch {
+	case f.EntityType != "" && f.EntityType != entry.EntityType,
+		f.EntityID != "" && f.EntityID != entry.EntityID,
+		f.Actor != "" && f.Actor != entry.Actor,
+		!f.From.IsZero() && entry.Timestamp.Before(f.From),
+		!f.To.IsZero() && entry.Timestamp.After(f.To):
+		return false
+	}
+
+	return true
+}
+
+func (s *service) GetAuditEntries(filter AuditFilter) ([]AuditEntry, error) {
+	records, err := s.store.GetAuditEntries()
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(records))
+
+	for _, record := range records {
+		if filter.matches(record) {
+			entries = append(entries, auditEntryFromStore(record))
+		}
+	}
+
+	// Most recent first
+	slices.Reverse(entries)
+
+	return entries, nil
+}
+
+// applyAudited stores the changes together with their entry in the audit log, in a single write. Before and after are
+// left empty when not applicable, e.g. for creations.
+func (s *service) applyAudited(changes datastore.Changes, actor Actor, action string, entityType string, entityID string, before any, after any) error {
+	changes.AuditEntries = append(changes.AuditEntries, auditRecord(actor, action, entityType, entityID, before, after))
+
+	return s.store.Apply(changes)
+}
+
+// auditRecord returns the audit entry for a change. Before and after are left empty when not applicable, e.g. for
+// creations.
+func auditRecord(actor Actor, action string, entityType string, entityID string, before any, after any) datastore.AuditRecord {
+	return datastore.AuditRecord{
+		Timestamp:  time.Now().UTC(),
+		Actor:      actor.Name,
+		SourceIP:   actor.SourceIP,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Before:     before,
+		After:      after,
+	}
+}
@@ -0,0 +1,74 @@
+package subscription
+
+import (
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/datastore"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "secret-key")
+	alice := Actor{Name: "alice", SourceIP: "192.0.2.1"}
+	bob := Actor{Name: "bob", SourceIP: "192.0.2.2"}
+
+	sub, err := service.AddSubscription(Subscription{Name: "Kitchen", Topic: "home/kitchen"}, alice)
+	assert.NoError(t, err)
+	assert.NoError(t, service.SetGlobalParameter("room", "kitchen", alice))
+	assert.NoError(t, service.SetGlobalParameter("room", "hallway", bob))
+	assert.NoError(t, service.SetSecret("token", "s3cr3t", bob))
+	assert.NoError(t, service.DeleteSubscription(sub.ID, 0, bob))
+
+	t.Run("Every change is recorded, most recent first", func(t *testing.T) {
+		entries, err := service.GetAuditEntries(AuditFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, entries, 5)
+
+		assert.Equal(t, ActionDelete, entries[0].Action)
+		assert.Equal(t, AuditEntitySubscription, entries[0].EntityType)
+		assert.Equal(t, "bob", entries[0].Actor)
+		assert.Equal(t, "192.0.2.2", entries[0].SourceIP)
+		assert.NotNil(t, entries[0].Before)
+		assert.Nil(t, entries[0].After)
+	})
+
+	t.Run("Entries can be filtered", func(t *testing.T) {
+		entries, _ := service.GetAuditEntries(AuditFilter{EntityType: AuditEntityGlobalParameter, EntityID: "room"})
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "kitchen", entries[0].Before)
+		assert.Equal(t, "hallway", entries[0].After)
+
+		entries, _ = service.GetAuditEntries(AuditFilter{Actor: "alice"})
+		assert.Len(t, entries, 2)
+
+		entries, _ = service.GetAuditEntries(AuditFilter{To: time.Now().Add(-time.Hour)})
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Secret values are never recorded", func(t *testing.T) {
+		entries, _ := service.GetAuditEntries(AuditFilter{EntityType: AuditEntitySecret})
+		assert.Len(t, entries, 1)
+		assert.Equal(t, redactedSecret, entries[0].After)
+	})
+}
+
+func TestFailedChangesAreNotAudited(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(failingStore{store}, "secret-key")
+
+	assert.ErrorIs(t, service.SetGlobalParameter("room", "kitchen", Actor{Name: "alice"}), datastore.ErrFlushFailed)
+	assert.ErrorIs(t, service.SetSecret("token", "s3cr3t", Actor{Name: "alice"}), datastore.ErrFlushFailed)
+
+	_, err := service.AddBlueprint(Blueprint{Name: "Lights", Subscription: Subscription{Topic: "home/lights"}}, Actor{Name: "alice"})
+	assert.ErrorIs(t, err, datastore.ErrFlushFailed)
+
+	params, _ := store.GetGlobalParameters()
+	assert.Empty(t, params)
+
+	secrets, _ := store.GetSecrets()
+	assert.Empty(t, secrets)
+
+	entries, _ := store.GetAuditEntries()
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,349 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/utilities"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrInvalidBlueprint           = errors.New("invalid blueprint")
+	ErrUnknownBlueprint           = errors.New("unknown blueprint")
+	ErrInvalidBlueprintParameters = errors.New("invalid blueprint parameters")
+	ErrBlueprintInUse             = errors.New("blueprint is used by subscriptions")
+)
+
+// Parameter names must be usable in placeholders, e.g. {{ .param.room }}.
+var blueprintParameterNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Blueprint is a reusable subscription with declared parameters. Subscriptions that are an instance of a blueprint only
+// provide a name and values for its parameters, changes to the blueprint apply to all instances.
+type Blueprint struct {
+	ID          string
+	Name        string
+	Description string
+	Parameters  []BlueprintParameter
+	// Subscription is the subscription of every instance, the fields can refer to the parameters as {{ .param.name }}.
+	// Its name is used for instances that don't have a name of their own.
+	Subscription Subscription
+}
+
+type BlueprintParameter struct {
+	Name        string
+	Description string
+	// Default is used when an instance doesn't provide a value, unless the parameter is required
+	Default  string
+	Required bool
+}
+
+func (s *service) AddBlueprint(blueprint Blueprint, actor Actor) (Blueprint, error) {
+	blueprint.ID = utilities.GenerateRandomID()
+
+	if err := blueprint.validate(); err != nil {
+		return Blueprint{}, err
+	}
+
+	record := blueprintToStore(blueprint)
+	changes := datastore.Changes{Blueprints: []datastore.BlueprintRecord{record}}
+
+	if err := s.applyAudited(changes, actor, ActionCreate, AuditEntityBlueprint, record.ID, nil, record); err != nil {
+		return Blueprint{}, err
+	}
+
+	return blueprintFromStore(record), nil
+}
+
+func (s *service) GetBlueprint(id string) (Blueprint, error) {
+	record, err := s.store.GetBlueprint(id)
+
+	if err != nil {
+		return Blueprint{}, err
+	}
+
+	return blueprintFromStore(record), nil
+}
+
+func (s *service) GetBlueprints() ([]Blueprint, error) {
+	records, err := s.store.GetBlueprints()
+
+	if err != nil {
+		return nil, err
+	}
+
+	blueprints := make([]Blueprint, 0, len(records))
+
+	for _, record := range records {
+		blueprints = append(blueprints, blueprintFromStore(record))
+	}
+
+	slices.SortStableFunc(blueprints, func(a, b Blueprint) int {
+		if name := strings.Compare(a.Name, b.Name); name != 0 {
+			return name
+		}
+
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return blueprints, nil
+}
+
+func (s *service) UpdateBlueprint(blueprint Blueprint, actor Actor) (Blueprint, error) {
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+
+	before, err := s.store.GetBlueprint(blueprint.ID)
+
+	if err != nil {
+		return Blueprint{}, err
+	}
+
+	if err := blueprint.validate(); err != nil {
+		return Blueprint{}, err
+	}
+
+	// The instances must still provide all required parameters, and no parameters that are no longer declared.
+	instances, err := s.instancesOf(blueprint.ID)
+
+	if err != nil {
+		return Blueprint{}, err
+	}
+
+	for _, instance := range instances {
+		if err := blueprint.validateParameters(instance.Parameters); err != nil {
+			return Blueprint{}, fmt.Errorf("%w for subscription %s", err, instance.ID)
+		}
+	}
+
+	record := blueprintToStore(blueprint)
+	changes := datastore.Changes{Blueprints: []datastore.BlueprintRecord{record}}
+
+	s.revisionsMu.Lock()
+	defer s.revisionsMu.Unlock()
+
+	// The instances change along with the blueprint, so they get a new version and revision in the same write.
+	previous, updated := blueprintFromStore(before), blueprintFromStore(record)
+
+	for _, instance := range instances {
+		after := withVersion(instance, nextVersion(instance))
+
+		if err := s.addSubscriptionChange(&changes, ActionUpdate, instance, after, actor.Name); err != nil {
+			return Blueprint{}, err
+		}
+
+		// The stored instance only differs in its version, the revision lists the changes of the expanded subscription.
+		changes.Revisions[len(changes.Revisions)-1].Changes = diffSubscriptions(previous.instantiate(subscriptionFromStore(instance)), updated.instantiate(subscriptionFromStore(after)))
+	}
+
+	if err := s.applyAudited(changes, actor, ActionUpdate, AuditEntityBlueprint, record.ID, before, record); err != nil {
+		return Blueprint{}, err
+	}
+
+	return updated, nil
+}
+
+func (s *service) DeleteBlueprint(id string, actor Actor) error {
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+
+	before, err := s.store.GetBlueprint(id)
+
+	if err != nil {
+		return err
+	}
+
+	instances, err := s.instancesOf(id)
+
+	if err != nil {
+		return err
+	}
+
+	if len(instances) > 0 {
+		return fmt.Errorf("%w: %d instances", ErrBlueprintInUse, len(instances))
+	}
+
+	changes := datastore.Changes{DeletedBlueprints: []string{id}}
+
+	return s.applyAudited(changes, actor, ActionDelete, AuditEntityBlueprint, id, before, nil)
+}
+
+func (s *service) instancesOf(blueprintID string) ([]datastore.SubscriptionRecord, error) {
+	subs, err := s.store.GetSubscriptions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(subs, func(sub datastore.SubscriptionRecord) bool { return sub.BlueprintID != blueprintID }), nil
+}
+
+// toInstanceRecord validates the parameters of a blueprint instance, and leaves out the fields that are taken from the
+// blueprint. Subscriptions that aren't an instance are returned as is.
+func (s *service) toInstanceRecord(sub Subscription) (datastore.SubscriptionRecord, error) {
+	if sub.BlueprintID == "" {
+		return subscriptionToStore(sub), nil
+	}
+
+	record, err := s.store.GetBlueprint(sub.BlueprintID)
+
+	if errors.Is(err, datastore.ErrBlueprintNotFound) {
+		return datastore.SubscriptionRecord{}, fmt.Errorf("%w: %s", ErrUnknownBlueprint, sub.BlueprintID)
+	}
+
+	if err != nil {
+		return datastore.SubscriptionRecord{}, err
+	}
+
+	if err := blueprintFromStore(record).validateParameters(sub.Parameters); err != nil {
+		return datastore.SubscriptionRecord{}, err
+	}
+
+	return datastore.SubscriptionRecord{
+		ID:          sub.ID,
+		Version:     sub.Version,
+		Name:        sub.Name,
+		Tags:        sub.Tags,
+		Group:       sub.Group,
+		Disabled:    sub.Disabled,
+		BlueprintID: sub.BlueprintID,
+		Parameters:  sub.Parameters,
+	}, nil
+}
+
+// expand fills in the fields of blueprint instances from their blueprints. The topic and name are rendered with the
+// parameters, the other fields are rendered along with the message, where the parameters are available as .param.
+// Instances of which the blueprint can't be found are returned as is, so they don't match any topic.
+func (s *service) expand(records []datastore.SubscriptionRecord) ([]Subscription, error) {
+	var blueprints map[string]Blueprint
+
+	subscriptions := make([]Subscription, 0, len(records))
+
+	for _, record := range records {
+		sub := subscriptionFromStore(record)
+
+		if sub.BlueprintID == "" {
+			subscriptions = append(subscriptions, sub)
+			continue
+		}
+
+		if blueprints == nil {
+			all, err := s.GetBlueprints()
+
+			if err != nil {
+				return nil, err
+			}
+
+			blueprints = make(map[string]Blueprint, len(all))
+
+			for _, blueprint := range all {
+				blueprints[blueprint.ID] = blueprint
+			}
+		}
+
+		if blueprint, ok := blueprints[sub.BlueprintID]; ok {
+			sub = blueprint.instantiate(sub)
+		}
+
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return subscriptions, nil
+}
+
+// instantiate returns the subscription of the blueprint, with the identity and organisation of the instance.
+func (b Blueprint) instantiate(instance Subscription) Subscription {
+	sub := b.Subscription
+
+	sub.ID = instance.ID
+	sub.Version = instance.Version
+	sub.Tags = instance.Tags
+	sub.Group = instance.Group
+	sub.Disabled = instance.Disabled
+	sub.BlueprintID = instance.BlueprintID
+	sub.Parameters = instance.Parameters
+	sub.ResolvedParameters = b.resolveParameters(instance.Parameters)
+
+	// The maps are shared with the blueprint otherwise.
+	sub.Extract = maps.Clone(sub.Extract)
+	sub.Headers = maps.Clone(sub.Headers)
+
+	data := map[string]any{"param": sub.ResolvedParameters}
+
+	if topic, err := utilities.RenderInlineTemplate(sub.Topic, data); err == nil {
+		sub.Topic = topic
+	}
+
+	sub.Name = instance.Name
+
+	if sub.Name == "" {
+		if name, err := utilities.RenderInlineTemplate(b.Subscription.Name, data); err == nil {
+			sub.Name = name
+		}
+	}
+
+	return sub
+}
+
+// resolveParameters returns the values of all declared parameters, using the defaults for those that aren't given.
+func (b Blueprint) resolveParameters(values map[string]string) map[string]string {
+	resolved := make(map[string]string, len(b.Parameters))
+
+	for _, param := range b.Parameters {
+		if value, ok := values[param.Name]; ok {
+			resolved[param.Name] = value
+		} else {
+			resolved[param.Name] = param.Default
+		}
+	}
+
+	return resolved
+}
+
+func (b Blueprint) validate() error {
+	if b.Subscription.BlueprintID != "" {
+		return fmt.Errorf("%w: the subscription of a blueprint can't refer to another blueprint", ErrInvalidBlueprint)
+	}
+
+	seen := make(map[string]bool, len(b.Parameters))
+
+	for _, param := range b.Parameters {
+		if !blueprintParameterNameRegex.MatchString(param.Name) {
+			return fmt.Errorf("%w: invalid parameter name %q", ErrInvalidBlueprint, param.Name)
+		}
+
+		if seen[param.Name] {
+			return fmt.Errorf("%w: parameter %s is declared more than once", ErrInvalidBlueprint, param.Name)
+		}
+
+		seen[param.Name] = true
+	}
+
+	return nil
+}
+
+// validateParameters checks that the values of an instance provide all required parameters, and nothing else.
+func (b Blueprint) validateParameters(values map[string]string) error {
+	var problems []string
+
+	for _, param := range b.Parameters {
+		if _, ok := values[param.Name]; param.Required && !ok {
+			problems = append(problems, fmt.Sprintf("%s is required", param.Name))
+		}
+	}
+
+	for _, name := range sortedKeys(values) {
+		if !slices.ContainsFunc(b.Parameters, func(p BlueprintParameter) bool { return p.Name == name }) {
+			problems = append(problems, fmt.Sprintf("%s is not declared", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidBlueprintParameters, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package subscription
+
+import (
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/datastore"
+	"testing"
+)
+
+func TestBlueprints(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "")
+	alice := Actor{Name: "alice"}
+
+	blueprint, err := service.AddBlueprint(Blueprint{
+		Name: "Shortcut",
+		Parameters: []BlueprintParameter{
+			{Name: "room", Required: true},
+			{Name: "button", Default: "1"},
+		},
+		Subscription: Subscription{
+			Name:   "Shortcut {{ .param.room }}",
+			Topic:  "shortcuts/{{ .param.room }}/{{ .param.button }}",
+			Method: "POST",
+			URL:    "https://example.com/{{ .param.room }}",
+		},
+	}, alice)
+
+	assert.NoError(t, err)
+
+	t.Run("Invalid parameters are rejected", func(t *testing.T) {
+		_, err := service.AddBlueprint(Blueprint{Name: "Invalid", Parameters: []BlueprintParameter{{Name: "room"}, {Name: "room"}}}, alice)
+		assert.ErrorIs(t, err, ErrInvalidBlueprint)
+
+		_, err = service.AddBlueprint(Blueprint{Name: "Invalid", Parameters: []BlueprintParameter{{Name: "the room"}}}, alice)
+		assert.ErrorIs(t, err, ErrInvalidBlueprint)
+	})
+
+	t.Run("Instances must provide the required parameters only", func(t *testing.T) {
+		_, err := service.AddSubscription(Subscription{BlueprintID: blueprint.ID}, alice)
+		assert.ErrorIs(t, err, ErrInvalidBlueprintParameters)
+		assert.ErrorContains(t, err, "room is required")
+
+		_, err = service.AddSubscription(Subscription{BlueprintID: blueprint.ID, Parameters: map[string]string{"room": "kitchen", "floor": "1"}}, alice)
+		assert.ErrorIs(t, err, ErrInvalidBlueprintParameters)
+		assert.ErrorContains(t, err, "floor is not declared")
+
+		_, err = service.AddSubscription(Subscription{BlueprintID: "unknown"}, alice)
+		assert.ErrorIs(t, err, ErrUnknownBlueprint)
+	})
+
+	kitchen, err := service.AddSubscription(Subscription{BlueprintID: blueprint.ID, Parameters: map[string]string{"room": "kitchen"}}, alice)
+	assert.NoError(t, err)
+
+	hallway, err := service.AddSubscription(Subscription{
+		Name:        "Hallway",
+		BlueprintID: blueprint.ID,
+		Parameters:  map[string]string{"room": "hallway", "button": "2"},
+		// Fields that come from the blueprint are ignored
+		Topic: "ignored",
+	}, alice)
+	assert.NoError(t, err)
+
+	t.Run("Instances are expanded from the blueprint", func(t *testing.T) {
+		assert.Equal(t, "Shortcut kitchen", kitchen.Name)
+		assert.Equal(t, "shortcuts/kitchen/1", kitchen.Topic)
+		assert.Equal(t, "https://example.com/{{ .param.room }}", kitchen.URL)
+		assert.Equal(t, map[string]string{"room": "kitchen", "button": "1"}, kitchen.ResolvedParameters)
+
+		assert.Equal(t, "Hallway", hallway.Name)
+		assert.Equal(t, "shortcuts/hallway/2", hallway.Topic)
+
+		record, _ := store.GetSubscription(hallway.ID)
+		assert.Empty(t, record.Topic)
+	})
+
+	t.Run("Instances are matched by their expanded topic", func(t *testing.T) {
+		subs, err := service.GetSubscriptionsForTopic("shortcuts/hallway/2")
+
+		assert.NoError(t, err)
+		assert.Len(t, subs, 1)
+		assert.Equal(t, hallway.ID, subs[0].ID)
+	})
+
+	t.Run("Changes to the blueprint apply to all instances", func(t *testing.T) {
+		blueprint.Subscription.Method = "PUT"
+		_, err := service.UpdateBlueprint(blueprint, alice)
+		assert.NoError(t, err)
+
+		subs, _ := service.GetSubscriptions()
+
+		for _, sub := range subs {
+			assert.Equal(t, "PUT", sub.Method)
+		}
+	})
+
+	t.Run("Changes to the blueprint are versioned in the instances", func(t *testing.T) {
+		current, err := service.GetSubscription(kitchen.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, kitchen.Version+1, current.Version)
+
+		_, err = service.UpdateSubscription(kitchen, alice)
+		assert.ErrorIs(t, err, ErrVersionMismatch, "Updates based on the instance before the blueprint changed are rejected")
+
+		revisions, err := service.GetRevisions(kitchen.ID)
+		assert.NoError(t, err)
+
+		if assert.Len(t, revisions, 2) {
+			assert.Equal(t, 2, revisions[0].Revision)
+			assert.Equal(t, ActionUpdate, revisions[0].Action)
+			assert.Equal(t, "alice", revisions[0].Author)
+			assert.Equal(t, current.Version, revisions[0].Subscription.Version)
+			assert.Equal(t, []RevisionChange{{Field: "method", Old: "POST", New: "PUT"}}, revisions[0].Changes)
+		}
+	})
+
+	t.Run("Blueprint changes and instance revisions are written together", func(t *testing.T) {
+		failing := NewService(failingStore{store}, "")
+
+		_, err := failing.UpdateBlueprint(blueprint, alice)
+		assert.ErrorIs(t, err, datastore.ErrFlushFailed)
+
+		current, _ := service.GetSubscription(hallway.ID)
+		revisions, _ := service.GetRevisions(hallway.ID)
+
+		assert.Equal(t, hallway.Version+1, current.Version)
+		assert.Len(t, revisions, 2)
+	})
+
+	t.Run("Blueprint changes that invalidate instances are rejected", func(t *testing.T) {
+		changed := blueprint
+		changed.Parameters = []BlueprintParameter{{Name: "room", Required: true}}
+
+		_, err := service.UpdateBlueprint(changed, alice)
+
+		assert.ErrorIs(t, err, ErrInvalidBlueprintParameters)
+		assert.ErrorContains(t, err, hallway.ID)
+	})
+
+	t.Run("Blueprints with instances can't be deleted", func(t *testing.T) {
+		assert.ErrorIs(t, service.DeleteBlueprint(blueprint.ID, alice), ErrBlueprintInUse)
+
+		assert.NoError(t, service.DeleteSubscription(kitchen.ID, 0, alice))
+		assert.NoError(t, service.DeleteSubscription(hallway.ID, 0, alice))
+		assert.NoError(t, service.DeleteBlueprint(blueprint.ID, alice))
+	})
+}
@@ -0,0 +1,465 @@
+package subscription
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"maps"
+	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/utilities"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// BundleVersion is the version of the bundle format, bundles with a newer version are rejected.
+const BundleVersion = 1
+
+const (
+	BundleFormatJSON = "json"
+	BundleFormatYAML = "yaml"
+)
+
+const (
+	ImportModeMerge   = "merge"
+	ImportModeReplace = "replace"
+)
+
+const (
+	ImportConflictOverwrite = "overwrite"
+	ImportConflictSkip      = "skip"
+	ImportConflictFail      = "fail"
+	ImportConflictRename    = "rename"
+)
+
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionDelete    = "delete"
+	ImportActionSkip      = "skip"
+	ImportActionUnchanged = "unchanged"
+)
+
+var (
+	ErrUnsupportedBundleVersion = errors.New("unsupported bundle version")
+	ErrImportConflict           = errors.New("subscription already exists")
+	ErrInvalidBundleSecret      = errors.New("secret can't be decrypted with the configured secrets key")
+	ErrDuplicateBundleID        = errors.New("duplicate subscription id in bundle")
+)
+
+// Bundle contains everything in the store, to move it to another store or host. Secrets are exported encrypted, so
+// they can only be imported with the same secrets key.
+type Bundle struct {
+	Version          int                            `json:"version"`
+	GlobalParameters map[string]any                 `json:"globalParameters"`
+	Secrets          map[string]string              `json:"secrets,omitempty"`
+	Subscriptions    []datastore.SubscriptionRecord `json:"subscriptions"`
+	Blueprints       []datastore.BlueprintRecord    `json:"blueprints,omitempty"`
+}
+
+type ImportOptions struct {
+	// Mode is either merge (default), or replace, which also removes everything that's not in the bundle
+	Mode string
+	// Conflict determines what happens with subscriptions that already exist when merging, defaults to overwrite
+	Conflict string
+	// DryRun only reports the changes, without applying them
+	DryRun bool
+	// Actor is recorded in the audit log and the revisions of the imported subscriptions
+	Actor Actor
+}
+
+type ImportChange struct {
+	// Kind is either blueprint, subscription, globalParameter or secret
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	// NewKey is the ID assigned to a renamed subscription
+	NewKey string `json:"newKey,omitempty"`
+}
+
+// ParseBundle decodes a bundle in the given format, rejecting unknown fields.
+func ParseBundle(data []byte, format string) (Bundle, error) {
+	if format == BundleFormatYAML {
+		var document any
+
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return Bundle{}, err
+		}
+
+		var err error
+
+		if data, err = json.Marshal(document); err != nil {
+			return Bundle{}, err
+		}
+	}
+
+	var bundle Bundle
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&bundle); err != nil {
+		return Bundle{}, err
+	}
+
+	if bundle.Version < 1 || bundle.Version > BundleVersion {
+		return Bundle{}, fmt.Errorf("%w: %d", ErrUnsupportedBundleVersion, bundle.Version)
+	}
+
+	return bundle, nil
+}
+
+// MarshalBundle encodes the bundle in the given format, YAML uses the same field names as JSON.
+func MarshalBundle(bundle Bundle, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(bundle, "", "  ")
+
+	if err != nil || format != BundleFormatYAML {
+		return data, err
+	}
+
+	var document any
+
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(document)
+}
+
+func (s *service) Export(includeSecrets bool) (Bundle, error) {
+	bundle := Bundle{Version: BundleVersion}
+
+	subs, err := s.store.GetSubscriptions()
+
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	slices.SortFunc(subs, func(a, b datastore.SubscriptionRecord) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	bundle.Subscriptions = subs
+
+	if bundle.Blueprints, err = s.store.GetBlueprints(); err != nil {
+		return Bundle{}, err
+	}
+
+	slices.SortFunc(bundle.Blueprints, func(a, b datastore.BlueprintRecord) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	// Parameters defined in the config are left out, they belong to the host rather than the store.
+	if bundle.GlobalParameters, err = s.store.GetGlobalParameters(); err != nil {
+		return Bundle{}, err
+	}
+
+	if includeSecrets {
+		if bundle.Secrets, err = s.store.GetSecrets(); err != nil {
+			return Bundle{}, err
+		}
+	}
+
+	return bundle, nil
+}
+
+func (s *service) Import(bundle Bundle, opts ImportOptions) ([]ImportChange, error) {
+	if opts.Mode == "" {
+		opts.Mode = ImportModeMerge
+	}
+
+	if opts.Conflict == "" || opts.Mode == ImportModeReplace {
+		opts.Conflict = ImportConflictOverwrite
+	}
+
+	for key, value := range bundle.Secrets {
+		if _, err := utilities.Decrypt(s.secretsKey, value); s.secretsKey == "" || err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidBundleSecret, key)
+		}
+	}
+
+	for key, value := range bundle.GlobalParameters {
+		if !globalParameterKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidGlobalParameterKey, key)
+		}
+
+		if err := validateGlobalParameterValue(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	// Held while planning, so no other changes are made through the service before the plan is applied.
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+	s.revisionsMu.Lock()
+	defer s.revisionsMu.Unlock()
+
+	changes, apply, err := s.planImport(bundle, opts)
+
+	if err != nil || opts.DryRun {
+		return changes, err
+	}
+
+	// The whole import is a single write, so it's never partially applied.
+	return changes, s.applyAudited(apply, opts.Actor, ActionImport, AuditEntityStore, "", nil, changes)
+}
+
+// planImport determines the changes needed to import the bundle, and the store changes that apply them including the
+// revisions of the subscriptions. It must be called while holding subscriptionsMu and revisionsMu.
+func (s *service) planImport(bundle Bundle, opts ImportOptions) ([]ImportChange, datastore.Changes, error) {
+	changes := make([]ImportChange, 0)
+	apply := datastore.Changes{
+		GlobalParameters: make(map[string]any),
+		Secrets:          make(map[string]string),
+	}
+
+	// Blueprints go first, as the imported subscriptions can be instances of them.
+	existingBlueprints, err := s.store.GetBlueprints()
+
+	if err != nil {
+		return nil, datastore.Changes{}, err
+	}
+
+	blueprints := make(map[string]datastore.BlueprintRecord, len(existingBlueprints))
+
+	for _, blueprint := range existingBlueprints {
+		blueprints[blueprint.ID] = blueprint
+	}
+
+	importedBlueprints := make(map[string]bool, len(bundle.Blueprints))
+
+	for _, blueprint := range bundle.Blueprints {
+		if err := blueprintFromStore(blueprint).validate(); err != nil || blueprint.ID == "" || importedBlueprints[blueprint.ID] {
+			return nil, datastore.Changes{}, fmt.Errorf("%w: %s", ErrInvalidBlueprint, blueprint.ID)
+		}
+
+		importedBlueprints[blueprint.ID] = true
+		change := ImportChange{Kind: "blueprint", Key: blueprint.ID}
+		current, exists := blueprints[blueprint.ID]
+
+		switch {
+		case !exists:
+			change.Action = ImportActionCreate
+			apply.Blueprints = append(apply.Blueprints, blueprint)
+		case reflect.DeepEqual(current, blueprint):
+			change.Action = ImportActionUnchanged
+		default:
+			change.Action = ImportActionUpdate
+			apply.Blueprints = append(apply.Blueprints, blueprint)
+		}
+
+		changes = append(changes, change)
+	}
+
+	existingSubs, err := s.store.GetSubscriptions()
+
+	if err != nil {
+		return nil, datastore.Changes{}, err
+	}
+
+	existing := make(map[string]datastore.SubscriptionRecord, len(existingSubs))
+
+	for _, sub := range existingSubs {
+		existing[sub.ID] = sub
+	}
+
+	imported := make(map[string]bool, len(bundle.Subscriptions))
+
+	for _, sub := range bundle.Subscriptions {
+		change := ImportChange{Kind: "subscription", Key: sub.ID}
+
+		current, exists := existing[sub.ID]
+
+		if sub.ID != "" && imported[sub.ID] {
+			return nil, datastore.Changes{}, fmt.Errorf("%w: %s", ErrDuplicateBundleID, sub.ID)
+		}
+
+		switch {
+		case sub.ID == "" || (exists && opts.Conflict == ImportConflictRename):
+			sub.ID = uuid.New().String()
+			change.Action = ImportActionCreate
+			change.NewKey = sub.ID
+		case !exists:
+			change.Action = ImportActionCreate
+		case opts.Conflict == ImportConflictFail:
+			return nil, datastore.Changes{}, fmt.Errorf("%w: %s", ErrImportConflict, sub.ID)
+		case opts.Conflict == ImportConflictSkip:
+			change.Action = ImportActionSkip
+		case reflect.DeepEqual(current, withVersion(sub, current.Version)):
+			change.Action = ImportActionUnchanged
+		default:
+			change.Action = ImportActionUpdate
+		}
+
+		imported[change.Key] = true
+		imported[sub.ID] = true
+		changes = append(changes, change)
+
+		var err error
+
+		// Versions in the bundle belong to the store it was exported from.
+		switch change.Action {
+		case ImportActionCreate:
+			err = s.addSubscriptionChange(&apply, ActionImport, datastore.SubscriptionRecord{}, withVersion(sub, 1), opts.Actor.Name)
+		case ImportActionUpdate:
+			err = s.addSubscriptionChange(&apply, ActionImport, current, withVersion(sub, nextVersion(current)), opts.Actor.Name)
+		}
+
+		if err != nil {
+			return nil, datastore.Changes{}, err
+		}
+	}
+
+	existingParams, err := s.store.GetGlobalParameters()
+
+	if err != nil {
+		return nil, datastore.Changes{}, err
+	}
+
+	for _, key := range sortedKeys(bundle.GlobalParameters) {
+		value := bundle.GlobalParameters[key]
+		current, exists := existingParams[key]
+		change := ImportChange{Kind: "globalParameter", Key: key}
+
+		switch {
+		case s.isConfiguredGlobalParameter(key):
+			change.Action = ImportActionSkip
+		case !exists:
+			change.Action = ImportActionCreate
+		case reflect.DeepEqual(current, value):
+			change.Action = ImportActionUnchanged
+		default:
+			change.Action = ImportActionUpdate
+		}
+
+		changes = append(changes, change)
+
+		if change.Action == ImportActionCreate || change.Action == ImportActionUpdate {
+			apply.GlobalParameters[key] = value
+		}
+	}
+
+	existingSecrets, err := s.store.GetSecrets()
+
+	if err != nil {
+		return nil, datastore.Changes{}, err
+	}
+
+	for _, key := range sortedKeys(bundle.Secrets) {
+		value := bundle.Secrets[key]
+		change := ImportChange{Kind: "secret", Key: key, Action: ImportActionUpdate}
+
+		// Encrypted values differ every time, so the decrypted values are compared.
+		if current, exists := existingSecrets[key]; !exists {
+			change.Action = ImportActionCreate
+		} else if s.decryptsEqual(current, value) {
+			change.Action = ImportActionUnchanged
+		}
+
+		changes = append(changes, change)
+
+		if change.Action != ImportActionUnchanged {
+			apply.Secrets[key] = value
+		}
+	}
+
+	if opts.Mode != ImportModeReplace {
+		return changes, apply, checkBlueprintReferences(existing, blueprints, apply)
+	}
+
+	for _, id := range sortedKeys(existing) {
+		if !imported[id] {
+			changes = append(changes, ImportChange{Kind: "subscription", Key: id, Action: ImportActionDelete})
+
+			if err := s.addSubscriptionChange(&apply, ActionDelete, existing[id], datastore.SubscriptionRecord{}, opts.Actor.Name); err != nil {
+				return nil, datastore.Changes{}, err
+			}
+		}
+	}
+
+	for _, id := range sortedKeys(blueprints) {
+		if !importedBlueprints[id] {
+			changes = append(changes, ImportChange{Kind: "blueprint", Key: id, Action: ImportActionDelete})
+			apply.DeletedBlueprints = append(apply.DeletedBlueprints, id)
+		}
+	}
+
+	for _, key := range sortedKeys(existingParams) {
+		if _, ok := bundle.GlobalParameters[key]; !ok {
+			changes = append(changes, ImportChange{Kind: "globalParameter", Key: key, Action: ImportActionDelete})
+			apply.DeletedGlobalParameters = append(apply.DeletedGlobalParameters, key)
+		}
+	}
+
+	// A bundle exported without secrets leaves the existing secrets alone.
+	if bundle.Secrets != nil {
+		for _, key := range sortedKeys(existingSecrets) {
+			if _, ok := bundle.Secrets[key]; !ok {
+				changes = append(changes, ImportChange{Kind: "secret", Key: key, Action: ImportActionDelete})
+				apply.DeletedSecrets = append(apply.DeletedSecrets, key)
+			}
+		}
+	}
+
+	return changes, apply, checkBlueprintReferences(existing, blueprints, apply)
+}
+
+// checkBlueprintReferences ensures the imported subscriptions are instances of blueprints that exist after the import,
+// and that no remaining subscription is an instance of a deleted blueprint.
+func checkBlueprintReferences(subs map[string]datastore.SubscriptionRecord, blueprints map[string]datastore.BlueprintRecord, apply datastore.Changes) error {
+	available := make(map[string]bool, len(blueprints)+len(apply.Blueprints))
+
+	for id := range blueprints {
+		available[id] = !slices.Contains(apply.DeletedBlueprints, id)
+	}
+
+	for _, blueprint := range apply.Blueprints {
+		available[blueprint.ID] = true
+	}
+
+	after := maps.Clone(subs)
+	imported := make(map[string]bool, len(apply.Subscriptions))
+
+	for _, id := range apply.DeletedSubscriptions {
+		delete(after, id)
+	}
+
+	for _, sub := range apply.Subscriptions {
+		after[sub.ID] = sub
+		imported[sub.ID] = true
+	}
+
+	for _, id := range sortedKeys(after) {
+		sub := after[id]
+
+		switch {
+		case sub.BlueprintID == "" || available[sub.BlueprintID]:
+		case slices.Contains(apply.DeletedBlueprints, sub.BlueprintID):
+			return fmt.Errorf("%w: %s is used by subscription %s", ErrBlueprintInUse, sub.BlueprintID, id)
+		case imported[id]:
+			return fmt.Errorf("%w: %s for subscription %s", ErrUnknownBlueprint, sub.BlueprintID, id)
+		}
+	}
+
+	return nil
+}
+
+func withVersion(sub datastore.SubscriptionRecord, version int) datastore.SubscriptionRecord {
+	sub.Version = version
+
+	return sub
+}
+
+func (s *service) decryptsEqual(a string, b string) bool {
+	decryptedA, errA := utilities.Decrypt(s.secretsKey, a)
+	decryptedB, errB := utilities.Decrypt(s.secretsKey, b)
+
+	return errA == nil && errB == nil && decryptedA == decryptedB
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
@@ -0,0 +1,243 @@
+package subscription
+
+import (
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/datastore"
+	"testing"
+)
+
+func newBundleTestService(t *testing.T) Service {
+	store, _ := datastore.Memory()
+	service := NewService(store, "secret-key")
+
+	_, err := store.AddSubscription(datastore.SubscriptionRecord{ID: "1", Name: "Kitchen", Topic: "home/kitchen"})
+	assert.NoError(t, err)
+	_, err = store.AddSubscription(datastore.SubscriptionRecord{ID: "2", Name: "Hallway", Topic: "home/hallway"})
+	assert.NoError(t, err)
+	assert.NoError(t, service.SetGlobalParameter("room", "kitchen", Actor{}))
+	assert.NoError(t, service.SetSecret("token", "abc", Actor{}))
+
+	return service
+}
+
+func TestExportImport(t *testing.T) {
+	source := newBundleTestService(t)
+
+	bundle, err := source.Export(true)
+	assert.NoError(t, err)
+
+	data, err := MarshalBundle(bundle, BundleFormatYAML)
+	assert.NoError(t, err)
+
+	parsed, err := ParseBundle(data, BundleFormatYAML)
+	assert.NoError(t, err)
+	assert.Equal(t, bundle, parsed)
+
+	t.Run("Importing into an empty store creates everything", func(t *testing.T) {
+		store, _ := datastore.Memory()
+		target := NewService(store, "secret-key")
+
+		changes, err := target.Import(parsed, ImportOptions{})
+		assert.NoError(t, err)
+		assert.Len(t, changes, 4)
+
+		secrets, _ := target.GetSecrets()
+		assert.Equal(t, map[string]any{"token": "abc"}, secrets)
+
+		revisions, _ := target.GetRevisions("1")
+		assert.Len(t, revisions, 1)
+		assert.Equal(t, ActionImport, revisions[0].Action)
+
+		entries, _ := target.GetAuditEntries(AuditFilter{EntityType: AuditEntityStore})
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("Failed imports leave the store unchanged", func(t *testing.T) {
+		store, _ := datastore.Memory()
+		target := NewService(failingStore{store}, "secret-key")
+
+		_, err := target.Import(parsed, ImportOptions{})
+		assert.ErrorIs(t, err, datastore.ErrFlushFailed)
+
+		subs, _ := store.GetSubscriptions()
+		assert.Empty(t, subs)
+
+		params, _ := store.GetGlobalParameters()
+		assert.Empty(t, params)
+
+		secrets, _ := store.GetSecrets()
+		assert.Empty(t, secrets)
+	})
+
+	t.Run("Importing the same bundle changes nothing", func(t *testing.T) {
+		changes, err := source.Import(parsed, ImportOptions{})
+		assert.NoError(t, err)
+
+		for _, change := range changes {
+			assert.Equal(t, ImportActionUnchanged, change.Action, change.Key)
+		}
+	})
+
+	t.Run("Secrets encrypted with another key are rejected", func(t *testing.T) {
+		store, _ := datastore.Memory()
+
+		_, err := NewService(store, "other-key").Import(parsed, ImportOptions{})
+		assert.ErrorIs(t, err, ErrInvalidBundleSecret)
+	})
+
+	t.Run("Unsupported versions are rejected", func(t *testing.T) {
+		_, err := ParseBundle([]byte(`{"version":2}`), BundleFormatJSON)
+		assert.ErrorIs(t, err, ErrUnsupportedBundleVersion)
+	})
+}
+
+func TestImportModes(t *testing.T) {
+	bundle := Bundle{
+		Version:          BundleVersion,
+		GlobalParameters: map[string]any{"room": "hallway"},
+		Subscriptions: []datastore.SubscriptionRecord{
+			{ID: "1", Name: "Kitchen (renamed)", Topic: "home/kitchen"},
+			{ID: "3", Name: "Garden", Topic: "home/garden"},
+		},
+	}
+
+	t.Run("Merge overwrites conflicts by default", func(t *testing.T) {
+		service := newBundleTestService(t)
+
+		changes, err := service.Import(bundle, ImportOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []ImportChange{
+			{Kind: "subscription", Key: "1", Action: ImportActionUpdate},
+			{Kind: "subscription", Key: "3", Action: ImportActionCreate},
+			{Kind: "globalParameter", Key: "room", Action: ImportActionUpdate},
+		}, changes)
+
+		subs, _ := service.GetSubscriptions()
+		assert.Len(t, subs, 3)
+	})
+
+	t.Run("Dry run reports without applying", func(t *testing.T) {
+		service := newBundleTestService(t)
+
+		changes, err := service.Import(bundle, ImportOptions{Mode: ImportModeReplace, DryRun: true})
+		assert.NoError(t, err)
+		assert.Contains(t, changes, ImportChange{Kind: "subscription", Key: "2", Action: ImportActionDelete})
+		assert.NotContains(t, changes, ImportChange{Kind: "secret", Key: "token", Action: ImportActionDelete})
+
+		sub, err := service.GetSubscription("1")
+		assert.NoError(t, err)
+		assert.Equal(t, "Kitchen", sub.Name)
+	})
+
+	t.Run("Replace removes everything that's not in the bundle", func(t *testing.T) {
+		service := newBundleTestService(t)
+
+		_, err := service.Import(bundle, ImportOptions{Mode: ImportModeReplace})
+		assert.NoError(t, err)
+
+		subs, _ := service.GetSubscriptions()
+		assert.Len(t, subs, 2)
+
+		_, err = service.GetSubscription("2")
+		assert.ErrorIs(t, err, datastore.ErrSubscriptionNotFound)
+
+		keys, _ := service.GetSecretKeys()
+		assert.Equal(t, []string{"token"}, keys)
+	})
+
+	t.Run("Conflicts can be skipped, renamed or refused", func(t *testing.T) {
+		service := newBundleTestService(t)
+
+		changes, err := service.Import(bundle, ImportOptions{Conflict: ImportConflictSkip, DryRun: true})
+		assert.NoError(t, err)
+		assert.Equal(t, ImportActionSkip, changes[0].Action)
+
+		changes, err = service.Import(bundle, ImportOptions{Conflict: ImportConflictRename, DryRun: true})
+		assert.NoError(t, err)
+		assert.Equal(t, ImportActionCreate, changes[0].Action)
+		assert.NotEmpty(t, changes[0].NewKey)
+
+		_, err = service.Import(bundle, ImportOptions{Conflict: ImportConflictFail})
+		assert.ErrorIs(t, err, ErrImportConflict)
+	})
+}
+
+func TestImportBlueprintReferences(t *testing.T) {
+	lights := datastore.BlueprintRecord{ID: "lights", Name: "Lights", Subscription: datastore.SubscriptionRecord{Topic: "home/lights"}}
+	heating := datastore.BlueprintRecord{ID: "heating", Name: "Heating", Subscription: datastore.SubscriptionRecord{Topic: "home/heating"}}
+
+	tests := []struct {
+		name   string
+		mode   string
+		bundle Bundle
+		err    error
+	}{
+		{
+			name:   "instances of existing blueprints",
+			bundle: Bundle{Subscriptions: []datastore.SubscriptionRecord{{ID: "3", BlueprintID: "lights"}}},
+		},
+		{
+			name: "instances of imported blueprints",
+			bundle: Bundle{
+				Blueprints:    []datastore.BlueprintRecord{heating},
+				Subscriptions: []datastore.SubscriptionRecord{{ID: "3", BlueprintID: "heating"}},
+			},
+		},
+		{
+			name:   "instances of unknown blueprints",
+			bundle: Bundle{Subscriptions: []datastore.SubscriptionRecord{{ID: "3", BlueprintID: "unknown"}}},
+			err:    ErrUnknownBlueprint,
+		},
+		{
+			name: "replacing keeps the blueprints of imported instances",
+			mode: ImportModeReplace,
+			bundle: Bundle{
+				Blueprints:    []datastore.BlueprintRecord{lights},
+				Subscriptions: []datastore.SubscriptionRecord{{ID: "3", BlueprintID: "lights"}},
+			},
+		},
+		{
+			name:   "replacing deletes blueprints of imported instances",
+			mode:   ImportModeReplace,
+			bundle: Bundle{Subscriptions: []datastore.SubscriptionRecord{{ID: "3", BlueprintID: "lights"}}},
+			err:    ErrBlueprintInUse,
+		},
+		{
+			name:   "merging keeps the blueprints of remaining instances",
+			bundle: Bundle{Blueprints: []datastore.BlueprintRecord{heating}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := datastore.Memory()
+			_, err := store.AddBlueprint(lights)
+			assert.NoError(t, err)
+			_, err = store.AddSubscription(datastore.SubscriptionRecord{ID: "1", Name: "Kitchen lights", BlueprintID: "lights"})
+			assert.NoError(t, err)
+
+			tt.bundle.Version = BundleVersion
+			_, err = NewService(store, "").Import(tt.bundle, ImportOptions{Mode: tt.mode})
+
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestImportEmptyGlobalParameters(t *testing.T) {
+	service := newBundleTestService(t)
+
+	changes, err := service.Import(Bundle{Version: BundleVersion, GlobalParameters: map[string]any{"room": "", "floor": ""}}, ImportOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportChange{
+		{Kind: "globalParameter", Key: "floor", Action: ImportActionCreate},
+		{Kind: "globalParameter", Key: "room", Action: ImportActionUpdate},
+	}, changes)
+
+	params, _ := service.GetGlobalParameters()
+	assert.Equal(t, map[string]any{"room": "", "floor": ""}, params)
+}
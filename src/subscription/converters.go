@@ -4,28 +4,131 @@ import "mqtt-http-bridge/src/datastore"
 
 func subscriptionToStore(sub Subscription) datastore.SubscriptionRecord {
 	return datastore.SubscriptionRecord{
-		ID:      sub.ID,
-		Name:    sub.Name,
-		Topic:   sub.Topic,
-		Extract: sub.Extract,
-		Filter:  sub.Filter,
-		URL:     sub.URL,
-		Method:  sub.Method,
-		Headers: sub.Headers,
-		Body:    sub.Body,
+		ID:       sub.ID,
+		Version:  sub.Version,
+		Name:     sub.Name,
+		Topic:    sub.Topic,
+		Tags:     sub.Tags,
+		Group:    sub.Group,
+		Disabled: sub.Disabled,
+
+		BlueprintID: sub.BlueprintID,
+		Parameters:  sub.Parameters,
+		Extract:     sub.Extract,
+		Filter:      sub.Filter,
+		URL:         sub.URL,
+		Method:      sub.Method,
+		Headers:     sub.Headers,
+		Body:        sub.Body,
+		BodyMode:    sub.BodyMode,
+
+		PayloadFormat: sub.PayloadFormat,
+		SkipRetained:  sub.SkipRetained,
+		ErrorPolicy:   sub.ErrorPolicy,
+
+		StrictPlaceholders: sub.StrictPlaceholders,
 	}
 }
 
 func subscriptionFromStore(sub datastore.SubscriptionRecord) Subscription {
 	return Subscription{
-		ID:      sub.ID,
-		Name:    sub.Name,
-		Topic:   sub.Topic,
-		Extract: sub.Extract,
-		Filter:  sub.Filter,
-		URL:     sub.URL,
-		Method:  sub.Method,
-		Headers: sub.Headers,
-		Body:    sub.Body,
+		ID:       sub.ID,
+		Version:  max(sub.Version, 1),
+		Name:     sub.Name,
+		Topic:    sub.Topic,
+		Tags:     sub.Tags,
+		Group:    sub.Group,
+		Disabled: sub.Disabled,
+
+		BlueprintID: sub.BlueprintID,
+		Parameters:  sub.Parameters,
+		Extract:     sub.Extract,
+		Filter:      sub.Filter,
+		URL:         sub.URL,
+		Method:      sub.Method,
+		Headers:     sub.Headers,
+		Body:        sub.Body,
+		BodyMode:    sub.BodyMode,
+
+		PayloadFormat: sub.PayloadFormat,
+		SkipRetained:  sub.SkipRetained,
+		ErrorPolicy:   sub.ErrorPolicy,
+
+		StrictPlaceholders: sub.StrictPlaceholders,
+	}
+}
+
+func blueprintToStore(blueprint Blueprint) datastore.BlueprintRecord {
+	params := make([]datastore.BlueprintParameterRecord, 0, len(blueprint.Parameters))
+
+	for _, param := range blueprint.Parameters {
+		params = append(params, datastore.BlueprintParameterRecord{
+			Name:        param.Name,
+			Description: param.Description,
+			Default:     param.Default,
+			Required:    param.Required,
+		})
+	}
+
+	return datastore.BlueprintRecord{
+		ID:           blueprint.ID,
+		Name:         blueprint.Name,
+		Description:  blueprint.Description,
+		Parameters:   params,
+		Subscription: subscriptionToStore(blueprint.Subscription),
+	}
+}
+
+func blueprintFromStore(blueprint datastore.BlueprintRecord) Blueprint {
+	params := make([]BlueprintParameter, 0, len(blueprint.Parameters))
+
+	for _, param := range blueprint.Parameters {
+		params = append(params, BlueprintParameter{
+			Name:        param.Name,
+			Description: param.Description,
+			Default:     param.Default,
+			Required:    param.Required,
+		})
+	}
+
+	sub := subscriptionFromStore(blueprint.Subscription)
+	sub.Version = 0
+
+	return Blueprint{
+		ID:           blueprint.ID,
+		Name:         blueprint.Name,
+		Description:  blueprint.Description,
+		Parameters:   params,
+		Subscription: sub,
+	}
+}
+
+func revisionFromStore(revision datastore.RevisionRecord) Revision {
+	changes := make([]RevisionChange, 0, len(revision.Changes))
+
+	for _, change := range revision.Changes {
+		changes = append(changes, RevisionChange{Field: change.Field, Old: change.Old, New: change.New})
+	}
+
+	return Revision{
+		Revision:     revision.Revision,
+		Timestamp:    revision.Timestamp,
+		Author:       revision.Author,
+		Action:       revision.Action,
+		Subscription: subscriptionFromStore(revision.Subscription),
+		Changes:      changes,
+	}
+}
+
+func auditEntryFromStore(entry datastore.AuditRecord) AuditEntry {
+	return AuditEntry{
+		Timestamp:  entry.Timestamp,
+		Actor:      entry.Actor,
+		SourceIP:   entry.SourceIP,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Before:     entry.Before,
+		After:      entry.After,
 	}
 }
@@ -0,0 +1,168 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"mqtt-http-bridge/src/datastore"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	BulkActionEnable  = "enable"
+	BulkActionDisable = "disable"
+	BulkActionDelete  = "delete"
+)
+
+var (
+	ErrEmptySelector     = errors.New("a selector is required for bulk actions")
+	ErrInvalidBulkAction = errors.New("invalid bulk action")
+)
+
+// SubscriptionFilter selects subscriptions, empty fields match everything.
+type SubscriptionFilter struct {
+	// Tags must all be present on the subscription
+	Tags  []string
+	Group string
+	// TopicPrefix matches the start of the topic as configured, e.g. "home/" matches "home/+/temperature"
+	TopicPrefix string
+	// Host matches the host of the URL, case-insensitive
+	Host    string
+	Enabled *bool
+	// Search is matched case-insensitive against the id, name, topic, URL, group and tags
+	Search string
+	// BlueprintID selects the instances of the blueprint
+	BlueprintID string
+}
+
+func (f SubscriptionFilter) IsEmpty() bool {
+	return len(f.Tags) == 0 && f.Group == "" && f.TopicPrefix == "" && f.Host == "" && f.Enabled == nil && f.Search == "" &&
+		f.BlueprintID == ""
+}
+
+func (f SubscriptionFilter) matches(sub Subscription) bool {
+	for _, tag := range f.Tags {
+		if !slices.Contains(sub.Tags, tag) {
+			return false
+		}
+	}
+
+	switch {
+	case f.Group != "" && f.Group != sub.Group,
+		f.TopicPrefix != "" && !strings.HasPrefix(sub.Topic, f.TopicPrefix),
+		f.Host != "" && !strings.EqualFold(f.Host, urlHost(sub.URL)),
+		f.Enabled != nil && *f.Enabled == sub.Disabled,
+		f.Search != "" && !matchesSearch(sub, f.Search),
+		f.BlueprintID != "" && f.BlueprintID != sub.BlueprintID:
+		return false
+	}
+
+	return true
+}
+
+func matchesSearch(sub Subscription, search string) bool {
+	search = strings.ToLower(search)
+
+	for _, field := range append([]string{sub.ID, sub.Name, sub.Topic, sub.URL, sub.Group}, sub.Tags...) {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// urlHost returns the host of the URL without port, or an empty string when it can't be parsed, e.g. because the
+// host is a placeholder.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+func (s *service) FindSubscriptions(filter SubscriptionFilter) ([]Subscription, error) {
+	subs, err := s.GetSubscriptions()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(subs, func(sub Subscription) bool { return !filter.matches(sub) }), nil
+}
+
+func (s *service) ApplyBulkAction(filter SubscriptionFilter, action string, actor Actor) ([]string, error) {
+	if filter.IsEmpty() {
+		return nil, ErrEmptySelector
+	}
+
+	if action != BulkActionEnable && action != BulkActionDisable && action != BulkActionDelete {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBulkAction, action)
+	}
+
+	subs, err := s.FindSubscriptions(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+
+	ids := make([]string, 0, len(subs))
+
+	for _, sub := range subs {
+		changed, err := s.applyBulkAction(sub.ID, action, actor)
+
+		if err != nil {
+			return ids, fmt.Errorf("bulk %s partially applied, failed for %s: %w", action, sub.ID, err)
+		}
+
+		if changed {
+			ids = append(ids, sub.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// applyBulkAction applies the action to a single subscription, subscriptions that are already in the requested state
+// or have been deleted in the meantime are left alone.
+func (s *service) applyBulkAction(id string, action string, actor Actor) (bool, error) {
+	before, err := s.store.GetSubscription(id)
+
+	if errors.Is(err, datastore.ErrSubscriptionNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if action == BulkActionDelete {
+		if err := s.applySubscriptionChange(ActionDelete, before, datastore.SubscriptionRecord{}, actor); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	after := before
+	after.Disabled = action == BulkActionDisable
+
+	if after.Disabled == before.Disabled {
+		return false, nil
+	}
+
+	after.Version = nextVersion(before)
+
+	if err := s.applySubscriptionChange(ActionUpdate, before, after, actor); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,112 @@
+package subscription
+
+import (
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/datastore"
+	"testing"
+)
+
+func TestFindSubscriptions(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "")
+	alice := Actor{Name: "alice"}
+
+	for _, sub := range []Subscription{
+		{Name: "Kitchen lights", Topic: "home/kitchen/lights", URL: "https://lights.example.com/kitchen", Tags: []string{"lights", "kitchen"}, Group: "home"},
+		{Name: "Hallway lights", Topic: "home/hallway/lights", URL: "https://lights.example.com:8443/hallway", Tags: []string{"lights"}, Group: "home", Disabled: true},
+		{Name: "Office printer", Topic: "office/printer", URL: "https://{{ .global.host }}/print", Group: "office"},
+	} {
+		_, err := service.AddSubscription(sub, alice)
+		assert.NoError(t, err)
+	}
+
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name     string
+		filter   SubscriptionFilter
+		expected []string
+	}{
+		{"empty filter", SubscriptionFilter{}, []string{"Hallway lights", "Kitchen lights", "Office printer"}},
+		{"single tag", SubscriptionFilter{Tags: []string{"lights"}}, []string{"Hallway lights", "Kitchen lights"}},
+		{"all tags", SubscriptionFilter{Tags: []string{"lights", "kitchen"}}, []string{"Kitchen lights"}},
+		{"group", SubscriptionFilter{Group: "office"}, []string{"Office printer"}},
+		{"topic prefix", SubscriptionFilter{TopicPrefix: "home/h"}, []string{"Hallway lights"}},
+		{"host ignores port and case", SubscriptionFilter{Host: "LIGHTS.example.com"}, []string{"Hallway lights", "Kitchen lights"}},
+		{"enabled", SubscriptionFilter{Enabled: &enabled}, []string{"Kitchen lights", "Office printer"}},
+		{"disabled", SubscriptionFilter{Enabled: &disabled}, []string{"Hallway lights"}},
+		{"search", SubscriptionFilter{Search: "PRINT"}, []string{"Office printer"}},
+		{"search tags", SubscriptionFilter{Search: "kitch"}, []string{"Kitchen lights"}},
+		{"combined", SubscriptionFilter{Group: "home", Enabled: &enabled}, []string{"Kitchen lights"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subs, err := service.FindSubscriptions(test.filter)
+			assert.NoError(t, err)
+
+			names := make([]string, 0, len(subs))
+
+			for _, sub := range subs {
+				names = append(names, sub.Name)
+			}
+
+			assert.Equal(t, test.expected, names)
+		})
+	}
+}
+
+func TestApplyBulkAction(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "")
+	alice := Actor{Name: "alice"}
+
+	lights, _ := service.AddSubscription(Subscription{Name: "Lights", Topic: "home/lights", Tags: []string{"lights"}}, alice)
+	heating, _ := service.AddSubscription(Subscription{Name: "Heating", Topic: "home/heating"}, alice)
+
+	t.Run("An empty selector is rejected", func(t *testing.T) {
+		_, err := service.ApplyBulkAction(SubscriptionFilter{}, BulkActionDelete, alice)
+
+		assert.ErrorIs(t, err, ErrEmptySelector)
+	})
+
+	t.Run("An unknown action is rejected", func(t *testing.T) {
+		_, err := service.ApplyBulkAction(SubscriptionFilter{Group: "home"}, "archive", alice)
+
+		assert.ErrorIs(t, err, ErrInvalidBulkAction)
+	})
+
+	t.Run("Disabled subscriptions are no longer matched by topic", func(t *testing.T) {
+		ids, err := service.ApplyBulkAction(SubscriptionFilter{TopicPrefix: "home/"}, BulkActionDisable, alice)
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{lights.ID, heating.ID}, ids)
+
+		matched, _ := service.GetSubscriptionsForTopic("home/lights")
+		assert.Empty(t, matched)
+
+		current, _ := service.GetSubscription(lights.ID)
+		assert.True(t, current.Disabled)
+		assert.Equal(t, 2, current.Version)
+	})
+
+	t.Run("Only subscriptions that change are reported", func(t *testing.T) {
+		ids, err := service.ApplyBulkAction(SubscriptionFilter{Tags: []string{"lights"}}, BulkActionEnable, alice)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{lights.ID}, ids)
+
+		ids, err = service.ApplyBulkAction(SubscriptionFilter{Tags: []string{"lights"}}, BulkActionEnable, alice)
+		assert.NoError(t, err)
+		assert.Empty(t, ids)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		ids, err := service.ApplyBulkAction(SubscriptionFilter{Search: "heat"}, BulkActionDelete, alice)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{heating.ID}, ids)
+
+		_, err = service.GetSubscription(heating.ID)
+		assert.ErrorIs(t, err, datastore.ErrSubscriptionNotFound)
+	})
+}
@@ -0,0 +1,223 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"mqtt-http-bridge/src/datastore"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// Actions are the kinds of changes recorded in revisions and the audit log.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionImport  = "import"
+	ActionReset   = "reset"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+type Revision struct {
+	Revision     int
+	Timestamp    time.Time
+	Author       string
+	Action       string
+	Subscription Subscription
+	Changes      []RevisionChange
+}
+
+type RevisionChange struct {
+	Field string
+	Old   any
+	New   any
+}
+
+func (s *service) GetRevisions(id string) ([]Revision, error) {
+	records, err := s.store.GetRevisions(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]Revision, 0, len(records))
+
+	for _, record := range records {
+		revisions = append(revisions, revisionFromStore(record))
+	}
+
+	// Most recent first
+	slices.Reverse(revisions)
+
+	return revisions, nil
+}
+
+func (s *service) RestoreRevision(id string, revision int, actor Actor) (Subscription, error) {
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+
+	records, err := s.store.GetRevisions(id)
+
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	index := slices.IndexFunc(records, func(r datastore.RevisionRecord) bool { return r.Revision == revision })
+
+	if index == -1 {
+		return Subscription{}, fmt.Errorf("%w: %s revision %d", ErrRevisionNotFound, id, revision)
+	}
+
+	snapshot := records[index].Subscription
+
+	current, err := s.store.GetSubscription(id)
+
+	switch {
+	case errors.Is(err, datastore.ErrSubscriptionNotFound):
+		// The subscription is recreated when it has been deleted since, continuing from the version it had.
+		snapshot.Version = nextVersion(snapshot)
+	case err == nil:
+		snapshot.Version = nextVersion(current)
+	default:
+		return Subscription{}, err
+	}
+
+	if err := s.applySubscriptionChange(ActionRestore, current, snapshot, actor); err != nil {
+		return Subscription{}, err
+	}
+
+	return subscriptionFromStore(snapshot), nil
+}
+
+// applySubscriptionChange stores the change from before to after (empty when created or deleted) together with its
+// revision and audit entry, in a single write.
+func (s *service) applySubscriptionChange(action string, before datastore.SubscriptionRecord, after datastore.SubscriptionRecord, actor Actor) error {
+	s.revisionsMu.Lock()
+	defer s.revisionsMu.Unlock()
+
+	var changes datastore.Changes
+
+	if err := s.addSubscriptionChange(&changes, action, before, after, actor.Name); err != nil {
+		return err
+	}
+
+	id := after.ID
+	var auditBefore, auditAfter any
+
+	if before.ID != "" {
+		id = before.ID
+		auditBefore = before
+	}
+
+	if after.ID != "" {
+		auditAfter = after
+	}
+
+	changes.AuditEntries = append(changes.AuditEntries, auditRecord(actor, action, AuditEntitySubscription, id, auditBefore, auditAfter))
+
+	return s.store.Apply(changes)
+}
+
+// addSubscriptionChange adds the change from before to after (empty when created or deleted) to the changes, with the
+// latest revision of the subscription. It must be called while holding revisionsMu, so revision numbers are assigned
+// sequentially.
+func (s *service) addSubscriptionChange(changes *datastore.Changes, action string, before datastore.SubscriptionRecord, after datastore.SubscriptionRecord, author string) error {
+	revision, err := s.nextRevision(action, before, after, author)
+
+	if err != nil {
+		return err
+	}
+
+	if after.ID == "" {
+		changes.DeletedSubscriptions = append(changes.DeletedSubscriptions, before.ID)
+	} else {
+		changes.Subscriptions = append(changes.Subscriptions, after)
+	}
+
+	changes.Revisions = append(changes.Revisions, revision)
+
+	return nil
+}
+
+// nextRevision returns the revision recording the change from before to after (empty when created). Deletions keep
+// the snapshot from before.
+func (s *service) nextRevision(action string, before datastore.SubscriptionRecord, after datastore.SubscriptionRecord, author string) (datastore.RevisionRecord, error) {
+	revision := datastore.RevisionRecord{
+		Revision:     1,
+		Timestamp:    time.Now().UTC(),
+		Author:       author,
+		Action:       action,
+		Subscription: after,
+		Changes:      diffSubscriptions(subscriptionFromStore(before), subscriptionFromStore(after)),
+	}
+
+	if action == ActionDelete {
+		revision.Subscription = before
+		revision.Changes = nil
+	}
+
+	revision.SubscriptionID = revision.Subscription.ID
+
+	records, err := s.store.GetRevisions(revision.SubscriptionID)
+
+	if err != nil {
+		return datastore.RevisionRecord{}, fmt.Errorf("unable to record revision: %w", err)
+	}
+
+	if len(records) > 0 {
+		revision.Revision = records[len(records)-1].Revision + 1
+	}
+
+	return revision, nil
+}
+
+// diffSubscriptions returns the fields that differ, named as in the API.
+func diffSubscriptions(old Subscription, new Subscription) []datastore.FieldChangeRecord {
+	fields := []struct {
+		name     string
+		old, new any
+	}{
+		{"name", old.Name, new.Name},
+		{"topic", old.Topic, new.Topic},
+		{"tags", old.Tags, new.Tags},
+		{"group", old.Group, new.Group},
+		{"enabled", !old.Disabled, !new.Disabled},
+		{"blueprintId", old.BlueprintID, new.BlueprintID},
+		{"parameters", old.Parameters, new.Parameters},
+		{"payloadFormat", old.PayloadFormat, new.PayloadFormat},
+		{"extract", old.Extract, new.Extract},
+		{"filter", old.Filter, new.Filter},
+		{"skipRetained", old.SkipRetained, new.SkipRetained},
+		{"strictPlaceholders", old.StrictPlaceholders, new.StrictPlaceholders},
+		{"errorPolicy", old.ErrorPolicy, new.ErrorPolicy},
+		{"method", old.Method, new.Method},
+		{"url", old.URL, new.URL},
+		{"headers", old.Headers, new.Headers},
+		{"body", old.Body, new.Body},
+		{"bodyMode", old.BodyMode, new.BodyMode},
+	}
+
+	var changes []datastore.FieldChangeRecord
+
+	for _, field := range fields {
+		if isEmpty(field.old) && isEmpty(field.new) {
+			continue
+		}
+
+		if !reflect.DeepEqual(field.old, field.new) {
+			changes = append(changes, datastore.FieldChangeRecord{Field: field.name, Old: field.old, New: field.new})
+		}
+	}
+
+	return changes
+}
+
+// isEmpty treats nil and empty maps or slices the same, so they're not reported as changes.
+func isEmpty(value any) bool {
+	v := reflect.ValueOf(value)
+
+	return !v.IsValid() || v.IsZero() || ((v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.Len() == 0)
+}
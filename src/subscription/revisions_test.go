@@ -0,0 +1,86 @@
+package subscription
+
+import (
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/datastore"
+	"testing"
+)
+
+func TestRevisions(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "")
+
+	sub, err := service.AddSubscription(Subscription{Name: "Kitchen", Topic: "home/kitchen", Filter: "state = 'ON'"}, Actor{Name: "alice"})
+	assert.NoError(t, err)
+
+	sub.Filter = "state = 'OFF'"
+	_, err = service.UpdateSubscription(sub, Actor{Name: "bob"})
+	assert.NoError(t, err)
+
+	t.Run("Revisions are listed most recent first, with the changes", func(t *testing.T) {
+		revisions, err := service.GetRevisions(sub.ID)
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 2)
+
+		assert.Equal(t, 2, revisions[0].Revision)
+		assert.Equal(t, "bob", revisions[0].Author)
+		assert.Equal(t, ActionUpdate, revisions[0].Action)
+		assert.Equal(t, []RevisionChange{{Field: "filter", Old: "state = 'ON'", New: "state = 'OFF'"}}, revisions[0].Changes)
+
+		assert.Equal(t, ActionCreate, revisions[1].Action)
+		assert.Equal(t, "alice", revisions[1].Author)
+	})
+
+	t.Run("Restoring a revision replaces the subscription", func(t *testing.T) {
+		restored, err := service.RestoreRevision(sub.ID, 1, Actor{Name: "carol"})
+		assert.NoError(t, err)
+		assert.Equal(t, "state = 'ON'", restored.Filter)
+
+		revisions, _ := service.GetRevisions(sub.ID)
+		assert.Equal(t, ActionRestore, revisions[0].Action)
+		assert.Equal(t, 3, revisions[0].Revision)
+	})
+
+	t.Run("Deleted subscriptions can be restored", func(t *testing.T) {
+		assert.NoError(t, service.DeleteSubscription(sub.ID, 0, Actor{Name: "dave"}))
+
+		revisions, _ := service.GetRevisions(sub.ID)
+		assert.Equal(t, ActionDelete, revisions[0].Action)
+		assert.Equal(t, "Kitchen", revisions[0].Subscription.Name)
+
+		_, err := service.RestoreRevision(sub.ID, revisions[0].Revision, Actor{Name: "dave"})
+		assert.NoError(t, err)
+
+		restored, err := service.GetSubscription(sub.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "state = 'ON'", restored.Filter)
+	})
+
+	t.Run("Unknown revisions are reported", func(t *testing.T) {
+		_, err := service.RestoreRevision(sub.ID, 99, Actor{})
+		assert.ErrorIs(t, err, ErrRevisionNotFound)
+	})
+}
+
+// failingStore fails every change, like a store that can't write its file.
+type failingStore struct {
+	datastore.Store
+}
+
+func (s failingStore) Apply(datastore.Changes) error {
+	return datastore.ErrFlushFailed
+}
+
+func TestFailedChangesLeaveNoTrace(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(failingStore{store}, "")
+
+	_, err := service.AddSubscription(Subscription{Name: "Kitchen", Topic: "home/kitchen"}, Actor{Name: "alice"})
+	assert.ErrorIs(t, err, datastore.ErrFlushFailed)
+
+	subs, _ := store.GetSubscriptions()
+	assert.Empty(t, subs)
+
+	entries, _ := store.GetAuditEntries()
+	assert.Empty(t, entries)
+}
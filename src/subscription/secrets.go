@@ -0,0 +1,131 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"mqtt-http-bridge/src/datastore"
+	"mqtt-http-bridge/src/utilities"
+	"slices"
+	"strings"
+)
+
+const redactedSecret = "********"
+
+func (s *service) SetSecret(key string, value string, actor Actor) error {
+	if s.secretsKey == "" {
+		return ErrSecretsNotConfigured
+	}
+
+	if !globalParameterKeyRegex.MatchString(key) {
+		return fmt.Errorf("%w: %s", ErrInvalidGlobalParameterKey, key)
+	}
+
+	encrypted, err := utilities.Encrypt(s.secretsKey, value)
+
+	if err != nil {
+		return fmt.Errorf("unable to encrypt secret: %w", err)
+	}
+
+	changes := datastore.Changes{Secrets: map[string]string{key: encrypted}}
+
+	// The value of a secret never ends up in the audit log.
+	return s.applyAudited(changes, actor, ActionUpdate, AuditEntitySecret, key, nil, redactedSecret)
+}
+
+func (s *service) DeleteSecret(key string, actor Actor) error {
+	changes := datastore.Changes{DeletedSecrets: []string{key}}
+
+	return s.applyAudited(changes, actor, ActionDelete, AuditEntitySecret, key, redactedSecret, nil)
+}
+
+func (s *service) GetSecretKeys() ([]string, error) {
+	secrets, err := s.store.GetSecrets()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(secrets))
+
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys, nil
+}
+
+func (s *service) GetSecrets() (map[string]any, error) {
+	secrets := make(map[string]any)
+
+	encrypted, err := s.store.GetSecrets()
+
+	if err != nil || len(encrypted) == 0 {
+		return secrets, err
+	}
+
+	if s.secretsKey == "" {
+		return secrets, ErrSecretsNotConfigured
+	}
+
+	var errs []error
+
+	for key, value := range encrypted {
+		decrypted, err := utilities.Decrypt(s.secretsKey, value)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to decrypt secret %s: %w", key, err))
+			continue
+		}
+
+		secrets[key] = decrypted
+	}
+
+	return secrets, errors.Join(errs...)
+}
+
+func (s *service) RedactSecrets(text string) string {
+	for _, value := range s.secretValues() {
+		text = strings.ReplaceAll(text, value, redactedSecret)
+	}
+
+	return text
+}
+
+// secretValues returns the decrypted values of the secrets, they're only decrypted again after the store changed.
+func (s *service) secretValues() []string {
+	s.redactionsMu.RLock()
+	values, generation := s.redactions, s.redactionsGeneration
+	s.redactionsMu.RUnlock()
+
+	if values != nil {
+		return values
+	}
+
+	secrets, _ := s.GetSecrets()
+	values = make([]string, 0, len(secrets))
+
+	for _, value := range secrets {
+		if v, ok := value.(string); ok && v != "" {
+			values = append(values, v)
+		}
+	}
+
+	s.redactionsMu.Lock()
+	defer s.redactionsMu.Unlock()
+
+	// The secrets may have changed while they were decrypted, those values are decrypted again next time.
+	if generation == s.redactionsGeneration {
+		s.redactions = values
+	}
+
+	return values
+}
+
+func (s *service) clearRedactions() {
+	s.redactionsMu.Lock()
+	s.redactions = nil
+	s.redactionsGeneration++
+	s.redactionsMu.Unlock()
+}
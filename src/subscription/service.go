@@ -8,57 +8,145 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 )
 
 var (
 	ErrMissingRequiredParametersForTemplate         = errors.New("missing required parameters for template")
 	ErrUnableToHydrateTemplatedSubscriptionProperty = errors.New("unable to hydrate templated subscription property")
 	ErrInvalidGlobalParameterKey                    = errors.New("invalid key")
+	ErrInvalidGlobalParameterValue                  = errors.New("invalid value")
+	ErrReadOnlyGlobalParameter                      = errors.New("global parameter is defined in the config and read-only")
+	ErrSecretsNotConfigured                         = errors.New("no secrets key configured")
+	ErrVersionMismatch                              = errors.New("subscription has been changed since it was retrieved")
 )
 
 type Service interface {
-	AddSubscription(subscription Subscription) (Subscription, error)
+	// All changes are recorded in the audit log and revisions (for subscriptions), attributed to the actor.
+
+	AddSubscription(subscription Subscription, actor Actor) (Subscription, error)
 	GetSubscription(id string) (Subscription, error)
 	GetSubscriptions() ([]Subscription, error)
-	UpdateSubscription(subscription Subscription) (Subscription, error)
-	DeleteSubscription(id string) error
-
-	SetGlobalParameter(key string, value string) error
-	DeleteGlobalParameter(key string) error
+	// FindSubscriptions returns the subscriptions matching the filter, sorted like GetSubscriptions.
+	FindSubscriptions(filter SubscriptionFilter) ([]Subscription, error)
+	// ApplyBulkAction enables, disables or deletes all subscriptions matching the filter, which may not be empty. It
+	// returns the IDs of the subscriptions that changed.
+	ApplyBulkAction(filter SubscriptionFilter, action string, actor Actor) ([]string, error)
+	// UpdateSubscription replaces the subscription, which must still be at the version of the given subscription. A
+	// version of 0 skips the check.
+	UpdateSubscription(subscription Subscription, actor Actor) (Subscription, error)
+	// DeleteSubscription removes the subscription, which must still be at the given version. A version of 0 skips the
+	// check.
+	DeleteSubscription(id string, version int, actor Actor) error
+
+	// Blueprints are subscriptions with declared parameters, subscriptions with a BlueprintID are instances of them.
+	// Subscriptions are returned with the fields of their blueprint filled in.
+
+	AddBlueprint(blueprint Blueprint, actor Actor) (Blueprint, error)
+	GetBlueprint(id string) (Blueprint, error)
+	GetBlueprints() ([]Blueprint, error)
+	// UpdateBlueprint replaces the blueprint, which changes all of its instances.
+	UpdateBlueprint(blueprint Blueprint, actor Actor) (Blueprint, error)
+	// DeleteBlueprint removes the blueprint, which may not have any instances.
+	DeleteBlueprint(id string, actor Actor) error
+
+	// GetRevisions returns the revisions of the subscription, most recent first.
+	GetRevisions(id string) ([]Revision, error)
+	// RestoreRevision replaces the subscription with the snapshot of the revision, recreating it if it was deleted.
+	RestoreRevision(id string, revision int, actor Actor) (Subscription, error)
+
+	// GetAuditEntries returns the audit log entries matching the filter, most recent first.
+	GetAuditEntries(filter AuditFilter) ([]AuditEntry, error)
+
+	// SetGlobalParameter stores a parameter, the value can be any JSON compatible value, keys of nested objects must
+	// satisfy the same rules as the top level key.
+	SetGlobalParameter(key string, value any, actor Actor) error
+	DeleteGlobalParameter(key string, actor Actor) error
+	// GetGlobalParameters returns the parameters from the store, merged with those from the config.
 	GetGlobalParameters() (map[string]any, error)
-
+	// SetConfiguredGlobalParameters replaces the read-only global parameters that are declared in the config.
+	SetConfiguredGlobalParameters(params map[string]any) error
+	GetConfiguredGlobalParameterKeys() []string
+
+	// OnChange registers a listener that is called after the subscriptions, parameters or secrets changed
+	OnChange(listener func())
+	// Close flushes the store, the service can't be used afterwards
+	Close() error
+
+	SetSecret(key string, value string, actor Actor) error
+	DeleteSecret(key string, actor Actor) error
+	// GetSecretKeys returns the names of all secrets, without their values.
+	GetSecretKeys() ([]string, error)
+	// GetSecrets returns all decrypted secrets, secrets that can't be decrypted are left out and reported in the error.
+	GetSecrets() (map[string]any, error)
+	// RedactSecrets replaces the values of all secrets in the text.
+	RedactSecrets(text string) string
+
+	// GetSubscriptionsForTopic returns the enabled subscriptions whose topic matches.
 	GetSubscriptionsForTopic(topic string) ([]Subscription, error)
 
 	ApplyPlaceholdersOnSubscription(sub Subscription, params map[string]any) (Subscription, error)
 
+	// Export returns the subscriptions and global parameters in the store, and the encrypted secrets if requested.
+	Export(includeSecrets bool) (Bundle, error)
+	// Import applies the bundle to the store and returns the changes, which are only reported for a dry run.
+	Import(bundle Bundle, opts ImportOptions) ([]ImportChange, error)
+
 	// Reset removes everything from the store, mostly only used for development purposes.
-	Reset() error
+	Reset(actor Actor) error
 }
 
-func NewService(store datastore.Store) Service {
-	return &service{
-		store: store,
+// NewService creates the subscription service, secrets can only be used when a secretsKey is provided.
+func NewService(store datastore.Store, secretsKey string) Service {
+	s := &service{
+		secretsKey: secretsKey,
+		store:      store,
 
 		topicMatcher: newTopicMatcher(),
 	}
+
+	// The secrets are decrypted again when they're next redacted.
+	store.OnChange(s.clearRedactions)
+
+	return s
 }
 
 type service struct {
-	store datastore.Store
+	secretsKey string
+	store      datastore.Store
+
+	configuredGlobalParameters   map[string]any
+	configuredGlobalParametersMu sync.RWMutex
+
+	// revisionsMu ensures revision numbers are assigned sequentially
+	revisionsMu sync.Mutex
+	// subscriptionsMu ensures the version of a subscription doesn't change between checking and changing it
+	subscriptionsMu sync.Mutex
+
+	// redactions caches the decrypted secrets for RedactSecrets, it's nil until they're first needed
+	redactions []string
+	// redactionsGeneration is incremented when the store changes, so values decrypted before aren't cached
+	redactionsGeneration int
+	redactionsMu         sync.RWMutex
 
 	topicMatcher *topicMatcher
 }
 
-func (s *service) AddSubscription(subscription Subscription) (Subscription, error) {
+func (s *service) AddSubscription(subscription Subscription, actor Actor) (Subscription, error) {
 	subscription.ID = utilities.GenerateRandomID()
+	subscription.Version = 1
 
-	sub, err := s.store.AddSubscription(subscriptionToStore(subscription))
+	record, err := s.toInstanceRecord(subscription)
 
 	if err != nil {
 		return Subscription{}, err
 	}
 
-	return subscriptionFromStore(sub), nil
+	if err := s.applySubscriptionChange(ActionCreate, datastore.SubscriptionRecord{}, record, actor); err != nil {
+		return Subscription{}, err
+	}
+
+	return s.expandOne(record)
 }
 
 func (s *service) GetSubscription(id string) (Subscription, error) {
@@ -68,26 +156,30 @@ func (s *service) GetSubscription(id string) (Subscription, error) {
 		return Subscription{}, err
 	}
 
-	return subscriptionFromStore(sub), nil
+	return s.expandOne(sub)
 }
 
-func (s *service) GetSubscriptions() ([]Subscription, error) {
-	subscriptions := make([]Subscription, 0)
+func (s *service) expandOne(record datastore.SubscriptionRecord) (Subscription, error) {
+	subs, err := s.expand([]datastore.SubscriptionRecord{record})
+
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	return subs[0], nil
+}
 
+func (s *service) GetSubscriptions() ([]Subscription, error) {
 	subs, err := s.store.GetSubscriptions()
 
 	if err != nil {
-		return subscriptions, err
+		return make([]Subscription, 0), err
 	}
 
-	for _, sub := range subs {
-		converted := subscriptionFromStore(sub)
+	subscriptions, err := s.expand(subs)
 
-		if hydrated, err := s.hydrateTemplatedSubscription(converted); err != nil {
-			subscriptions = append(subscriptions, converted)
-		} else {
-			subscriptions = append(subscriptions, hydrated)
-		}
+	if err != nil {
+		return make([]Subscription, 0), err
 	}
 
 	slices.SortStableFunc(subscriptions, func(a, b Subscription) int {
@@ -102,77 +194,267 @@ func (s *service) GetSubscriptions() ([]Subscription, error) {
 	return subscriptions, nil
 }
 
-func (s *service) UpdateSubscription(subscription Subscription) (Subscription, error) {
-	sub, err := s.store.UpdateSubscription(subscriptionToStore(subscription))
+func (s *service) UpdateSubscription(subscription Subscription, actor Actor) (Subscription, error) {
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+
+	before, err := s.store.GetSubscription(subscription.ID)
 
 	if err != nil {
 		return Subscription{}, err
 	}
 
-	return subscriptionFromStore(sub), nil
+	if err := checkVersion(before, subscription.Version); err != nil {
+		return Subscription{}, err
+	}
+
+	record, err := s.toInstanceRecord(subscription)
+
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	record.Version = nextVersion(before)
+
+	if err := s.applySubscriptionChange(ActionUpdate, before, record, actor); err != nil {
+		return Subscription{}, err
+	}
+
+	return s.expandOne(record)
+}
+
+func (s *service) DeleteSubscription(id string, version int, actor Actor) error {
+	s.subscriptionsMu.Lock()
+	defer s.subscriptionsMu.Unlock()
+
+	before, err := s.store.GetSubscription(id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := checkVersion(before, version); err != nil {
+		return err
+	}
+
+	return s.applySubscriptionChange(ActionDelete, before, datastore.SubscriptionRecord{}, actor)
 }
 
-func (s *service) DeleteSubscription(id string) error {
-	return s.store.DeleteSubscription(id)
+// checkVersion returns ErrVersionMismatch when the stored subscription is no longer at the expected version, unless
+// the expected version is 0.
+func checkVersion(current datastore.SubscriptionRecord, expected int) error {
+	if actual := subscriptionFromStore(current).Version; expected != 0 && expected != actual {
+		return fmt.Errorf("%w: expected version %d, current version is %d", ErrVersionMismatch, expected, actual)
+	}
+
+	return nil
+}
+
+// nextVersion returns the version of the subscription after changing it.
+func nextVersion(current datastore.SubscriptionRecord) int {
+	return subscriptionFromStore(current).Version + 1
 }
 
 var globalParameterKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_.]+$`)
 
-func (s *service) SetGlobalParameter(key string, value string) error {
+func (s *service) SetGlobalParameter(key string, value any, actor Actor) error {
 	if !globalParameterKeyRegex.MatchString(key) {
 		return fmt.Errorf("%w: %s", ErrInvalidGlobalParameterKey, key)
 	}
 
-	return s.store.SetGlobalParameter(key, value)
+	if s.isConfiguredGlobalParameter(key) {
+		return fmt.Errorf("%w: %s", ErrReadOnlyGlobalParameter, key)
+	}
+
+	if err := validateGlobalParameterValue(key, value); err != nil {
+		return err
+	}
+
+	// Setting an empty value removes the parameter.
+	if value == "" {
+		return s.DeleteGlobalParameter(key, actor)
+	}
+
+	params, err := s.store.GetGlobalParameters()
+
+	if err != nil {
+		return err
+	}
+
+	before, exists := params[key]
+	action := ActionUpdate
+
+	if !exists {
+		action = ActionCreate
+	}
+
+	changes := datastore.Changes{GlobalParameters: map[string]any{key: value}}
+
+	return s.applyAudited(changes, actor, action, AuditEntityGlobalParameter, key, before, value)
+}
+
+func validateGlobalParameterValue(path string, value any) error {
+	switch v := value.(type) {
+	case nil:
+		return fmt.Errorf("%w: %s cannot be null", ErrInvalidGlobalParameterValue, path)
+	case map[string]any:
+		for key, item := range v {
+			if !globalParameterKeyRegex.MatchString(key) {
+				return fmt.Errorf("%w: %s.%s", ErrInvalidGlobalParameterKey, path, key)
+			}
+
+			if err := validateGlobalParameterValue(path+"."+key, item); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for idx, item := range v {
+			if err := validateGlobalParameterValue(fmt.Sprintf("%s[%d]", path, idx), item); err != nil {
+				return err
+			}
+		}
+	case string, bool, float64, int, int64:
+	default:
+		return fmt.Errorf("%w: %s has unsupported type %T", ErrInvalidGlobalParameterValue, path, value)
+	}
+
+	return nil
 }
 
 func (s *service) GetGlobalParameters() (map[string]any, error) {
-	return s.store.GetGlobalParameters()
+	params, err := s.store.GetGlobalParameters()
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.configuredGlobalParametersMu.RLock()
+	defer s.configuredGlobalParametersMu.RUnlock()
+
+	for key, value := range s.configuredGlobalParameters {
+		params[key] = value
+	}
+
+	return params, nil
+}
+
+func (s *service) DeleteGlobalParameter(key string, actor Actor) error {
+	if s.isConfiguredGlobalParameter(key) {
+		return fmt.Errorf("%w: %s", ErrReadOnlyGlobalParameter, key)
+	}
+
+	params, err := s.store.GetGlobalParameters()
+
+	if err != nil {
+		return err
+	}
+
+	changes := datastore.Changes{DeletedGlobalParameters: []string{key}}
+
+	return s.applyAudited(changes, actor, ActionDelete, AuditEntityGlobalParameter, key, params[key], nil)
+}
+
+func (s *service) SetConfiguredGlobalParameters(params map[string]any) error {
+	for key, value := range params {
+		if !globalParameterKeyRegex.MatchString(key) {
+			return fmt.Errorf("%w: %s", ErrInvalidGlobalParameterKey, key)
+		}
+
+		if err := validateGlobalParameterValue(key, value); err != nil {
+			return err
+		}
+	}
+
+	s.configuredGlobalParametersMu.Lock()
+	defer s.configuredGlobalParametersMu.Unlock()
+
+	s.configuredGlobalParameters = params
+
+	return nil
+}
+
+func (s *service) GetConfiguredGlobalParameterKeys() []string {
+	s.configuredGlobalParametersMu.RLock()
+	defer s.configuredGlobalParametersMu.RUnlock()
+
+	keys := make([]string, 0, len(s.configuredGlobalParameters))
+
+	for key := range s.configuredGlobalParameters {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+func (s *service) OnChange(listener func()) {
+	s.store.OnChange(listener)
+}
+
+func (s *service) Close() error {
+	return s.store.Close()
 }
 
-func (s *service) DeleteGlobalParameter(key string) error {
-	return s.store.DeleteGlobalParameter(key)
+func (s *service) isConfiguredGlobalParameter(key string) bool {
+	s.configuredGlobalParametersMu.RLock()
+	defer s.configuredGlobalParametersMu.RUnlock()
+
+	_, ok := s.configuredGlobalParameters[key]
+
+	return ok
 }
 
 func (s *service) GetSubscriptionsForTopic(topic string) ([]Subscription, error) {
 	subscriptions := make([]Subscription, 0)
 
-	subs, err := s.store.GetSubscriptions()
+	records, err := s.store.GetSubscriptions()
 
 	if err != nil {
 		return subscriptions, err
 	}
 
-	for _, sub := range subs {
-		if s.topicMatcher.match(topic, sub.Topic) {
-			converted := subscriptionFromStore(sub)
+	subs, err := s.expand(records)
 
-			if hydrated, err := s.hydrateTemplatedSubscription(converted); err != nil {
-				subscriptions = append(subscriptions, converted)
-			} else {
-				subscriptions = append(subscriptions, hydrated)
-			}
+	if err != nil {
+		return subscriptions, err
+	}
+
+	for _, sub := range subs {
+		// Placeholders are applied by the processor, once the values extracted from the message are known.
+		if !sub.Disabled && s.topicMatcher.match(topic, sub.Topic) {
+			subscriptions = append(subscriptions, sub)
 		}
 	}
 
 	return subscriptions, nil
 }
 
-func (s *service) Reset() error {
-	// Delete all subscriptions
+func (s *service) Reset(actor Actor) error {
+	// Delete all subscriptions and blueprints
 	subs, err := s.store.GetSubscriptions()
 
 	if err != nil {
 		return err
 	}
 
+	blueprints, err := s.store.GetBlueprints()
+
+	if err != nil {
+		return err
+	}
+
+	var changes datastore.Changes
+
 	for _, sub := range subs {
-		if err := s.store.DeleteSubscription(sub.ID); err != nil {
-			return err
-		}
+		changes.DeletedSubscriptions = append(changes.DeletedSubscriptions, sub.ID)
 	}
 
-	return nil
+	for _, blueprint := range blueprints {
+		changes.DeletedBlueprints = append(changes.DeletedBlueprints, blueprint.ID)
+	}
+
+	return s.applyAudited(changes, actor, ActionReset, AuditEntityStore, "", subs, nil)
 }
 
 func (s *service) ApplyPlaceholdersOnSubscription(sub Subscription, params map[string]any) (Subscription, error) {
@@ -188,6 +470,12 @@ func (s *service) ApplyPlaceholdersOnSubscription(sub Subscription, params map[s
 		return Subscription{}, fmt.Errorf("%w: %w", ErrUnableToHydrateTemplatedSubscriptionProperty, err)
 	}
 
+	if subClone.StrictPlaceholders {
+		if missing := missingPlaceholders(subClone, params); len(missing) > 0 {
+			return Subscription{}, fmt.Errorf("%w: %s", ErrMissingRequiredParametersForTemplate, strings.Join(missing, ", "))
+		}
+	}
+
 	if subClone.Name, err = utilities.RenderInlineTemplate(subClone.Name, params); err != nil {
 		return Subscription{}, fmt.Errorf("%w name: %w", ErrUnableToHydrateTemplatedSubscriptionProperty, err)
 	}
@@ -200,9 +488,8 @@ func (s *service) ApplyPlaceholdersOnSubscription(sub Subscription, params map[s
 		return Subscription{}, fmt.Errorf("%w filter: %w", ErrUnableToHydrateTemplatedSubscriptionProperty, err)
 	}
 
-	if subClone.Body, err = utilities.RenderInlineTemplate(subClone.Body, params); err != nil {
-		return Subscription{}, fmt.Errorf("%w body template: %w", ErrUnableToHydrateTemplatedSubscriptionProperty, err)
-	}
+	// The body is left to the processor, which renders it exactly once. Rendering it here as well would execute
+	// placeholders that arrived in the message.
 
 	if subClone.Method, err = utilities.RenderInlineTemplate(subClone.Method, params); err != nil {
 		return Subscription{}, fmt.Errorf("%w method: %w", ErrUnableToHydrateTemplatedSubscriptionProperty, err)
@@ -221,6 +508,29 @@ func (s *service) ApplyPlaceholdersOnSubscription(sub Subscription, params map[s
 	return subClone, nil
 }
 
-func (s *service) hydrateTemplatedSubscription(sub Subscription) (Subscription, error) {
-	return s.ApplyPlaceholdersOnSubscription(sub, nil)
+// missingPlaceholders returns the unresolvable placeholders in the properties that make up the HTTP request.
+func missingPlaceholders(sub Subscription, params map[string]any) []string {
+	templates := []string{sub.Method, sub.URL}
+
+	for _, value := range sub.Headers {
+		templates = append(templates, value)
+	}
+
+	if sub.IsBodyTemplated() || sub.BodyMode == BodyModeJSON {
+		templates = append(templates, sub.Body)
+	}
+
+	var missing []string
+
+	for _, tpl := range templates {
+		for _, placeholder := range utilities.MissingPlaceholders(tpl, params) {
+			if !slices.Contains(missing, placeholder) {
+				missing = append(missing, placeholder)
+			}
+		}
+	}
+
+	slices.Sort(missing)
+
+	return missing
 }
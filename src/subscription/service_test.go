@@ -0,0 +1,221 @@
+package subscription
+
+import (
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/datastore"
+	"testing"
+)
+
+func TestApplyPlaceholdersOnSubscriptionStrict(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "")
+
+	sub := Subscription{
+		ID:     "1",
+		Method: "POST",
+		URL:    "https://example.com/{{ .extract.id }}",
+		Headers: map[string]string{
+			"Authorization": "Bearer {{ .global.token }}",
+			"X-Room":        `{{ .extract.room | default "hallway" }}`,
+		},
+		Body: `{"value":"{{ .extract.value }}"}`,
+	}
+
+	params := map[string]any{
+		"extract": map[string]any{"value": "on"},
+		"global":  map[string]any{},
+	}
+
+	t.Run("Missing placeholders are left in place when not strict", func(t *testing.T) {
+		hydrated, err := service.ApplyPlaceholdersOnSubscription(sub, params)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/{{ .extract.id }}", hydrated.URL)
+		assert.Equal(t, "hallway", hydrated.Headers["X-Room"])
+	})
+
+	t.Run("Missing placeholders are reported when strict", func(t *testing.T) {
+		strict := sub
+		strict.StrictPlaceholders = true
+
+		_, err := service.ApplyPlaceholdersOnSubscription(strict, params)
+
+		assert.ErrorIs(t, err, ErrMissingRequiredParametersForTemplate)
+		assert.ErrorContains(t, err, "extract.id, global.token")
+	})
+
+	t.Run("Strict subscriptions are hydrated when all placeholders resolve", func(t *testing.T) {
+		strict := sub
+		strict.StrictPlaceholders = true
+
+		hydrated, err := service.ApplyPlaceholdersOnSubscription(strict, map[string]any{
+			"extract": map[string]any{"id": "42", "value": "on"},
+			"global":  map[string]any{"token": "abc"},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/42", hydrated.URL)
+		assert.Equal(t, "Bearer abc", hydrated.Headers["Authorization"])
+		assert.Equal(t, sub.Body, hydrated.Body, "The body is rendered by the processor")
+	})
+}
+
+func TestSecrets(t *testing.T) {
+	store, _ := datastore.Memory()
+
+	t.Run("Secrets require a key", func(t *testing.T) {
+		service := NewService(store, "")
+
+		assert.ErrorIs(t, service.SetSecret("token", "abc", Actor{}), ErrSecretsNotConfigured)
+	})
+
+	service := NewService(store, "secrets-key")
+
+	assert.NoError(t, service.SetSecret("token", "s3cr3t", Actor{}))
+
+	t.Run("Secrets are encrypted in the store", func(t *testing.T) {
+		stored, _ := store.GetSecrets()
+
+		assert.NotEqual(t, "s3cr3t", stored["token"])
+	})
+
+	t.Run("Secrets are decrypted by the service", func(t *testing.T) {
+		secrets, err := service.GetSecrets()
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"token": "s3cr3t"}, secrets)
+	})
+
+	t.Run("Secret keys are listed without values", func(t *testing.T) {
+		keys, err := service.GetSecretKeys()
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"token"}, keys)
+	})
+
+	t.Run("Secrets are redacted", func(t *testing.T) {
+		assert.Equal(t, "Bearer ********", service.RedactSecrets("Bearer s3cr3t"))
+	})
+
+	t.Run("Redaction follows changes to the secrets", func(t *testing.T) {
+		assert.NoError(t, service.SetSecret("token", "n3w", Actor{}))
+		assert.Equal(t, "Bearer ******** s3cr3t", service.RedactSecrets("Bearer n3w s3cr3t"))
+
+		assert.NoError(t, service.SetSecret("token", "s3cr3t", Actor{}))
+		assert.Equal(t, "Bearer ********", service.RedactSecrets("Bearer s3cr3t"))
+	})
+
+	t.Run("Secrets can't be decrypted with another key", func(t *testing.T) {
+		_, err := NewService(store, "other-key").GetSecrets()
+
+		assert.Error(t, err)
+	})
+}
+
+func TestSetGlobalParameter(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "")
+
+	t.Run("Structured values are stored", func(t *testing.T) {
+		value := map[string]any{"room": "kitchen", "ids": []any{float64(1), float64(2)}, "enabled": true}
+
+		assert.NoError(t, service.SetGlobalParameter("device", value, Actor{}))
+
+		params, _ := service.GetGlobalParameters()
+
+		assert.Equal(t, value, params["device"])
+	})
+
+	t.Run("Nested keys are validated", func(t *testing.T) {
+		err := service.SetGlobalParameter("device", map[string]any{"nested": map[string]any{"invalid key": 1}}, Actor{})
+
+		assert.ErrorIs(t, err, ErrInvalidGlobalParameterKey)
+		assert.ErrorContains(t, err, "device.nested.invalid key")
+	})
+
+	t.Run("Null values are rejected", func(t *testing.T) {
+		assert.ErrorIs(t, service.SetGlobalParameter("device", []any{nil}, Actor{}), ErrInvalidGlobalParameterValue)
+	})
+}
+
+func TestConfiguredGlobalParameters(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "")
+
+	assert.NoError(t, service.SetGlobalParameter("room", "kitchen", Actor{}))
+	assert.NoError(t, service.SetGlobalParameter("token", "from-store", Actor{}))
+	assert.NoError(t, service.SetConfiguredGlobalParameters(map[string]any{"token": "from-config"}))
+
+	t.Run("Configured parameters are merged and take precedence", func(t *testing.T) {
+		params, err := service.GetGlobalParameters()
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"room": "kitchen", "token": "from-config"}, params)
+		assert.Equal(t, []string{"token"}, service.GetConfiguredGlobalParameterKeys())
+	})
+
+	t.Run("Configured parameters are read-only", func(t *testing.T) {
+		assert.ErrorIs(t, service.SetGlobalParameter("token", "changed", Actor{}), ErrReadOnlyGlobalParameter)
+		assert.ErrorIs(t, service.DeleteGlobalParameter("token", Actor{}), ErrReadOnlyGlobalParameter)
+		assert.NoError(t, service.DeleteGlobalParameter("room", Actor{}))
+	})
+
+	t.Run("Invalid configured keys are rejected", func(t *testing.T) {
+		assert.ErrorIs(t, service.SetConfiguredGlobalParameters(map[string]any{"not valid": "x"}), ErrInvalidGlobalParameterKey)
+	})
+}
+
+func TestSubscriptionVersions(t *testing.T) {
+	store, _ := datastore.Memory()
+	service := NewService(store, "")
+	alice := Actor{Name: "alice"}
+
+	sub, err := service.AddSubscription(Subscription{Name: "Lights", Topic: "lights", Method: "POST", URL: "https://example.com"}, alice)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sub.Version)
+
+	t.Run("Updates increment the version", func(t *testing.T) {
+		sub.Name = "Lamps"
+		sub, err = service.UpdateSubscription(sub, alice)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, sub.Version)
+	})
+
+	t.Run("Updates of an outdated version are rejected", func(t *testing.T) {
+		stale := sub
+		stale.Version = 1
+
+		_, err := service.UpdateSubscription(stale, alice)
+		assert.ErrorIs(t, err, ErrVersionMismatch)
+
+		assert.ErrorIs(t, service.DeleteSubscription(sub.ID, 1, alice), ErrVersionMismatch)
+	})
+
+	t.Run("Version 0 skips the check", func(t *testing.T) {
+		unchecked := sub
+		unchecked.Version = 0
+
+		updated, err := service.UpdateSubscription(unchecked, alice)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, updated.Version)
+	})
+
+	t.Run("Subscriptions stored without version start at 1", func(t *testing.T) {
+		legacy, err := store.AddSubscription(datastore.SubscriptionRecord{ID: "legacy", Name: "Legacy"})
+		assert.NoError(t, err)
+
+		current, err := service.GetSubscription(legacy.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, current.Version)
+
+		updated, err := service.UpdateSubscription(current, alice)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, updated.Version)
+	})
+
+	t.Run("Deletes of the current version succeed", func(t *testing.T) {
+		assert.NoError(t, service.DeleteSubscription(sub.ID, 3, alice))
+	})
+}
@@ -1,18 +1,63 @@
 package subscription
 
+const (
+	// BodyModeTemplate renders the body as a text/template, this is the default.
+	BodyModeTemplate = "template"
+	// BodyModeJSON treats the body as a JSON document, in which string values are rendered as templates. A string that
+	// consists of a single placeholder is replaced by the (typed) value it refers to.
+	BodyModeJSON = "json"
+	// BodyModeJSONata evaluates the body as a JSONata expression against the parameters, and encodes the result as JSON.
+	BodyModeJSONata = "jsonata"
+)
+
+const (
+	// ErrorPolicyFailOpen logs errors and continues processing where possible, this is the default.
+	ErrorPolicyFailOpen = "fail-open"
+	// ErrorPolicyFailClosed logs errors and drops the message.
+	ErrorPolicyFailClosed = "fail-closed"
+	// ErrorPolicyDeadLetter drops the message and adds it to the dead letter queue.
+	ErrorPolicyDeadLetter = "dead-letter"
+)
+
 type Subscription struct {
 	// ID is the unique identifier for the subscription
 	ID string `json:"id"`
+	// Version is incremented on every change, starting at 1
+	Version int `json:"version"`
 	// Name is the name of the subscription
 	Name string `json:"name"`
 
 	// Topic is the MQTT topic the subscription is for
 	Topic string `json:"topic"`
 
+	// Tags are free-form labels to organise and select subscriptions
+	Tags []string `json:"tags"`
+	// Group is the optional group the subscription belongs to
+	Group string `json:"group"`
+	// Disabled subscriptions are kept, but not processed
+	Disabled bool `json:"disabled"`
+
+	// BlueprintID refers to the blueprint the subscription is an instance of, the fields that aren't specific to the
+	// instance are filled in from the blueprint
+	BlueprintID string `json:"blueprintId"`
+	// Parameters are the values the instance provides for the parameters of the blueprint
+	Parameters map[string]string `json:"parameters"`
+	// ResolvedParameters are the values of all parameters of the blueprint including defaults, available as .param
+	ResolvedParameters map[string]string `json:"-"`
+
+	// PayloadFormat is the format used to decode the message payload before extraction, defaults to JSON
+	PayloadFormat string `json:"payloadFormat"`
 	// Extract is a map of variable names to JSONata expressions
 	Extract map[string]string `json:"extract"`
 	// Filter is a JSONata expression to filter messages, returning true if the message should be processed
 	Filter string `json:"filter"`
+	// SkipRetained indicates retained messages should not be processed
+	SkipRetained bool `json:"skipRetained"`
+	// StrictPlaceholders refuses to deliver a message when a placeholder in the method, URL, headers or body can't be
+	// resolved, placeholders with a default (e.g. {{ .extract.id | default "0" }}) are optional
+	StrictPlaceholders bool `json:"strictPlaceholders"`
+	// ErrorPolicy determines what happens when extraction, filtering or rendering fails, one of the ErrorPolicy constants
+	ErrorPolicy string `json:"errorPolicy"`
 
 	// Method is the HTTP method to use for the request
 	Method string `json:"method"`
@@ -22,4 +67,10 @@ type Subscription struct {
 	Headers map[string]string `json:"headers"`
 	// Body is the template to use for rendering the HTTP response body
 	Body string `json:"template"`
+	// BodyMode determines how the Body is rendered, one of the BodyMode constants, defaults to BodyModeTemplate
+	BodyMode string `json:"bodyMode"`
+}
+
+func (s Subscription) IsBodyTemplated() bool {
+	return s.BodyMode == "" || s.BodyMode == BodyModeTemplate
 }
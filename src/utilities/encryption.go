@@ -0,0 +1,71 @@
+package utilities
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// Encrypt encrypts the plaintext using AES-256-GCM, with a key derived from the passphrase. The result is the base64
+// encoded nonce followed by the ciphertext.
+func Encrypt(passphrase string, plaintext string) (string, error) {
+	gcm, err := newGCM(passphrase)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// Decrypt reverses Encrypt, it fails when the passphrase is not the one the value was encrypted with.
+func Decrypt(passphrase string, encrypted string) (string, error) {
+	gcm, err := newGCM(passphrase)
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(passphrase string) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+
+	key := sha256.Sum256([]byte(passphrase))
+
+	block, err := aes.NewCipher(key[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
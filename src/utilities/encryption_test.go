@@ -0,0 +1,34 @@
+package utilities_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/utilities"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	encrypted, err := utilities.Encrypt("passphrase", "s3cr3t")
+
+	assert.NoError(t, err)
+	assert.NotContains(t, encrypted, "s3cr3t")
+
+	t.Run("Decrypting with the same passphrase", func(t *testing.T) {
+		decrypted, err := utilities.Decrypt("passphrase", encrypted)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cr3t", decrypted)
+	})
+
+	t.Run("Decrypting with another passphrase", func(t *testing.T) {
+		_, err := utilities.Decrypt("other", encrypted)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Encrypting twice yields different values", func(t *testing.T) {
+		again, err := utilities.Encrypt("passphrase", "s3cr3t")
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, encrypted, again)
+	})
+}
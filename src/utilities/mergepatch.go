@@ -0,0 +1,47 @@
+package utilities
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MergePatch applies a JSON Merge Patch (RFC 7396) to the JSON document. Objects in the patch are merged recursively,
+// null removes a member and any other value replaces it.
+func MergePatch(document []byte, patch []byte) ([]byte, error) {
+	var target, changes any
+
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	return json.Marshal(mergePatch(target, changes))
+}
+
+func mergePatch(target any, patch any) any {
+	changes, ok := patch.(map[string]any)
+
+	if !ok {
+		return patch
+	}
+
+	result, ok := target.(map[string]any)
+
+	if !ok {
+		result = make(map[string]any, len(changes))
+	}
+
+	for key, value := range changes {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+
+		result[key] = mergePatch(result[key], value)
+	}
+
+	return result
+}
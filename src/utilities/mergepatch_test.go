@@ -0,0 +1,47 @@
+package utilities_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/utilities"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, appendix A
+	tests := []struct {
+		document string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.document+" "+test.patch, func(t *testing.T) {
+			result, err := utilities.MergePatch([]byte(test.document), []byte(test.patch))
+
+			assert.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(result))
+		})
+	}
+
+	t.Run("invalid patch", func(t *testing.T) {
+		_, err := utilities.MergePatch([]byte(`{}`), []byte(`{`))
+
+		assert.Error(t, err)
+	})
+}
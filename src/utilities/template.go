@@ -2,12 +2,26 @@ package utilities
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"math"
+	"net/url"
+	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"text/template/parse"
+	"time"
 )
 
 func RenderInlineTemplate(tpl string, data any) (string, error) {
@@ -15,7 +29,7 @@ func RenderInlineTemplate(tpl string, data any) (string, error) {
 		data = make(map[string]any)
 	}
 
-	parsed, err := template.New("inline").Option().Parse(tpl)
+	parsed, err := template.New("inline").Funcs(TemplateFuncs()).Parse(tpl)
 
 	if err != nil {
 		return "", err
@@ -48,6 +62,110 @@ func RenderInlineTemplate(tpl string, data any) (string, error) {
 
 var templatePlaceholderRegexp = regexp.MustCompile(`\{\{(\s*[a-zA-Z0-9_.]+\s*)\}\}`)
 
+// MissingPlaceholders returns the placeholders (e.g. extract.id for {{ .extract.id }}) in the template that can't be
+// resolved from the data, or resolve to null. Placeholders piped into default, like {{ .extract.id | default "0" }},
+// are optional and not returned. Neither are the conditions of if, with and range, which check whether a value is
+// there, nor the placeholders within with and range, which are relative to another value.
+func MissingPlaceholders(tpl string, data any) []string {
+	parsed, err := template.New("placeholders").Funcs(TemplateFuncs()).Parse(tpl)
+
+	// Invalid templates are reported when rendering them.
+	if err != nil || parsed.Tree == nil {
+		return nil
+	}
+
+	placeholders := nodePlaceholders(parsed.Tree.Root)
+
+	if len(placeholders) == 0 {
+		return nil
+	}
+
+	if data == nil {
+		data = make(map[string]any)
+	}
+
+	encoded, _ := json.Marshal(data)
+	resolved := gjson.ParseBytes(encoded)
+
+	var missing []string
+
+	for _, placeholder := range placeholders {
+		value := resolved.Get(placeholder)
+
+		if (!value.Exists() || value.Type == gjson.Null) && !slices.Contains(missing, placeholder) {
+			missing = append(missing, placeholder)
+		}
+	}
+
+	return missing
+}
+
+// nodePlaceholders returns the placeholders in the node that must resolve to a value.
+func nodePlaceholders(node parse.Node) []string {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+
+		var placeholders []string
+
+		for _, child := range n.Nodes {
+			placeholders = append(placeholders, nodePlaceholders(child)...)
+		}
+
+		return placeholders
+	case *parse.ActionNode:
+		return pipePlaceholders(n.Pipe)
+	case *parse.IfNode:
+		return append(nodePlaceholders(n.List), nodePlaceholders(n.ElseList)...)
+	case *parse.WithNode:
+		return nodePlaceholders(n.ElseList)
+	case *parse.RangeNode:
+		return nodePlaceholders(n.ElseList)
+	}
+
+	return nil
+}
+
+// pipePlaceholders returns the placeholders used in the pipeline, except those piped into default.
+func pipePlaceholders(pipe *parse.PipeNode) []string {
+	if pipe == nil {
+		return nil
+	}
+
+	var placeholders []string
+
+	for i, cmd := range pipe.Cmds {
+		// The result of each command is passed on to the next, so default covers all commands up to and including it.
+		if slices.ContainsFunc(pipe.Cmds[i:], isDefaultCommand) {
+			continue
+		}
+
+		for _, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.FieldNode:
+				placeholders = append(placeholders, strings.Join(a.Ident, "."))
+			case *parse.VariableNode:
+				// $.extract.id refers to the data as well.
+				if len(a.Ident) > 1 && a.Ident[0] == "$" {
+					placeholders = append(placeholders, strings.Join(a.Ident[1:], "."))
+				}
+			case *parse.PipeNode:
+				placeholders = append(placeholders, pipePlaceholders(a)...)
+			}
+		}
+	}
+
+	return placeholders
+}
+
+func isDefaultCommand(cmd *parse.CommandNode) bool {
+	identifier, ok := cmd.Args[0].(*parse.IdentifierNode)
+
+	return ok && identifier.Ident == "default"
+}
+
 func findAllPlaceholdersInTemplate(template string) []string {
 	matches := templatePlaceholderRegexp.FindAllStringSubmatch(template, -1)
 
@@ -59,3 +177,302 @@ func findAllPlaceholdersInTemplate(template string) []string {
 
 	return placeholders
 }
+
+// TemplateFuncs returns the functions that are available in every template rendered by the application.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Encoding
+		"base64":       base64Encode,
+		"base64Decode": base64Decode,
+		"hex":          hexEncode,
+		"hexDecode":    hexDecode,
+		"toJson":       toJSON,
+		"quote":        quote,
+		"urlencode":    url.QueryEscape,
+
+		// Strings
+		"default":    defaultValue,
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"trim":       strings.TrimSpace,
+		"replace":    replace,
+		"contains":   strings.Contains,
+		"hasPrefix":  strings.HasPrefix,
+		"hasSuffix":  strings.HasSuffix,
+		"split":      strings.Split,
+		"join":       join,
+		"substr":     substr,
+		"trimPrefix": strings.TrimPrefix,
+		"trimSuffix": strings.TrimSuffix,
+
+		// Math
+		"add":   add,
+		"sub":   sub,
+		"mul":   mul,
+		"div":   div,
+		"round": round,
+
+		// Time
+		"now":        time.Now,
+		"formatTime": formatTime,
+		"unix":       unix,
+
+		// Hashing
+		"sha256":     sha256Hex,
+		"hmacSha256": hmacSha256Hex,
+
+		// Environment
+		"env": env,
+	}
+}
+
+var (
+	templateEnvAllowList   = make(map[string]struct{})
+	templateEnvAllowListMu sync.RWMutex
+)
+
+// AllowTemplateEnv replaces the list of environment variables that can be read with the env template function.
+func AllowTemplateEnv(names ...string) {
+	templateEnvAllowListMu.Lock()
+	defer templateEnvAllowListMu.Unlock()
+
+	templateEnvAllowList = make(map[string]struct{}, len(names))
+
+	for _, name := range names {
+		templateEnvAllowList[name] = struct{}{}
+	}
+}
+
+func env(name string) (string, error) {
+	templateEnvAllowListMu.RLock()
+	_, ok := templateEnvAllowList[name]
+	templateEnvAllowListMu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not in the allow-list", name)
+	}
+
+	return os.Getenv(name), nil
+}
+
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+
+	return string(b), err
+}
+
+// quote returns the value as a quoted and escaped JSON string.
+func quote(v any) (string, error) {
+	if v == nil {
+		return `""`, nil
+	}
+
+	return toJSON(fmt.Sprintf("%v", v))
+}
+
+// defaultValue returns the fallback when the value is missing or empty, usable as {{ .extract.x | default "y" }}.
+func defaultValue(fallback any, v any) any {
+	switch value := v.(type) {
+	case nil:
+		return fallback
+	case string:
+		if value == "" {
+			return fallback
+		}
+	case []any:
+		if len(value) == 0 {
+			return fallback
+		}
+	case map[string]any:
+		if len(value) == 0 {
+			return fallback
+		}
+	}
+
+	return v
+}
+
+func replace(search, replacement string, s string) string {
+	return strings.ReplaceAll(s, search, replacement)
+}
+
+func join(sep string, v any) string {
+	switch values := v.(type) {
+	case []string:
+		return strings.Join(values, sep)
+	case []any:
+		return strings.Join(MapSlice(values, func(v any) string { return fmt.Sprintf("%v", v) }), sep)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func substr(start, end int, s string) string {
+	runes := []rune(s)
+
+	start = max(0, min(start, len(runes)))
+
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+
+	if end < start {
+		return ""
+	}
+
+	return string(runes[start:end])
+}
+
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(n), 64)
+	case json.Number:
+		return n.Float64()
+	default:
+		return 0, fmt.Errorf("unable to use %v (%T) as a number", v, v)
+	}
+}
+
+func arithmetic(a, b any, op func(a, b float64) (float64, error)) (float64, error) {
+	x, err := toFloat(a)
+
+	if err != nil {
+		return 0, err
+	}
+
+	y, err := toFloat(b)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return op(x, y)
+}
+
+func add(a, b any) (float64, error) {
+	return arithmetic(a, b, func(a, b float64) (float64, error) { return a + b, nil })
+}
+
+func sub(a, b any) (float64, error) {
+	return arithmetic(a, b, func(a, b float64) (float64, error) { return a - b, nil })
+}
+
+func mul(a, b any) (float64, error) {
+	return arithmetic(a, b, func(a, b float64) (float64, error) { return a * b, nil })
+}
+
+func div(a, b any) (float64, error) {
+	return arithmetic(a, b, func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+
+		return a / b, nil
+	})
+}
+
+func round(precision int, v any) (float64, error) {
+	n, err := toFloat(v)
+
+	if err != nil {
+		return 0, err
+	}
+
+	factor := math.Pow(10, float64(precision))
+
+	return math.Round(n*factor) / factor, nil
+}
+
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		return time.Parse(time.RFC3339, t)
+	default:
+		seconds, err := toFloat(v)
+
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		return time.Unix(0, int64(seconds*float64(time.Second))).UTC(), nil
+	}
+}
+
+// formatTime formats a time, RFC3339 string or unix timestamp using a Go layout, usable as {{ now | formatTime "2006-01-02" }}.
+func formatTime(layout string, v any) (string, error) {
+	t, err := toTime(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	return t.Format(layout), nil
+}
+
+func unix(v any) (int64, error) {
+	t, err := toTime(v)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Unix(), nil
+}
+
+func sha256Hex(v any) string {
+	hash := sha256.Sum256(toBytes(v))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSha256Hex(key string, v any) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(toBytes(v))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func base64Encode(v any) string {
+	return base64.StdEncoding.EncodeToString(toBytes(v))
+}
+
+func base64Decode(v any) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(string(toBytes(v)))
+
+	return string(b), err
+}
+
+func hexEncode(v any) string {
+	return hex.EncodeToString(toBytes(v))
+}
+
+func hexDecode(v any) (string, error) {
+	b, err := hex.DecodeString(string(toBytes(v)))
+
+	return string(b), err
+}
+
+// toBytes allows the encoding functions to be used on strings (the payload), raw bytes and any other value.
+func toBytes(v any) []byte {
+	switch b := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return b
+	case string:
+		return []byte(b)
+	default:
+		return []byte(fmt.Sprintf("%v", b))
+	}
+}
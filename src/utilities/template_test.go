@@ -0,0 +1,107 @@
+package utilities_test
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"mqtt-http-bridge/src/utilities"
+	"os"
+	"testing"
+)
+
+func TestRenderInlineTemplate(t *testing.T) {
+	data := map[string]any{
+		"extract": map[string]any{
+			"action":  `say "hi"`,
+			"battery": float64(87),
+			"empty":   "",
+			"object":  map[string]any{"on": true},
+		},
+		"meta": map[string]any{
+			"payload": "ON",
+		},
+	}
+
+	tt := []struct {
+		template string
+		expected string
+	}{
+		{"{{ .extract.battery }}", "87"},
+		{"{{ .extract.missing }}", "{{ .extract.missing }}"},
+		{"{{ .extract.action | quote }}", `"say \"hi\""`},
+		{"{{ .extract.object | toJson }}", `{"on":true}`},
+		{`{{ .extract.empty | default "fallback" }}`, "fallback"},
+		{`{{ .extract.missing | default "fallback" }}`, "fallback"},
+		{"{{ .meta.payload | lower }}", "on"},
+		{"{{ .meta.payload | base64 }}", "T04="},
+		{"{{ .meta.payload | hex }}", "4f4e"},
+		{"{{ add .extract.battery 3 }}", "90"},
+		{"{{ div .extract.battery 2 | round 1 }}", "43.5"},
+		{`{{ 0 | formatTime "2006-01-02" }}`, "1970-01-01"},
+		{`{{ .meta.payload | hmacSha256 "secret" }}`, "065e74e3f4e541b44d8cfa5d15d1e1eef29b97eab01fc749a43438a11f932a19"},
+		{`{{ "a b" | urlencode }}`, "a+b"},
+	}
+
+	for n, tc := range tt {
+		t.Run(fmt.Sprintf("Render Inline Template Test Case #%d", n+1), func(t *testing.T) {
+			rendered, err := utilities.RenderInlineTemplate(tc.template, data)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, rendered)
+		})
+	}
+}
+
+func TestTemplateEnvAllowList(t *testing.T) {
+	t.Setenv("TEMPLATE_TEST_ALLOWED", "allowed")
+	t.Setenv("TEMPLATE_TEST_DENIED", "denied")
+
+	utilities.AllowTemplateEnv("TEMPLATE_TEST_ALLOWED")
+	defer utilities.AllowTemplateEnv()
+
+	rendered, err := utilities.RenderInlineTemplate(`{{ env "TEMPLATE_TEST_ALLOWED" }}`, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getenv("TEMPLATE_TEST_ALLOWED"), rendered)
+
+	_, err = utilities.RenderInlineTemplate(`{{ env "TEMPLATE_TEST_DENIED" }}`, nil)
+
+	assert.Error(t, err)
+}
+
+func TestMissingPlaceholders(t *testing.T) {
+	data := map[string]any{
+		"extract": map[string]any{
+			"id":    nil,
+			"room":  "kitchen",
+			"empty": "",
+		},
+	}
+
+	tt := []struct {
+		template string
+		missing  []string
+	}{
+		{"https://x/{{ .extract.room }}", nil},
+		{"https://x/{{ .extract.empty }}", nil},
+		{"https://x/{{ .extract.nope }}", []string{"extract.nope"}},
+		{"https://x/{{ .extract.id }}", []string{"extract.id"}},
+		{"https://x/{{ .extract.nope | urlencode }}", []string{"extract.nope"}},
+		{"{{ printf \"%s-%s\" .extract.room .extract.nope }}", []string{"extract.nope"}},
+		{"{{ $.extract.nope }}", []string{"extract.nope"}},
+		{"{{ .extract.nope }}{{ .extract.id }}{{ .extract.nope }}", []string{"extract.nope", "extract.id"}},
+		{`{{ .extract.nope | default "0" }}`, nil},
+		{`{{ .extract.id | default "0" }}`, nil},
+		{`{{ .extract.nope | upper | default "0" }}`, nil},
+		{`{{ default "0" .extract.nope }}`, nil},
+		{`{{ .extract.room | default "0" | printf "%s-%s" .extract.nope }}`, []string{"extract.nope"}},
+		{"{{ if .extract.nope }}{{ .extract.nope }}{{ else }}{{ .extract.other }}{{ end }}", []string{"extract.nope", "extract.other"}},
+		{"{{ with .extract.nope }}{{ .value }}{{ end }}", nil},
+		{"{{ .extract.room", nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.template, func(t *testing.T) {
+			assert.Equal(t, tc.missing, utilities.MissingPlaceholders(tc.template, data))
+		})
+	}
+}
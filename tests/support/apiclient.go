@@ -52,13 +52,13 @@ func (a *apiClient) ListSubscriptions() (resp SubscriptionsResponse) {
 }
 
 func (a *apiClient) UpdateSubscription(id string, opts UpdateSubscriptionOptions) (resp SubscriptionResponse) {
-	a.client.doAssign(&resp, http.MethodPut, fmt.Sprintf("/subscriptions/%s", id), bodyJson(opts))
+	a.client.doAssign(&resp, http.MethodPut, fmt.Sprintf("/subscriptions/%s", id), bodyJson(opts), header("If-Match", "*"))
 
 	return resp
 }
 
 func (a *apiClient) DeleteSubscription(id string) {
-	a.client.do(http.MethodDelete, fmt.Sprintf("/subscriptions/%s", id), nil)
+	a.client.do(http.MethodDelete, fmt.Sprintf("/subscriptions/%s", id), header("If-Match", "*"))
 }
 
 func (a *apiClient) SetGlobalParameter(parameter string, value any) {
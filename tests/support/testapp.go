@@ -113,6 +113,9 @@ func runApp(t *testing.T, ctx context.Context, options RunAppOptions) {
 			Port:     options.MQTTPort,
 			OpenAuth: true,
 		},
+		Publisher: config.PublisherConfig{
+			Parallel: 10,
+		},
 		Server: config.ServerConfig{
 			Address: "127.0.0.1",
 			Port:    options.HTTPPort,